@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/internal/config"
+	"github.com/joeshaw/ecobee-exporter/internal/leader"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+	"github.com/joeshaw/ecobee-exporter/pkg/poller"
+)
+
+// validAccountName matches the account names that can be used in metrics
+// paths.
+var validAccountName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// account is an ecobee account the exporter collects: the one of --appkey
+// and --cachefile, or one of the accounts of the configuration file.
+type account struct {
+	name         string // empty for the account of the flags
+	appKey       string
+	cacheFile    string
+	bearerToken  string
+	snapshotFile string
+
+	// reg registers the metrics of the account's API client.
+	reg prometheus.Registerer
+}
+
+// flagAccount returns the account of --appkey and --cachefile.
+func flagAccount() account {
+	return account{
+		appKey:       *applicationKey,
+		cacheFile:    *cacheFile,
+		snapshotFile: *snapshotFile,
+		reg:          prometheus.DefaultRegisterer,
+	}
+}
+
+// accounts returns the accounts of the configuration file, or the account
+// of the flags if it has none. The API client metrics of the accounts of
+// the configuration file are labelled with the account name, and each
+// keeps its snapshot, if any, in --snapshot.file suffixed with its name.
+func accounts(cfg *config.Config) ([]account, error) {
+	if len(cfg.Accounts) == 0 {
+		return []account{flagAccount()}, nil
+	}
+	names, caches := map[string]bool{}, map[string]bool{}
+	accts := make([]account, 0, len(cfg.Accounts))
+	for i, a := range cfg.Accounts {
+		switch {
+		case !validAccountName.MatchString(a.Name):
+			return nil, fmt.Errorf("account %d: name %q must be letters, digits, underscores and hyphens", i, a.Name)
+		case names[a.Name]:
+			return nil, fmt.Errorf("account %d: duplicate name %q", i, a.Name)
+		case a.CacheFile == "":
+			return nil, fmt.Errorf("account %s: missing cachefile", a.Name)
+		case caches[a.CacheFile]:
+			return nil, fmt.Errorf("account %s: cachefile %s is used by another account", a.Name, a.CacheFile)
+		}
+		names[a.Name], caches[a.CacheFile] = true, true
+		acct := account{
+			name:        a.Name,
+			appKey:      a.AppKey,
+			cacheFile:   a.CacheFile,
+			bearerToken: a.BearerToken,
+			reg:         prometheus.WrapRegistererWith(prometheus.Labels{"account": a.Name}, prometheus.DefaultRegisterer),
+		}
+		if acct.appKey == "" {
+			acct.appKey = *applicationKey
+		}
+		if *snapshotFile != "" {
+			acct.snapshotFile = *snapshotFile + "." + a.Name
+		}
+		accts = append(accts, acct)
+	}
+	return accts, nil
+}
+
+// accountCollector collects the metrics of an account.
+type accountCollector struct {
+	account
+	client    *client.Client
+	collector *collector.Collector
+	poll      *poller.Poller // nil unless polling in the background
+
+	// transforms are the metric transforms of the configuration file and
+	// the flags, applied to the account's metrics alone, so that each
+	// account has its own series limit.
+	transforms []pipeline.Transformer
+
+	// busy is whether equipment was running or a hold was in effect at
+	// the last collection, for the poller to adapt its interval.
+	busy atomic.Bool
+}
+
+// gatherer returns a gatherer of the account's metrics, collected within
+// ctx or taken from the latest poll, or from the leader if e is a standby,
+// after the account's transforms. If labelled, the metrics of the accounts
+// of the configuration file are then labelled with the account name.
+func (a *accountCollector) gatherer(ctx context.Context, e *leader.Elector, labelled bool) prometheus.Gatherer {
+	var col prometheus.Collector = a.collector.Bound(ctx)
+	if a.poll != nil {
+		col = a.poll
+	}
+	return a.transformed(ecobeeGatherer(ctx, col, e), labelled)
+}
+
+// transformed returns g after the account's transforms and, if labelled,
+// its account label.
+func (a *accountCollector) transformed(g prometheus.Gatherer, labelled bool) prometheus.Gatherer {
+	g = pipeline.New(g, a.transforms...)
+	if labelled && a.name != "" {
+		g = pipeline.New(g, pipeline.Labels(regexp.MustCompile(""), map[string]string{"account": a.name}))
+	}
+	return g
+}
+
+// requireBearer serves requests with h if they carry token as their bearer
+// token, or if token is empty.
+func requireBearer(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ecobee-exporter"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+)
+
+// alertEvent is the JSON body posted to --alert.webhook-url.
+type alertEvent struct {
+	Event   string    `json:"event"`
+	Account string    `json:"account,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"`
+}
+
+// alerter posts to a webhook when collections of an account panic, when a
+// number of its consecutive collections fail and when they recover
+// afterwards.
+type alerter struct {
+	url       string
+	account   string // empty for the account of the flags
+	threshold int
+	client    *http.Client
+
+	mu        sync.Mutex
+	failures  int
+	lastError string
+	alerted   bool
+}
+
+func newAlerter(url, account string, threshold int) *alerter {
+	return &alerter{url: url, account: account, threshold: threshold, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// error is a collector error handler.
+func (a *alerter) error(err *collector.Error) {
+	a.mu.Lock()
+	a.lastError = err.Error()
+	a.mu.Unlock()
+	if err.Stage == collector.StagePanic {
+		// The process is about to crash, so send before returning.
+		a.send(alertEvent{Event: "panic", Message: err.Error()})
+	}
+}
+
+// result is a collector result handler.
+func (a *alerter) result(r collector.Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !r.Partial {
+		if a.alerted {
+			go a.send(alertEvent{Event: "recovered", Message: "collections are succeeding again"})
+		}
+		a.failures, a.alerted = 0, false
+		return
+	}
+	a.failures++
+	if a.failures >= a.threshold && !a.alerted {
+		a.alerted = true
+		go a.send(alertEvent{Event: "collection_failures", Message: a.lastError})
+	}
+}
+
+func (a *alerter) send(e alertEvent) {
+	e.Account = a.account
+	e.Time = time.Now()
+	e.Version = Version
+	b, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("error encoding alert", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(b))
+	if err != nil {
+		slog.Error("error creating alert request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		slog.Error("error sending alert", "event", e.Event, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("alert webhook failed", "event", e.Event, "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/sinks"
+)
+
+// backfillDays is how many days of a thermostat's runtime report backfill
+// fetches, and writes with remote write, at a time.
+const backfillDays = 7
+
+// backfillGauges are the columns of the runtime report backfilled as
+// gauges, as the metrics of --api.intervals and the outdoor temperature
+// from ecobee's weather.
+var backfillGauges = []struct {
+	column, name, help string
+	weather            bool
+}{
+	{"zoneAveTemp", "ecobee_interval_temperature", "thermostat-averaged temperature of a 5-minute interval, timestamped with its end", false},
+	{"zoneHumidity", "ecobee_interval_humidity", "thermostat-averaged humidity in percent of a 5-minute interval, timestamped with its end", false},
+	{"zoneHeatTemp", "ecobee_interval_target_temperature_min", "minimum temperature for thermostat to maintain during a 5-minute interval, timestamped with its end", false},
+	{"zoneCoolTemp", "ecobee_interval_target_temperature_max", "maximum temperature for thermostat to maintain during a 5-minute interval, timestamped with its end", false},
+	{"outdoorTemp", "ecobee_outdoor_temperature", "outdoor temperature at a thermostat in degrees, with the source it is from", true},
+}
+
+// backfillEquipment maps the equipment columns of the runtime report to
+// the equipment label of ecobee_equipment_runtime_seconds_total.
+var backfillEquipment = []struct{ column, equipment string }{
+	{"compHeat1", "HeatPump"},
+	{"compHeat2", "HeatPump2"},
+	{"compCool1", "CompCool1"},
+	{"compCool2", "CompCool2"},
+	{"auxHeat1", "AuxHeat1"},
+	{"auxHeat2", "AuxHeat2"},
+	{"auxHeat3", "AuxHeat3"},
+	{"fan", "Fan"},
+	{"humidifier", "Humidifier"},
+	{"dehumidifier", "Dehumidifier"},
+	{"ventilator", "Ventilator"},
+	{"economizer", "Economizer"},
+}
+
+// backfill exports the 5-minute history of every thermostat's runtime
+// report from the start of from to the end of to, dates in the
+// thermostats' local time, as the metrics of --api.intervals and
+// --api.equipment-runtime, timestamped with the ends of the intervals.
+// The metrics are written with remote write to url, or printed to stdout
+// in the OpenMetrics format if url is empty, after the transforms of the
+// configuration file and the flags.
+func backfill(from, to, url, token string) {
+	start, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		fatal(fmt.Errorf("invalid --from %q: want a date such as 2026-01-31", from))
+	}
+	end := time.Now()
+	if to != "" {
+		if end, err = time.Parse(time.DateOnly, to); err != nil {
+			fatal(fmt.Errorf("invalid --to %q: want a date such as 2026-01-31", to))
+		}
+	}
+	if end.Before(start) {
+		fatal(fmt.Errorf("--to is before --from"))
+	}
+
+	c := newClient()
+	_, transforms := setup(c)
+	var columns []string
+	for _, g := range backfillGauges {
+		columns = append(columns, g.column)
+	}
+	for _, e := range backfillEquipment {
+		columns = append(columns, e.column)
+	}
+
+	var sink sinks.Sink
+	if url != "" {
+		sink = sinks.NewRemoteWrite(url, token)
+	}
+	families := map[string]*dto.MetricFamily{}
+	// failed are the ranges that couldn't be fetched or written, which
+	// are reported rather than abandoning the ranges after them
+	var failed []string
+	ctx := context.Background()
+	tt, err := c.GetThermostats(ctx, ecobee.Selection{SelectionType: "registered"})
+	if err != nil {
+		fatal(err)
+	}
+	for _, t := range tt {
+		loc, ok := collector.Location(t)
+		if !ok {
+			slog.Warn("thermostat time unknown, taking its history to be in UTC", "thermostat_id", t.Identifier)
+			loc = time.UTC
+		}
+		totals := map[string]float64{}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, backfillDays) {
+			last := day.AddDate(0, 0, backfillDays-1)
+			if last.After(end) {
+				last = end
+			}
+			fail := func(err error) {
+				slog.Error("error backfilling", "thermostat_id", t.Identifier, "from", day.Format(time.DateOnly), "to", last.Format(time.DateOnly), "error", err)
+				failed = append(failed, fmt.Sprintf("%s from %s to %s", t.Identifier, day.Format(time.DateOnly), last.Format(time.DateOnly)))
+			}
+			reports, err := c.GetRuntimeReport(ctx, []string{t.Identifier}, columns, day.Format(time.DateOnly), last.Format(time.DateOnly))
+			if err != nil {
+				fail(err)
+				continue
+			}
+			mfs := backfillFamilies(t, loc, reports, totals)
+			for _, tr := range transforms {
+				mfs = tr.Transform(mfs)
+			}
+			if sink == nil {
+				for _, mf := range mfs {
+					if f, ok := families[mf.GetName()]; ok {
+						f.Metric = append(f.Metric, mf.Metric...)
+					} else {
+						families[mf.GetName()] = mf
+					}
+				}
+				continue
+			}
+			if err := sink.Write(ctx, mfs); err != nil {
+				fail(err)
+				continue
+			}
+			slog.Info("Backfilled", "thermostat_id", t.Identifier, "from", day.Format(time.DateOnly), "to", last.Format(time.DateOnly))
+		}
+	}
+	defer func() {
+		if len(failed) > 0 {
+			fatal(fmt.Errorf("backfilling failed for %d ranges, rerun them with --from and --to: thermostat %s", len(failed), strings.Join(failed, "; thermostat ")))
+		}
+	}()
+	if sink != nil {
+		return
+	}
+
+	// OpenMetrics keeps each family, and each series in it, together, so
+	// the history is printed at the end
+	names := make([]string, 0, len(families))
+	for name, mf := range families {
+		names = append(names, name)
+		sort.SliceStable(mf.Metric, func(i, j int) bool {
+			return labelKey(mf.Metric[i]) < labelKey(mf.Metric[j])
+		})
+	}
+	sort.Strings(names)
+	enc := expfmt.NewEncoder(os.Stdout, expfmt.FmtOpenMetrics)
+	for _, name := range names {
+		if err := enc.Encode(families[name]); err != nil {
+			fatal(err)
+		}
+	}
+	if err := enc.(expfmt.Closer).Close(); err != nil {
+		fatal(err)
+	}
+}
+
+// backfillFamilies returns the metrics of the rows of the runtime reports
+// of t, whose times are in loc, adding the equipment runtime to the totals
+// of its counters.
+func backfillFamilies(t client.Thermostat, loc *time.Location, reports []client.RuntimeReport, totals map[string]float64) []*dto.MetricFamily {
+	gauges := make([]*dto.MetricFamily, len(backfillGauges))
+	for i, g := range backfillGauges {
+		gauges[i] = &dto.MetricFamily{Name: proto.String(g.name), Help: proto.String(g.help), Type: dto.MetricType_GAUGE.Enum()}
+	}
+	runtime := &dto.MetricFamily{
+		Name: proto.String("ecobee_equipment_runtime_seconds_total"),
+		Help: proto.String("time a thermostat's equipment ran, from the 5-minute intervals of its extended runtime"),
+		Type: dto.MetricType_COUNTER.Enum(),
+	}
+	thermostat := []*dto.LabelPair{
+		{Name: proto.String("thermostat_id"), Value: proto.String(t.Identifier)},
+		{Name: proto.String("thermostat_name"), Value: proto.String(t.Name)},
+	}
+	source := append([]*dto.LabelPair{{Name: proto.String("source"), Value: proto.String("ecobee")}}, thermostat...)
+
+	for _, rep := range reports {
+		for _, row := range rep.RowList {
+			// date,time,columns...; the time is the start of the interval
+			fields := strings.Split(row, ",")
+			if len(fields) != 2+len(backfillGauges)+len(backfillEquipment) {
+				continue
+			}
+			start, err := time.ParseInLocation(time.DateTime, fields[0]+" "+fields[1], loc)
+			if err != nil {
+				continue
+			}
+			ts := proto.Int64(start.Add(5*time.Minute).UnixNano() / int64(time.Millisecond))
+			values := fields[2:]
+			for i, g := range backfillGauges {
+				v, err := strconv.ParseFloat(values[i], 64)
+				if err != nil {
+					continue
+				}
+				labels := thermostat
+				if g.weather {
+					labels = source
+				}
+				gauges[i].Metric = append(gauges[i].Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(v)}, TimestampMs: ts})
+			}
+			values = values[len(backfillGauges):]
+			for i, e := range backfillEquipment {
+				v, err := strconv.ParseFloat(values[i], 64)
+				if err != nil {
+					continue
+				}
+				totals[e.equipment] += v
+				labels := append([]*dto.LabelPair{{Name: proto.String("equipment"), Value: proto.String(e.equipment)}}, thermostat...)
+				runtime.Metric = append(runtime.Metric, &dto.Metric{Label: labels, Counter: &dto.Counter{Value: proto.Float64(totals[e.equipment])}, TimestampMs: ts})
+			}
+		}
+	}
+
+	var mfs []*dto.MetricFamily
+	for _, mf := range append(gauges, runtime) {
+		if len(mf.Metric) > 0 {
+			mfs = append(mfs, mf)
+		}
+	}
+	return mfs
+}
+
+// labelKey returns the labels of m as a string that sorts the metrics of a
+// family by series.
+func labelKey(m *dto.Metric) string {
+	var b strings.Builder
+	for _, lp := range m.Label {
+		b.WriteString(lp.GetName() + "\xff" + lp.GetValue() + "\xff")
+	}
+	return b.String()
+}
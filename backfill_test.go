@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// row returns a runtime report row starting at start with the gauge
+// columns and then runtime seconds of the fan, the only equipment that
+// ran.
+func row(start string, gauges [5]string, fan string) string {
+	equipment := make([]string, len(backfillEquipment))
+	for i, e := range backfillEquipment {
+		if e.equipment == "Fan" {
+			equipment[i] = fan
+		} else {
+			equipment[i] = "0"
+		}
+	}
+	return start + "," + strings.Join(gauges[:], ",") + "," + strings.Join(equipment, ",")
+}
+
+// renderSamples returns a line for each metric of mfs with a non-zero
+// value, in order.
+func renderSamples(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			v := m.GetGauge().GetValue()
+			if m.Counter != nil {
+				v = m.GetCounter().GetValue()
+			}
+			if v == 0 {
+				continue
+			}
+			var labels []string
+			for _, lp := range m.Label {
+				labels = append(labels, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+			}
+			at := time.UnixMilli(m.GetTimestampMs()).UTC().Format(time.RFC3339)
+			lines = append(lines, fmt.Sprintf("%s{%s} %g %s", mf.GetName(), strings.Join(labels, ","), v, at))
+		}
+	}
+	return lines
+}
+
+func TestBackfillFamilies(t *testing.T) {
+	eastern := time.FixedZone("", -4*60*60)
+	tests := []struct {
+		name   string
+		rows   []string
+		totals map[string]float64 // before
+		want   []string
+		fan    float64 // total after
+	}{
+		{
+			name: "rows",
+			rows: []string{
+				row("2026-10-14,23:50:00", [5]string{"70.5", "40", "68", "75", "50.2"}, "300"),
+				row("2026-10-14,23:55:00", [5]string{"70.4", "41", "68", "75", ""}, "120"),
+			},
+			totals: map[string]float64{},
+			want: []string{
+				`ecobee_interval_temperature{thermostat_id="1",thermostat_name="Main"} 70.5 2026-10-15T03:55:00Z`,
+				`ecobee_interval_temperature{thermostat_id="1",thermostat_name="Main"} 70.4 2026-10-15T04:00:00Z`,
+				`ecobee_interval_humidity{thermostat_id="1",thermostat_name="Main"} 40 2026-10-15T03:55:00Z`,
+				`ecobee_interval_humidity{thermostat_id="1",thermostat_name="Main"} 41 2026-10-15T04:00:00Z`,
+				`ecobee_interval_target_temperature_min{thermostat_id="1",thermostat_name="Main"} 68 2026-10-15T03:55:00Z`,
+				`ecobee_interval_target_temperature_min{thermostat_id="1",thermostat_name="Main"} 68 2026-10-15T04:00:00Z`,
+				`ecobee_interval_target_temperature_max{thermostat_id="1",thermostat_name="Main"} 75 2026-10-15T03:55:00Z`,
+				`ecobee_interval_target_temperature_max{thermostat_id="1",thermostat_name="Main"} 75 2026-10-15T04:00:00Z`,
+				`ecobee_outdoor_temperature{source="ecobee",thermostat_id="1",thermostat_name="Main"} 50.2 2026-10-15T03:55:00Z`,
+				`ecobee_equipment_runtime_seconds_total{equipment="Fan",thermostat_id="1",thermostat_name="Main"} 300 2026-10-15T03:55:00Z`,
+				`ecobee_equipment_runtime_seconds_total{equipment="Fan",thermostat_id="1",thermostat_name="Main"} 420 2026-10-15T04:00:00Z`,
+			},
+			fan: 420,
+		},
+		{
+			name: "continued",
+			rows: []string{
+				row("2026-10-15,00:00:00", [5]string{"70.4", "41", "68", "75", "50"}, "60"),
+			},
+			totals: map[string]float64{"Fan": 420},
+			want: []string{
+				`ecobee_interval_temperature{thermostat_id="1",thermostat_name="Main"} 70.4 2026-10-15T04:05:00Z`,
+				`ecobee_interval_humidity{thermostat_id="1",thermostat_name="Main"} 41 2026-10-15T04:05:00Z`,
+				`ecobee_interval_target_temperature_min{thermostat_id="1",thermostat_name="Main"} 68 2026-10-15T04:05:00Z`,
+				`ecobee_interval_target_temperature_max{thermostat_id="1",thermostat_name="Main"} 75 2026-10-15T04:05:00Z`,
+				`ecobee_outdoor_temperature{source="ecobee",thermostat_id="1",thermostat_name="Main"} 50 2026-10-15T04:05:00Z`,
+				`ecobee_equipment_runtime_seconds_total{equipment="Fan",thermostat_id="1",thermostat_name="Main"} 480 2026-10-15T04:05:00Z`,
+			},
+			fan: 480,
+		},
+		{
+			name: "malformed",
+			rows: []string{
+				"2026-10-15,00:00:00,70.4,41",
+				row("yesterday,00:00:00", [5]string{"70.4", "41", "68", "75", "50"}, "60"),
+			},
+			totals: map[string]float64{},
+		},
+		{
+			name:   "empty",
+			totals: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports := []client.RuntimeReport{{ThermostatIdentifier: "1", RowCount: len(tt.rows), RowList: tt.rows}}
+			mfs := backfillFamilies(client.Thermostat{Identifier: "1", Name: "Main"}, eastern, reports, tt.totals)
+			if got := renderSamples(mfs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+			if tt.totals["Fan"] != tt.fan {
+				t.Errorf("fan total %v, want %v", tt.totals["Fan"], tt.fan)
+			}
+		})
+	}
+}
@@ -1,229 +0,0 @@
-// Package prometheus provides Prometheus support for ecobee metrics.
-package collector
-
-import (
-	"fmt"
-	"reflect"
-	"strconv"
-	"time"
-
-	log "github.com/sirupsen/logrus"
-
-	"github.com/billykwooten/go-ecobee/ecobee"
-	"github.com/prometheus/client_golang/prometheus"
-)
-
-type descs string
-
-func (d descs) new(fqName, help string, variableLabels []string) *prometheus.Desc {
-	return prometheus.NewDesc(fmt.Sprintf("%s_%s", d, fqName), help, variableLabels, nil)
-}
-
-// eCollector implements prometheus.eCollector to gather ecobee metrics on-demand.
-type eCollector struct {
-	client *ecobee.Client
-
-	// per-query descriptors
-	fetchTime *prometheus.Desc
-
-	// runtime descriptors
-	actualTemperature, targetTemperatureMin, targetTemperatureMax, currentFanMode, equipmentRunning *prometheus.Desc
-
-	// sensor descriptors
-	temperature, humidity, occupancy, inUse, currentHvacMode *prometheus.Desc
-}
-
-// NewEcobeeCollector returns a new eCollector with the given prefix assigned to all
-// metrics. Note that Prometheus metrics must be unique! Don't try to create
-// two Collectors with the same metric prefix.
-func NewEcobeeCollector(c *ecobee.Client, metricPrefix string) *eCollector {
-	d := descs(metricPrefix)
-
-	// fields common across multiple metrics
-	runtime := []string{"thermostat_id", "thermostat_name"}
-	sensor := append(runtime, "sensor_id", "sensor_name", "sensor_type")
-
-	return &eCollector{
-		client: c,
-
-		// collector metrics
-		fetchTime: d.new(
-			"fetch_time",
-			"elapsed time fetching data via Ecobee API",
-			nil,
-		),
-
-		// thermostat (aka runtime) metrics
-		actualTemperature: d.new(
-			"actual_temperature",
-			"thermostat-averaged current temperature",
-			runtime,
-		),
-		targetTemperatureMax: d.new(
-			"target_temperature_max",
-			"maximum temperature for thermostat to maintain",
-			runtime,
-		),
-		targetTemperatureMin: d.new(
-			"target_temperature_min",
-			"minimum temperature for thermostat to maintain",
-			runtime,
-		),
-
-		// sensor metrics
-		temperature: d.new(
-			"temperature",
-			"temperature reported by a sensor in degrees",
-			sensor,
-		),
-		humidity: d.new(
-			"humidity",
-			"humidity reported by a sensor in percent",
-			sensor,
-		),
-		occupancy: d.new(
-			"occupancy",
-			"occupancy reported by a sensor (0 or 1)",
-			sensor,
-		),
-		inUse: d.new(
-			"in_use",
-			"is sensor being used in thermostat calculations (0 or 1)",
-			sensor,
-		),
-		currentHvacMode: d.new(
-			"currenthvacmode",
-			"current hvac mode of thermostat",
-			[]string{"thermostat_id", "thermostat_name", "current_hvac_mode"},
-		),
-		currentFanMode: d.new(
-			"currentfanmode",
-			"current fan mode of thermostat",
-			[]string{"thermostat_id", "thermostat_name", "current_fan_mode"},
-		),
-		equipmentRunning: d.new(
-			"equipment_running",
-			"current equipment status (0 or 1)",
-			[]string{"thermostat_id", "thermostat_name", "equipment"},
-		),
-	}
-}
-
-// Describe dumps all metric descriptors into ch.
-func (c *eCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.fetchTime
-	ch <- c.actualTemperature
-	ch <- c.targetTemperatureMax
-	ch <- c.targetTemperatureMin
-	ch <- c.temperature
-	ch <- c.humidity
-	ch <- c.occupancy
-	ch <- c.inUse
-	ch <- c.currentHvacMode
-	ch <- c.currentFanMode
-	ch <- c.equipmentRunning
-}
-
-var Bool2Float = map[bool]float64{false: 0, true: 1}
-
-// Collect retrieves thermostat data via the ecobee API.
-func (c *eCollector) Collect(ch chan<- prometheus.Metric) {
-	start := time.Now()
-	tt, err := c.client.GetThermostats(ecobee.Selection{
-		SelectionType:   "registered",
-		IncludeSensors:  true,
-		IncludeRuntime:  true,
-		IncludeSettings: true,
-	})
-	elapsed := time.Now().Sub(start)
-	ch <- prometheus.MustNewConstMetric(c.fetchTime, prometheus.GaugeValue, elapsed.Seconds())
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	for _, t := range tt {
-		// get equipment summary
-		ts, err := c.client.GetThermostatSummary((ecobee.Selection{
-			SelectionType:          "registered",
-			IncludeEquipmentStatus: true,
-		}))
-		if err != nil {
-			log.Error(err)
-			return
-		}
-
-		tFields := []string{t.Identifier, t.Name}
-		if t.Runtime.Connected {
-			ch <- prometheus.MustNewConstMetric(
-				c.actualTemperature, prometheus.GaugeValue, float64(t.Runtime.ActualTemperature)/10, tFields...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				c.targetTemperatureMax, prometheus.GaugeValue, float64(t.Runtime.DesiredCool)/10, tFields...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				c.targetTemperatureMin, prometheus.GaugeValue, float64(t.Runtime.DesiredHeat)/10, tFields...,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				c.currentHvacMode, prometheus.GaugeValue, 0, t.Identifier, t.Name, t.Settings.HvacMode,
-			)
-			ch <- prometheus.MustNewConstMetric(
-				c.currentFanMode, prometheus.GaugeValue, 0, t.Identifier, t.Name, t.Runtime.DesiredFanMode,
-			)
-
-			// dynamically create a metric for each equipment status
-			r := reflect.ValueOf(ts[t.Identifier].EquipmentStatus)
-			equipFields := reflect.VisibleFields(reflect.TypeOf(struct{ ecobee.EquipmentStatus }{}))
-			for _, f := range equipFields {
-				fieldVal := reflect.Indirect(r).FieldByName(f.Name)
-				if fieldVal.IsValid() {
-					ch <- prometheus.MustNewConstMetric(
-						c.equipmentRunning, prometheus.GaugeValue, Bool2Float[fieldVal.Bool()], t.Identifier, t.Name, f.Name,
-					)
-				}
-			}
-		}
-		for _, s := range t.RemoteSensors {
-			sFields := append(tFields, s.ID, s.Name, s.Type)
-			ch <- prometheus.MustNewConstMetric(
-				c.inUse, prometheus.GaugeValue, Bool2Float[s.InUse], sFields...,
-			)
-			for _, sc := range s.Capability {
-				switch sc.Type {
-				case "temperature":
-					if v, err := strconv.ParseFloat(sc.Value, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(
-							c.temperature, prometheus.GaugeValue, v/10, sFields...,
-						)
-					} else {
-						log.Error(err)
-					}
-				case "humidity":
-					if v, err := strconv.ParseFloat(sc.Value, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(
-							c.humidity, prometheus.GaugeValue, v, sFields...,
-						)
-					} else {
-						log.Error(err)
-					}
-				case "occupancy":
-					switch sc.Value {
-					case "true":
-						ch <- prometheus.MustNewConstMetric(
-							c.occupancy, prometheus.GaugeValue, 1, sFields...,
-						)
-					case "false":
-						ch <- prometheus.MustNewConstMetric(
-							c.occupancy, prometheus.GaugeValue, 0, sFields...,
-						)
-					default:
-						log.Errorf("unknown sensor occupancy value %q", sc.Value)
-					}
-				case "airPressure":
-					// ignore air pressure sensor, as mine always reports "unknown"
-				default:
-					log.Infof("ignoring sensor capability %q value %q", sc.Type, sc.Value)
-				}
-			}
-		}
-	}
-}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+	"github.com/joeshaw/ecobee-exporter/pkg/sinks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+	"github.com/prometheus/common/model"
+)
+
+// once collects the ecobee metrics a single time and prints them to stdout
+// in the Prometheus text format. It exits with a non-zero status if any
+// part of the collection failed.
+func once() {
+	failed := false
+	ecobeeCollector, transforms := setup(newClient(), collector.WithErrorHandler(func(*collector.Error) {
+		failed = true
+	}))
+	ecobeeRegistry := prometheus.NewRegistry()
+	ecobeeRegistry.MustRegister(ecobeeCollector)
+
+	mfs, err := pipeline.New(ecobeeRegistry, transforms...).Gather()
+	if err != nil {
+		fatal(err)
+	}
+	if err := sinks.NewWriter(os.Stdout).Write(context.Background(), mfs); err != nil {
+		fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// check validates the configuration, authorizes with the API and collects
+// once, then reports what would be exported. It exits with a non-zero
+// status if any part of the collection failed.
+func check() {
+	var errs []*collector.Error
+	ecobeeCollector, transforms := setup(newClient(), collector.WithErrorHandler(func(err *collector.Error) {
+		errs = append(errs, err)
+	}))
+	ecobeeRegistry := prometheus.NewRegistry()
+	ecobeeRegistry.MustRegister(ecobeeCollector)
+
+	mfs, err := pipeline.New(ecobeeRegistry, transforms...).Gather()
+	if err != nil {
+		fatal(err)
+	}
+	thermostats := map[string]bool{}
+	sensors := map[string]bool{}
+	series := 0
+	var names []string
+	for _, mf := range mfs {
+		names = append(names, mf.GetName())
+		series += len(mf.GetMetric())
+		for _, m := range mf.GetMetric() {
+			var tid, sid string
+			for _, lp := range m.GetLabel() {
+				switch lp.GetName() {
+				case "thermostat_id":
+					tid = lp.GetValue()
+				case "sensor_id":
+					sid = lp.GetValue()
+				}
+			}
+			if tid != "" {
+				thermostats[tid] = true
+				if sid != "" {
+					sensors[tid+"/"+sid] = true
+				}
+			}
+		}
+	}
+
+	fmt.Printf("configuration ok\n")
+	fmt.Printf("thermostats: %d\n", len(thermostats))
+	fmt.Printf("sensors: %d\n", len(sensors))
+	fmt.Printf("metrics: %d families, %d series\n", len(names), series)
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// lint collects once, applying the configured transforms, and checks the
+// result the way promtool does, as well as for invalid names and duplicate
+// series that renames and label changes can introduce. It exits with a
+// non-zero status if any problems are found.
+func lint() {
+	ecobeeCollector, transforms := setup(newClient())
+	ecobeeRegistry := prometheus.NewRegistry()
+	ecobeeRegistry.MustRegister(ecobeeCollector)
+
+	var problems []string
+	mfs, err := pipeline.New(ecobeeRegistry, transforms...).Gather()
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	lp, err := promlint.NewWithMetricFamilies(mfs).Lint()
+	if err != nil {
+		fatal(err)
+	}
+	for _, p := range lp {
+		problems = append(problems, fmt.Sprintf("%s: %s", p.Metric, p.Text))
+	}
+
+	families := map[string]bool{}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			problems = append(problems, fmt.Sprintf("%s: invalid metric name", name))
+		}
+		if families[name] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate metric family", name))
+		}
+		families[name] = true
+
+		series := map[string]bool{}
+		for _, m := range mf.GetMetric() {
+			ls := model.LabelSet{}
+			for _, lp := range m.GetLabel() {
+				ln := model.LabelName(lp.GetName())
+				if !ln.IsValid() {
+					problems = append(problems, fmt.Sprintf("%s: invalid label name %q", name, ln))
+				}
+				ls[ln] = model.LabelValue(lp.GetValue())
+			}
+			if series[ls.String()] {
+				problems = append(problems, fmt.Sprintf("%s: duplicate series %s", name, ls))
+			}
+			series[ls.String()] = true
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%d metric families ok\n", len(mfs))
+}
+
+// listThermostats prints the registered thermostats, so their IDs and
+// names can be used in configuration without digging through metrics.
+func listThermostats() {
+	tt := fetchThermostats(ecobee.Selection{
+		SelectionType:  "registered",
+		IncludeRuntime: true,
+	})
+
+	type thermostat struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Model     string `json:"model"`
+		Connected bool   `json:"connected"`
+	}
+	list := make([]thermostat, 0, len(tt))
+	rows := make([][]string, 0, len(tt))
+	for _, t := range tt {
+		list = append(list, thermostat{t.Identifier, t.Name, t.ModelNumber, t.Runtime.Connected})
+		rows = append(rows, []string{t.Identifier, t.Name, t.ModelNumber, fmt.Sprint(t.Runtime.Connected)})
+	}
+	if *listJSON {
+		printJSON(list)
+		return
+	}
+	printTable([]string{"ID", "NAME", "MODEL", "CONNECTED"}, rows)
+}
+
+// listSensors prints the remote sensors of every registered thermostat,
+// including the thermostats' built-in sensors.
+func listSensors() {
+	tt := fetchThermostats(ecobee.Selection{
+		SelectionType:  "registered",
+		IncludeSensors: true,
+	})
+
+	type sensor struct {
+		ThermostatID string   `json:"thermostatId"`
+		ID           string   `json:"id"`
+		Name         string   `json:"name"`
+		Type         string   `json:"type"`
+		Capabilities []string `json:"capabilities"`
+		InUse        bool     `json:"inUse"`
+	}
+	list := []sensor{}
+	var rows [][]string
+	for _, t := range tt {
+		for _, s := range t.RemoteSensors {
+			caps := make([]string, 0, len(s.Capability))
+			for _, c := range s.Capability {
+				caps = append(caps, c.Type)
+			}
+			list = append(list, sensor{t.Identifier, s.ID, s.Name, s.Type, caps, s.InUse})
+			rows = append(rows, []string{t.Identifier, s.ID, s.Name, s.Type, strings.Join(caps, ","), fmt.Sprint(s.InUse)})
+		}
+	}
+	if *sensorsJSON {
+		printJSON(list)
+		return
+	}
+	printTable([]string{"THERMOSTAT", "ID", "NAME", "TYPE", "CAPABILITIES", "IN USE"}, rows)
+}
+
+// redactedKeys are the keys of thermostat object fields holding personal
+// details, which dump replaces so its output can be shared in bug reports.
+var redactedKeys = map[string]bool{
+	"streetAddress":  true,
+	"city":           true,
+	"postalCode":     true,
+	"mapCoordinates": true,
+	"phone":          true,
+	"phoneNumbers":   true,
+	"email":          true,
+	"emailAddresses": true,
+	"userAccessCode": true,
+}
+
+// dump prints the raw thermostat objects matching the selection given on
+// the command line.
+func dump() {
+	sel := ecobee.Selection{SelectionType: *dumpType, SelectionMatch: *dumpMatch}
+	for _, obj := range *dumpInclude {
+		if obj == "" {
+			fatal(errors.New("empty thermostat object name"))
+		}
+		f := reflect.ValueOf(&sel).Elem().FieldByName("Include" + strings.ToUpper(obj[:1]) + obj[1:])
+		if !f.IsValid() || f.Kind() != reflect.Bool {
+			fatal(fmt.Errorf("unknown thermostat object %q", obj))
+		}
+		f.SetBool(true)
+	}
+
+	list := make([]interface{}, 0)
+	for _, t := range fetchThermostats(sel) {
+		var v interface{}
+		if err := json.Unmarshal(t.Raw, &v); err != nil {
+			fatal(err)
+		}
+		list = append(list, redact(v))
+	}
+	printJSON(list)
+}
+
+// redact replaces the values of redactedKeys anywhere within v, a decoded
+// JSON value.
+func redact(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			if redactedKeys[k] {
+				x[k] = "REDACTED"
+			} else {
+				x[k] = redact(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = redact(e)
+		}
+	}
+	return v
+}
+
+// fetchThermostats gets the thermostats matching sel, within
+// --scrape.timeout if one is set.
+func fetchThermostats(sel ecobee.Selection) []client.Thermostat {
+	ctx := context.Background()
+	if *scrapeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *scrapeTimeout)
+		defer cancel()
+	}
+	tt, err := newClient().GetThermostats(ctx, sel)
+	if err != nil {
+		fatal(err)
+	}
+	return tt
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatal(err)
+	}
+}
+
+func printTable(header []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		fatal(err)
+	}
+}
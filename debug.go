@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// lastResponse keeps the most recent object the API returned for each
+// thermostat and serves them, redacted, on /debug/last-response.
+type lastResponse struct {
+	mu          sync.Mutex
+	thermostats map[string]fetchedThermostat
+}
+
+type fetchedThermostat struct {
+	Fetched    time.Time   `json:"fetched"`
+	Thermostat interface{} `json:"thermostat"`
+}
+
+func newLastResponse() *lastResponse {
+	return &lastResponse{thermostats: map[string]fetchedThermostat{}}
+}
+
+// Middleware is a client.Middleware that records successful responses to
+// thermostat requests.
+func (l *lastResponse) Middleware(next http.RoundTripper) http.RoundTripper {
+	return client.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil || !strings.HasSuffix(req.URL.Path, "/1/thermostat") || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		l.record(body)
+		return resp, nil
+	})
+}
+
+func (l *lastResponse) record(body []byte) {
+	var r struct {
+		ThermostatList []map[string]interface{} `json:"thermostatList"`
+	}
+	if json.Unmarshal(body, &r) != nil {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, t := range r.ThermostatList {
+		if id, ok := t["identifier"].(string); ok {
+			l.thermostats[id] = fetchedThermostat{Fetched: now, Thermostat: redact(t)}
+		}
+	}
+}
+
+func (l *lastResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	ids := make([]string, 0, len(l.thermostats))
+	for id := range l.thermostats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]fetchedThermostat, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, l.thermostats[id])
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	l.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dedupHandler suppresses warnings and errors identical to one logged less
+// than interval ago, so an outage doesn't log the same failure on every
+// scrape. Once interval has passed, the next occurrence is logged again
+// with the number suppressed in between.
+type dedupHandler struct {
+	slog.Handler
+	state  *dedupState
+	prefix string // attrs and groups added with WithAttrs and WithGroup
+}
+
+type dedupState struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+type dedupEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// volatileAttrs differ between otherwise identical records.
+var volatileAttrs = map[string]bool{"collection_id": true, "duration": true}
+
+func newDedupHandler(h slog.Handler, interval time.Duration) slog.Handler {
+	return dedupHandler{Handler: h, state: &dedupState{interval: interval, entries: map[string]*dedupEntry{}}}
+}
+
+func (h dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s|%s|%s", r.Level, h.prefix, r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		if !volatileAttrs[a.Key] {
+			fmt.Fprintf(&key, "|%s=%v", a.Key, a.Value)
+		}
+		return true
+	})
+
+	s := h.state
+	s.mu.Lock()
+	now := time.Now()
+	e, ok := s.entries[key.String()]
+	if ok && now.Sub(e.logged) < s.interval {
+		e.suppressed++
+		s.mu.Unlock()
+		return nil
+	}
+	suppressed := 0
+	if ok {
+		suppressed = e.suppressed
+	}
+	s.entries[key.String()] = &dedupEntry{logged: now}
+	for k, e := range s.entries {
+		if now.Sub(e.logged) >= s.interval && e.suppressed == 0 {
+			delete(s.entries, k)
+		}
+	}
+	s.mu.Unlock()
+
+	if suppressed > 0 {
+		r = r.Clone()
+		r.Message = fmt.Sprintf("%s (still failing, %d occurrences suppressed)", r.Message, suppressed)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := h.prefix
+	for _, a := range attrs {
+		prefix += fmt.Sprintf("%s=%v;", a.Key, a.Value)
+	}
+	return dedupHandler{h.Handler.WithAttrs(attrs), h.state, prefix}
+}
+
+func (h dedupHandler) WithGroup(name string) slog.Handler {
+	return dedupHandler{h.Handler.WithGroup(name), h.state, h.prefix + name + "."}
+}
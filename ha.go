@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/joeshaw/ecobee-exporter/internal/leader"
+	"github.com/joeshaw/ecobee-exporter/pkg/poller"
+	"github.com/joeshaw/ecobee-exporter/pkg/sinks"
+)
+
+// ecobeeGatherer returns a gatherer of the ecobee metrics from col. With
+// leader election, standbys gather the leader's latest published metrics
+// instead of calling the API.
+func ecobeeGatherer(ctx context.Context, col prometheus.Collector, e *leader.Elector) prometheus.Gatherer {
+	if e != nil && !e.IsLeader() {
+		return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return latest(ctx, e)
+		})
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(col)
+	return reg
+}
+
+// publish returns a poll handler with which the leader publishes the
+// metrics of each of its polls for the standbys, whether or not it is
+// scraped itself.
+func publish(ctx context.Context, e *leader.Elector) func(*poller.Poller) {
+	return func(p *poller.Poller) {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(p)
+		mfs, err := reg.Gather()
+		if err != nil {
+			slog.WarnContext(ctx, "error gathering metrics for standbys", "error", err)
+		}
+		var buf bytes.Buffer
+		if err := sinks.NewWriter(&buf).Write(ctx, mfs); err != nil {
+			slog.WarnContext(ctx, "error encoding metrics for standbys", "error", err)
+			return
+		}
+		if err := e.Publish(ctx, buf.Bytes()); err != nil {
+			slog.WarnContext(ctx, "error publishing metrics for standbys", "error", err)
+		}
+	}
+}
+
+// latest returns the metric families most recently published by the
+// leader.
+func latest(ctx context.Context, e *leader.Elector) ([]*dto.MetricFamily, error) {
+	b, err := e.Latest(ctx)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var p expfmt.TextParser
+	m, err := p.TextToMetricFamilies(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	mfs := make([]*dto.MetricFamily, 0, len(m))
+	for _, mf := range m {
+		mfs = append(mfs, mf)
+	}
+	sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+	return mfs, nil
+}
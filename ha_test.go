@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/joeshaw/ecobee-exporter/internal/leader"
+	"github.com/joeshaw/ecobee-exporter/pkg/poller"
+)
+
+// collections is a collector of a constant temperature that counts its
+// collections.
+type collections struct {
+	desc *prometheus.Desc
+	n    atomic.Int32
+}
+
+func (c *collections) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *collections) Collect(ch chan<- prometheus.Metric) {
+	c.n.Add(1)
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 70.5, "1")
+}
+
+func TestStandbyServesLeaderPoll(t *testing.T) {
+	srv := miniredis.RunT(t)
+	elector := func() *leader.Elector {
+		return leader.New(redis.NewClient(&redis.Options{Addr: srv.Addr()}), "ecobee-exporter", 15*time.Second)
+	}
+	desc := prometheus.NewDesc("ecobee_temperature", "temperature", []string{"thermostat_id"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the leader polls and is never scraped
+	le := elector()
+	done := make(chan struct{})
+	go func() {
+		le.Run(ctx)
+		close(done)
+	}()
+	defer func() { <-done }()
+	defer cancel()
+	for !le.IsLeader() {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	polled := &collections{desc: desc}
+	p := poller.Start(polled, poller.Schedule{Interval: time.Hour}, le.IsLeader, poller.WithPollHandler(publish(ctx, le)))
+	defer p.Close(context.Background())
+	<-p.Polled()
+
+	// the standby is scraped, but doesn't collect
+	standby := &collections{desc: desc}
+	mfs, err := ecobeeGatherer(ctx, standby, elector()).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "ecobee_temperature" || len(mfs[0].Metric) != 1 || mfs[0].Metric[0].GetGauge().GetValue() != 70.5 {
+		t.Errorf("standby served %v, want the leader's poll", mfs)
+	}
+	if n := standby.n.Load(); n != 0 {
+		t.Errorf("standby collected %d times, want 0", n)
+	}
+	if n := polled.n.Load(); n != 1 {
+		t.Errorf("leader collected %d times, want 1", n)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/internal/leader"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/sinks"
+)
+
+// healthReason explains why the exporter isn't fully healthy.
+type healthReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// healthReport is the JSON response of /healthz.
+type healthReport struct {
+	Status      string         `json:"status"`
+	LastSuccess *time.Time     `json:"lastSuccess,omitempty"`
+	Reasons     []healthReason `json:"reasons"`
+}
+
+// health tracks the collection outcomes of each account and serves
+// /healthz. The exporter is unhealthy, with status 503, when authorization
+// fails or no collection has succeeded within staleAfter for any account,
+// and degraded, with status 200, when the API quota is exhausted or a sink
+// is failing. Standbys don't collect, so they are never stale; a replica
+// that becomes the leader is given staleAfter from then to collect.
+type health struct {
+	staleAfter time.Duration
+	started    time.Time
+	runner     *sinks.Runner
+	elector    *leader.Elector
+
+	mu       sync.Mutex
+	accounts []*accountHealth
+}
+
+// accountHealth is the collection outcome of one account.
+type accountHealth struct {
+	name string // empty for the account of the flags
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     *collector.Error
+}
+
+func newHealth(staleAfter time.Duration) *health {
+	return &health{staleAfter: staleAfter, started: time.Now()}
+}
+
+// account returns the tracker of the account name, whose handlers are to
+// be added to its collector.
+func (h *health) account(name string) *accountHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a := &accountHealth{name: name}
+	h.accounts = append(h.accounts, a)
+	return a
+}
+
+// error is a collector error handler.
+func (a *accountHealth) error(err *collector.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastErr = err
+}
+
+// result is a collector result handler.
+func (a *accountHealth) result(r collector.Result) {
+	if r.Partial {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastSuccess = r.Start.Add(r.Duration)
+	a.lastErr = nil
+}
+
+func (h *health) report() (healthReport, int) {
+	h.mu.Lock()
+	accounts := h.accounts
+	h.mu.Unlock()
+
+	report := healthReport{Status: "ok", Reasons: []healthReason{}}
+	code := http.StatusOK
+	unhealthy := func(r healthReason) {
+		report.Status, code = "unhealthy", http.StatusServiceUnavailable
+		report.Reasons = append(report.Reasons, r)
+	}
+	degraded := func(r healthReason) {
+		if report.Status == "ok" {
+			report.Status = "degraded"
+		}
+		report.Reasons = append(report.Reasons, r)
+	}
+
+	standby := h.elector != nil && !h.elector.IsLeader()
+	// staleness is measured from startup, or from when this replica
+	// became the leader, until a collection succeeds
+	start := h.started
+	if h.elector != nil && h.elector.Since().After(start) {
+		start = h.elector.Since()
+	}
+	for _, a := range accounts {
+		a.mu.Lock()
+		lastSuccess, lastErr := a.lastSuccess, a.lastErr
+		a.mu.Unlock()
+
+		prefix := ""
+		if a.name != "" {
+			prefix = "account " + a.name + ": "
+		}
+		// the report's last success is that of the account that has gone
+		// longest without one
+		if !lastSuccess.IsZero() && (report.LastSuccess == nil || lastSuccess.Before(*report.LastSuccess)) {
+			report.LastSuccess = &lastSuccess
+		}
+		if lastErr != nil {
+			var apiErr *client.Error
+			switch {
+			case authStatus(lastErr) == "failed":
+				unhealthy(healthReason{"auth_failed", prefix + lastErr.Error()})
+			case errors.As(lastErr, &apiErr) && apiErr.HTTPStatus == http.StatusTooManyRequests:
+				degraded(healthReason{"api_quota_exceeded", prefix + lastErr.Error()})
+			}
+		}
+		if standby {
+			continue
+		}
+		since := lastSuccess
+		if since.Before(start) {
+			since = start
+		}
+		if age := time.Since(since); age > h.staleAfter {
+			msg := fmt.Sprintf("%sno successful collection for %s", prefix, age.Round(time.Second))
+			if lastErr != nil {
+				msg += ", last error: " + lastErr.Error()
+			}
+			unhealthy(healthReason{"stale", msg})
+		}
+	}
+	if h.runner != nil {
+		if _, err := h.runner.Status(); err != nil {
+			degraded(healthReason{"sink_failing", err.Error()})
+		}
+	}
+	return report, code
+}
+
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, code := h.report()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// healthcheck queries the /healthz endpoint of the exporter listening on
+// --listen-address, or at url if given, printing its status, and exits
+// with a non-zero status unless the exporter is healthy or degraded. It
+// lets container HEALTHCHECKs work in images without curl.
+func healthcheck(url string, timeout time.Duration) {
+	if url == "" {
+		host, port, err := net.SplitHostPort(*addr)
+		if err != nil {
+			fatal(fmt.Errorf("invalid --listen-address: %v", err))
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		url = "http://" + net.JoinHostPort(host, port) + "/healthz"
+	}
+	c := &http.Client{Timeout: timeout}
+	resp, err := c.Get(url)
+	if err != nil {
+		fatal(fmt.Errorf("health check failed: %v", err))
+	}
+	defer resp.Body.Close()
+	var report healthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fatal(fmt.Errorf("health check failed: %s: invalid response: %v", resp.Status, err))
+	}
+	fmt.Println(report.Status)
+	for _, r := range report.Reasons {
+		fmt.Printf("%s: %s\n", r.Code, r.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
+	}
+}
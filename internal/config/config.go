@@ -0,0 +1,313 @@
+// Package config loads the exporter's YAML configuration file.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+)
+
+// Config is the top-level structure of the configuration file.
+type Config struct {
+	// Aliases replace the names ecobee reports.
+	Aliases Aliases `yaml:"aliases"`
+
+	// Zones groups sensors into zones, such as the floors of a house,
+	// keyed by zone name. Sensors are listed as for Aliases.Sensors.
+	Zones map[string][]string `yaml:"zones"`
+
+	// LabelExtraction derives additional labels from the values of
+	// existing ones, such as thermostat and sensor names.
+	LabelExtraction []LabelExtraction `yaml:"label_extraction"`
+
+	// Transforms are applied, in order, to gathered metrics before they
+	// are exposed.
+	Transforms []Transform `yaml:"transforms"`
+
+	// Metrics defines additional per-thermostat metrics read from
+	// fields of the thermostat object.
+	Metrics []Metric `yaml:"metrics"`
+
+	// Shard assigns this exporter a fixed set of thermostats when a fleet
+	// is split across several exporters.
+	Shard *Shard `yaml:"shard"`
+
+	// Accounts are the ecobee accounts to collect instead of the one of
+	// --appkey and --cachefile, such as those of several customers.
+	Accounts []Account `yaml:"accounts"`
+
+	// Flags sets command line flags, keyed by their names without the
+	// leading dashes, such as "poll.interval", unless they are given on
+	// the command line or in the environment.
+	Flags map[string]FlagValue `yaml:"flags"`
+}
+
+// FlagValue is the value of a flag: a single value, or a list of values
+// for a flag that can be repeated.
+type FlagValue []string
+
+// UnmarshalYAML accepts a scalar as a list of one value.
+func (v *FlagValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var one string
+	if err := unmarshal(&one); err == nil {
+		*v = FlagValue{one}
+		return nil
+	}
+	return unmarshal((*[]string)(v))
+}
+
+// Aliases are stable names for thermostats and sensors, so that renames in
+// the ecobee app don't break queries and dashboards keyed on names.
+type Aliases struct {
+	// Sensors maps sensor identifiers, such as "rs:100", to names.
+	// Sensor identifiers repeat across thermostats, so a key may be
+	// prefixed with a thermostat identifier and a slash, such as
+	// "511863000001/rs:100", to alias the sensor of just that thermostat.
+	Sensors map[string]string `yaml:"sensors"`
+
+	// Thermostats maps thermostat identifiers to names. The sensor
+	// built into a thermostat keeps the thermostat's reported name
+	// unless aliased under Sensors, as "<thermostat>/ei:0".
+	Thermostats map[string]string `yaml:"thermostats"`
+}
+
+// Shard is one exporter's share of the thermostats.
+type Shard struct {
+	// Name identifies the shard in the exporter's shard metric.
+	Name string `yaml:"name"`
+
+	// Thermostats are the identifiers of the thermostats this exporter
+	// collects. Others are ignored.
+	Thermostats []string `yaml:"thermostats"`
+}
+
+// Account is one of several ecobee accounts collected by the exporter.
+type Account struct {
+	// Name identifies the account in the account label of its metrics
+	// and in its metrics path, /metrics/<name>.
+	Name string `yaml:"name"`
+
+	// AppKey is the application key to authorize with. It defaults to
+	// --appkey.
+	AppKey string `yaml:"appkey"`
+
+	// CacheFile is where the account's authorization tokens are kept.
+	// Each account needs its own.
+	CacheFile string `yaml:"cachefile"`
+
+	// BearerToken, if set, must be sent as a bearer token to scrape the
+	// account's metrics path.
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// Metric declares a metric whose value is read from the thermostat object.
+type Metric struct {
+	// Name is appended to the metric prefix.
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+
+	// Type is "gauge" (the default) or "counter".
+	Type string `yaml:"type"`
+
+	// Path is the location of the field in the thermostat object, for
+	// example "runtime.desiredHumidity".
+	Path string `yaml:"path"`
+
+	// Scale multiplies the field value, for example 0.1 for the API's
+	// tenths of a degree. It defaults to 1.
+	Scale float64 `yaml:"scale"`
+
+	// Temperature marks a metric whose scaled value is in degrees
+	// Fahrenheit, so that --units converts it along with the
+	// exporter's own temperature metrics.
+	Temperature bool `yaml:"temperature"`
+}
+
+// Transform configures one step of the metric pipeline.
+type Transform struct {
+	// Type selects the transform: "drop", "scale", "round" or "labels".
+	Type string `yaml:"type"`
+
+	// Match is a regular expression, anchored at both ends, selecting
+	// the metric names the transform applies to. An empty Match selects
+	// every metric.
+	Match string `yaml:"match"`
+
+	// Factor and Offset are used by "scale", which replaces each value v
+	// with v*Factor + Offset. A missing factor is treated as 1.
+	Factor *float64 `yaml:"factor"`
+	Offset float64  `yaml:"offset"`
+
+	// Precision is the number of decimal places kept by "round".
+	Precision int `yaml:"precision"`
+
+	// Labels are added to every matching metric by "labels", replacing
+	// any existing labels with the same name.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// LabelExtraction adds a label for every named capture group of Regex
+// when it matches the value of the Source label.
+type LabelExtraction struct {
+	// Source is the label to match against, typically
+	// "thermostat_name" or "sensor_name".
+	Source string `yaml:"source"`
+
+	// Regex is anchored at both ends. Each named group becomes a label
+	// of the same name.
+	Regex string `yaml:"regex"`
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses the contents of a configuration file. Unknown fields are an
+// error so that typos don't go unnoticed.
+func Parse(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Transformers returns the metric pipeline described by the configuration:
+// aliases, zones, label extraction and then the configured transforms.
+// Aliases come first so that labels are extracted from the stable names,
+// and zones and extracted labels come before the transforms so that
+// transforms can act on them.
+func (cfg *Config) Transformers() ([]pipeline.Transformer, error) {
+	var ts []pipeline.Transformer
+	if len(cfg.Aliases.Thermostats) > 0 {
+		ts = append(ts, pipeline.Alias("thermostat_name", []string{"thermostat_id"}, cfg.Aliases.Thermostats))
+	}
+	if len(cfg.Aliases.Sensors) > 0 {
+		// aliases for any thermostat first, so that those for a
+		// specific one win
+		shared, specific := make(map[string]string), make(map[string]string)
+		for k, name := range cfg.Aliases.Sensors {
+			if strings.Contains(k, "/") {
+				specific[k] = name
+			} else {
+				shared[k] = name
+			}
+		}
+		ts = append(ts,
+			pipeline.Alias("sensor_name", []string{"sensor_id"}, shared),
+			pipeline.Alias("sensor_name", []string{"thermostat_id", "sensor_id"}, specific),
+		)
+	}
+	if len(cfg.Zones) > 0 {
+		zones := make(map[string]string)
+		for zone, sensors := range cfg.Zones {
+			for _, s := range sensors {
+				if other, ok := zones[s]; ok {
+					return nil, fmt.Errorf("zones: sensor %s is in both %s and %s", s, other, zone)
+				}
+				zones[s] = zone
+			}
+		}
+		ts = append(ts, pipeline.Zones("ecobee", zones))
+	}
+	for i, c := range cfg.LabelExtraction {
+		if c.Source == "" {
+			return nil, fmt.Errorf("label extraction %d: missing source", i)
+		}
+		re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("label extraction %d: invalid regex: %v", i, err)
+		}
+		ts = append(ts, pipeline.Extract(c.Source, re))
+	}
+	for i, c := range cfg.Transforms {
+		match := c.Match
+		if match == "" {
+			match = ".*"
+		}
+		re, err := regexp.Compile("^(?:" + match + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: invalid match: %v", i, err)
+		}
+		switch c.Type {
+		case "drop":
+			ts = append(ts, pipeline.Drop(re))
+		case "scale":
+			factor := 1.0
+			if c.Factor != nil {
+				factor = *c.Factor
+			}
+			ts = append(ts, pipeline.Scale(re, factor, c.Offset))
+		case "round":
+			ts = append(ts, pipeline.Round(re, c.Precision))
+		case "labels":
+			ts = append(ts, pipeline.Labels(re, c.Labels))
+		default:
+			return nil, fmt.Errorf("transform %d: unknown type %q", i, c.Type)
+		}
+	}
+	return ts, nil
+}
+
+// Definitions returns the collector definitions of the configured metrics,
+// for a collector with the metric prefix.
+func (cfg *Config) Definitions(prefix string) ([]collector.Definition, error) {
+	defs := make([]collector.Definition, 0, len(cfg.Metrics))
+	seen := make(map[string]bool, len(cfg.Metrics))
+	for i, m := range cfg.Metrics {
+		d := collector.Definition{
+			Name:  m.Name,
+			Help:  m.Help,
+			Path:  m.Path,
+			Scale: m.Scale,
+		}
+		switch m.Type {
+		case "", "gauge":
+			d.Type = prometheus.GaugeValue
+		case "counter":
+			d.Type = prometheus.CounterValue
+		default:
+			return nil, fmt.Errorf("metric %d: unknown type %q", i, m.Type)
+		}
+		if d.Help == "" {
+			d.Help = fmt.Sprintf("value of thermostat field %s", m.Path)
+		}
+		if err := d.Validate(prefix); err != nil {
+			return nil, fmt.Errorf("metric %d: %v", i, err)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("metric %d: duplicate name %s", i, d.Name)
+		}
+		seen[d.Name] = true
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// TemperatureMetrics returns the names of the configured metrics marked as
+// temperatures.
+func (cfg *Config) TemperatureMetrics() []string {
+	var names []string
+	for _, m := range cfg.Metrics {
+		if m.Temperature {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
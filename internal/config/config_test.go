@@ -0,0 +1,376 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want *Config
+		err  bool
+	}{
+		{
+			name: "empty",
+			yaml: ``,
+			want: &Config{},
+		},
+		{
+			name: "aliases and zones",
+			yaml: `
+aliases:
+  thermostats:
+    "511863000001": Main
+  sensors:
+    rs:100: Hall
+    511863000001/ei:0: Living room
+zones:
+  downstairs: [ei:0, rs:100]
+`,
+			want: &Config{
+				Aliases: Aliases{
+					Thermostats: map[string]string{"511863000001": "Main"},
+					Sensors:     map[string]string{"rs:100": "Hall", "511863000001/ei:0": "Living room"},
+				},
+				Zones: map[string][]string{"downstairs": {"ei:0", "rs:100"}},
+			},
+		},
+		{
+			name: "flags",
+			yaml: `
+flags:
+  poll.interval: 5m
+  api.intervals: true
+  collector.disable: [weather, alerts]
+`,
+			want: &Config{
+				Flags: map[string]FlagValue{
+					"poll.interval":     {"5m"},
+					"api.intervals":     {"true"},
+					"collector.disable": {"weather", "alerts"},
+				},
+			},
+		},
+		{
+			name: "shard and accounts",
+			yaml: `
+shard:
+  name: east
+  thermostats: ["1", "2"]
+accounts:
+  - name: home
+    cachefile: /var/lib/ecobee/home.json
+    bearer_token: secret
+`,
+			want: &Config{
+				Shard:    &Shard{Name: "east", Thermostats: []string{"1", "2"}},
+				Accounts: []Account{{Name: "home", CacheFile: "/var/lib/ecobee/home.json", BearerToken: "secret"}},
+			},
+		},
+		{
+			name: "unknown field",
+			yaml: "alias:\n  sensors: {}\n",
+			err:  true,
+		},
+		{
+			name: "malformed",
+			yaml: "zones: [",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.yaml))
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("got %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+// sensors returns the temperature and humidity families of the built-in
+// sensor of thermostat 1 and a remote sensor of it and of thermostat 2.
+func sensors() []*dto.MetricFamily {
+	family := func(name string, v float64) *dto.MetricFamily {
+		mf := &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_GAUGE.Enum()}
+		for _, s := range [][3]string{{"1", "Main Floor", "ei:0"}, {"1", "Main Floor", "rs:100"}, {"2", "Upstairs", "rs:100"}} {
+			mf.Metric = append(mf.Metric, &dto.Metric{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("sensor_id"), Value: proto.String(s[2])},
+					{Name: proto.String("sensor_name"), Value: proto.String(s[2])},
+					{Name: proto.String("thermostat_id"), Value: proto.String(s[0])},
+					{Name: proto.String("thermostat_name"), Value: proto.String(s[1])},
+				},
+				Gauge: &dto.Gauge{Value: proto.Float64(v)},
+			})
+		}
+		return mf
+	}
+	return []*dto.MetricFamily{family("ecobee_humidity", 40), family("ecobee_temperature", 70.25)}
+}
+
+// render returns a line for each gauge of mfs, in order.
+func render(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			var labels []string
+			for _, lp := range m.Label {
+				labels = append(labels, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+			}
+			lines = append(lines, fmt.Sprintf("%s{%s} %g", mf.GetName(), strings.Join(labels, ","), m.GetGauge().GetValue()))
+		}
+	}
+	return lines
+}
+
+func TestTransformers(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+		err  string
+	}{
+		{
+			name: "none",
+			want: render(sensors()),
+		},
+		{
+			name: "aliases",
+			yaml: `
+aliases:
+  thermostats:
+    "2": Attic
+  sensors:
+    rs:100: Hall
+    2/rs:100: Bedroom
+`,
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="ei:0",thermostat_id="1",thermostat_name="Main Floor"} 40`,
+				`ecobee_humidity{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1",thermostat_name="Main Floor"} 40`,
+				`ecobee_humidity{sensor_id="rs:100",sensor_name="Bedroom",thermostat_id="2",thermostat_name="Attic"} 40`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="ei:0",thermostat_id="1",thermostat_name="Main Floor"} 70.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1",thermostat_name="Main Floor"} 70.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Bedroom",thermostat_id="2",thermostat_name="Attic"} 70.25`,
+			},
+		},
+		{
+			name: "label extraction and transforms",
+			yaml: `
+label_extraction:
+  - source: thermostat_name
+    regex: (?P<floor>\w+)( Floor)?
+transforms:
+  - type: drop
+    match: ecobee_humidity
+  - type: scale
+    match: ecobee_temp.*
+    factor: 2
+    offset: -100
+  - type: round
+    precision: 0
+  - type: labels
+    match: ecobee_temperature
+    labels:
+      site: cabin
+`,
+			want: []string{
+				`ecobee_temperature{floor="Main",sensor_id="ei:0",sensor_name="ei:0",site="cabin",thermostat_id="1",thermostat_name="Main Floor"} 41`,
+				`ecobee_temperature{floor="Main",sensor_id="rs:100",sensor_name="rs:100",site="cabin",thermostat_id="1",thermostat_name="Main Floor"} 41`,
+				`ecobee_temperature{floor="Upstairs",sensor_id="rs:100",sensor_name="rs:100",site="cabin",thermostat_id="2",thermostat_name="Upstairs"} 41`,
+			},
+		},
+		{
+			name: "zones",
+			yaml: `
+zones:
+  down: [1/ei:0, 1/rs:100]
+transforms:
+  - type: drop
+    match: ecobee_(humidity|temperature)
+`,
+			want: []string{
+				`ecobee_zone_humidity{zone="down"} 40`,
+				`ecobee_zone_temperature{zone="down"} 70.25`,
+			},
+		},
+		{
+			name: "sensor in two zones",
+			yaml: "zones:\n  down: [rs:100]\n  up: [rs:100]\n",
+			err:  "zones: sensor rs:100 is in both",
+		},
+		{
+			name: "missing source",
+			yaml: "label_extraction:\n  - regex: (?P<floor>.*)\n",
+			err:  "label extraction 0: missing source",
+		},
+		{
+			name: "invalid regex",
+			yaml: "label_extraction:\n  - source: sensor_name\n    regex: (\n",
+			err:  "label extraction 0: invalid regex",
+		},
+		{
+			name: "invalid match",
+			yaml: "transforms:\n  - type: drop\n    match: (\n",
+			err:  "transform 0: invalid match",
+		},
+		{
+			name: "unknown type",
+			yaml: "transforms:\n  - type: drop\n  - type: rename\n",
+			err:  `transform 1: unknown type "rename"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts, err := cfg.Transformers()
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			mfs := sensors()
+			for _, tr := range ts {
+				mfs = tr.Transform(mfs)
+			}
+			if got := render(mfs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+		})
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []collector.Definition
+		err  string
+	}{
+		{
+			name: "none",
+			want: []collector.Definition{},
+		},
+		{
+			name: "gauge and counter",
+			yaml: `
+metrics:
+  - name: desired_humidity
+    help: humidity setpoint in percent
+    path: runtime.desiredHumidity
+  - name: forecast_temperature
+    path: weather.forecasts[0].temperature
+    scale: 0.1
+    temperature: true
+  - name: filter_runtime_seconds_total
+    type: counter
+    path: runtime.filterRuntime
+    scale: 60
+`,
+			want: []collector.Definition{
+				{Name: "desired_humidity", Help: "humidity setpoint in percent", Type: prometheus.GaugeValue, Path: "runtime.desiredHumidity"},
+				{Name: "forecast_temperature", Help: "value of thermostat field weather.forecasts[0].temperature", Type: prometheus.GaugeValue, Path: "weather.forecasts[0].temperature", Scale: 0.1},
+				{Name: "filter_runtime_seconds_total", Help: "value of thermostat field runtime.filterRuntime", Type: prometheus.CounterValue, Path: "runtime.filterRuntime", Scale: 60},
+			},
+		},
+		{
+			name: "unknown type",
+			yaml: "metrics:\n  - name: x\n    type: histogram\n    path: runtime.x\n",
+			err:  `metric 0: unknown type "histogram"`,
+		},
+		{
+			name: "missing name",
+			yaml: "metrics:\n  - name: x\n    path: runtime.x\n  - path: runtime.y\n",
+			err:  "metric 1: missing name",
+		},
+		{
+			name: "invalid path",
+			yaml: "metrics:\n  - name: x\n    path: runtime..x\n",
+			err:  "metric 0: metric x: invalid path element",
+		},
+		{
+			name: "invalid name",
+			yaml: "metrics:\n  - name: desired-humidity\n    path: runtime.desiredHumidity\n",
+			err:  "metric 0: metric desired-humidity: invalid name",
+		},
+		{
+			name: "built-in name",
+			yaml: "metrics:\n  - name: actual_temperature\n    path: runtime.actualTemperature\n",
+			err:  "metric 0: metric actual_temperature: name of a built-in metric",
+		},
+		{
+			name: "built-in counter name",
+			yaml: "metrics:\n  - name: scrape_errors_total\n    type: counter\n    path: runtime.x\n",
+			err:  "metric 0: metric scrape_errors_total: name of a built-in metric",
+		},
+		{
+			name: "duplicate name",
+			yaml: "metrics:\n  - name: x\n    path: runtime.x\n  - name: x\n    path: runtime.y\n",
+			err:  "metric 1: duplicate name x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defs, err := cfg.Definitions("ecobee")
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(defs, tt.want) {
+				t.Errorf("got %+v, want %+v", defs, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemperatureMetrics(t *testing.T) {
+	cfg, err := Parse([]byte(`
+metrics:
+  - name: desired_humidity
+    path: runtime.desiredHumidity
+  - name: forecast_temperature
+    path: weather.forecasts[0].temperature
+    temperature: true
+  - name: forecast_dewpoint
+    path: weather.forecasts[0].dewpoint
+    temperature: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cfg.TemperatureMetrics()
+	sort.Strings(got)
+	if want := []string{"forecast_dewpoint", "forecast_temperature"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
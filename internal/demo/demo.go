@@ -0,0 +1,498 @@
+// Package demo simulates a home, or a fleet of them, with ecobee thermostats
+// and remote sensors, so the exporter can serve plausible data without ecobee
+// credentials.
+package demo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+	"github.com/joeshaw/ecobee-exporter/pkg/mockapi"
+)
+
+// cycle is how long one heating or cooling cycle, on plus off, lasts.
+const cycle = 30 * time.Minute
+
+type sensor struct {
+	id, name   string
+	offset     float64 // degrees F relative to the thermostat
+	occupied   func(hour float64) bool
+	switchPlus bool // a Switch+ light switch rather than a remote sensor
+}
+
+type thermostat struct {
+	id, name  string
+	group     string
+	set       string
+	enrolled  bool // in the utility's demand response program
+	heatPump  bool
+	offset    float64
+	humidity  float64
+	sensors   []sensor
+	cycleSkew time.Duration
+}
+
+// Home is a simulated household. Its state is a pure function of the time
+// reported by its clock.
+type Home struct {
+	clock       clock.Clock
+	thermostats []thermostat
+	privileges  []client.Privilege
+}
+
+// between returns an occupancy schedule for the hours from from to to,
+// which may wrap around midnight.
+func between(from, to float64) func(float64) bool {
+	return func(h float64) bool {
+		if from < to {
+			return h >= from && h < to
+		}
+		return h >= from || h < to
+	}
+}
+
+// New returns a Home with two thermostats, each with a few remote sensors.
+func New(clk clock.Clock) *Home {
+	return &Home{
+		clock: clk,
+		thermostats: []thermostat{
+			{
+				id: "511863000001", name: "Main Floor", heatPump: true, humidity: 41,
+				sensors: []sensor{
+					{id: "rs:100", name: "Living Room", offset: 0.4, occupied: between(17, 22.5)},
+					{id: "rs:101", name: "Kitchen", offset: 1.1, occupied: between(7, 8.5)},
+					{id: "rs:102", name: "Office", offset: -0.7, occupied: between(9, 17)},
+					{id: "rs:103", name: "Hallway", offset: 0.2, occupied: between(6.5, 7), switchPlus: true},
+				},
+			},
+			{
+				id: "511863000002", name: "Upstairs", offset: 1.5, humidity: 37, cycleSkew: 11 * time.Minute,
+				sensors: []sensor{
+					{id: "rs:200", name: "Bedroom", offset: -1.2, occupied: between(22.5, 7)},
+					{id: "rs:201", name: "Nursery", offset: -0.4, occupied: between(19.5, 6.5)},
+				},
+			},
+		},
+	}
+}
+
+// NewFleet returns a Home with n thermostats of m remote sensors each, such
+// as a property manager's, grouped by building ten at a time and organized
+// into a management hierarchy of buildings and floors, with every other
+// thermostat in a demand response program, for measuring the exporter at
+// scale. Offsets, humidity, cycles and occupancy vary between thermostats
+// and sensors but are the same on every run.
+func NewFleet(clk clock.Clock, n, m int) *Home {
+	schedules := []func(float64) bool{
+		between(17, 22.5), between(7, 8.5), between(9, 17), between(22.5, 7), between(12, 13),
+	}
+	h := &Home{clock: clk, privileges: []client.Privilege{{UserName: "manager@example.com", SetPath: "/"}}}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("5118640%05d", i+1)
+		th := thermostat{
+			id:        id,
+			name:      fmt.Sprintf("Unit %d", i+1),
+			group:     fmt.Sprintf("Building %d", i/10+1),
+			set:       fmt.Sprintf("/Building %d/Floor %d", i/10+1, i%10/5+1),
+			enrolled:  i%2 == 0,
+			heatPump:  i%3 != 0,
+			offset:    jitter(id, time.Time{}) * 2,
+			humidity:  35 + 10*(jitter(id+"/rh", time.Time{})+1)/2,
+			cycleSkew: time.Duration(i) * cycle / time.Duration(n),
+		}
+		for j := 0; j < m; j++ {
+			sid := fmt.Sprintf("rs:%d", 100+j)
+			th.sensors = append(th.sensors, sensor{
+				id:       sid,
+				name:     fmt.Sprintf("Unit %d Room %d", i+1, j+1),
+				offset:   jitter(id+"/"+sid, time.Time{}) * 1.5,
+				occupied: schedules[(i+j)%len(schedules)],
+			})
+		}
+		h.thermostats = append(h.thermostats, th)
+	}
+	return h
+}
+
+// hourOfDay returns the local time of day at t in fractional hours.
+func hourOfDay(t time.Time) float64 {
+	return float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+}
+
+// outdoor returns the outdoor temperature in degrees F, coldest before dawn
+// and warmest mid-afternoon.
+func outdoor(t time.Time) float64 {
+	return 38 + 12*math.Sin(2*math.Pi*(hourOfDay(t)-9)/24)
+}
+
+// setpoints returns the scheduled heat and cool setpoints in degrees F.
+func setpoints(t time.Time) (heat, cool float64) {
+	if h := hourOfDay(t); h >= 6 && h < 22 {
+		return 69, 76
+	}
+	return 63, 80
+}
+
+// jitter returns a repeatable pseudo-random value in [-1, 1) for key at the
+// five-minute interval containing t.
+func jitter(key string, t time.Time) float64 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%d", key, t.Unix()/300)
+	return float64(h.Sum32())/float64(math.MaxUint32)*2 - 1
+}
+
+// peakEvent returns the demand response event that the utility schedules
+// every afternoon for enrolled thermostats, as of t.
+func peakEvent(t time.Time) ecobee.Event {
+	return ecobee.Event{
+		Type:      "demandResponse",
+		Name:      "Peak Saver",
+		Running:   between(16, 19)(hourOfDay(t)),
+		StartDate: t.Format("2006-01-02"),
+		StartTime: "16:00:00",
+		EndDate:   t.Format("2006-01-02"),
+		EndTime:   "19:00:00",
+	}
+}
+
+// state is the simulated condition of a thermostat at an instant.
+type state struct {
+	temperature float64
+	humidity    float64
+	heat, cool  float64
+	equipment   []string
+}
+
+func (th *thermostat) state(t time.Time) state {
+	heat, cool := setpoints(t)
+	out := outdoor(t)
+
+	// The further the outdoor temperature is from the setpoint, the
+	// larger the share of each cycle the equipment runs, and the indoor
+	// temperature swings a degree around the setpoint as it does.
+	phase := float64(t.Add(th.cycleSkew).UnixNano()%int64(cycle)) / float64(cycle)
+	var duty float64
+	var equipment []string
+	target := (heat + cool) / 2
+	switch {
+	case out < heat:
+		duty = math.Min(0.9, (heat-out)/40)
+		target = heat
+		if phase < duty {
+			equipment = append(equipment, "fan")
+			if th.heatPump {
+				equipment = append(equipment, "heatPump")
+				if out < 25 {
+					equipment = append(equipment, "auxHeat1")
+				}
+			} else {
+				equipment = append(equipment, "auxHeat1")
+			}
+		}
+	case out > cool:
+		duty = math.Min(0.9, (out-cool)/25)
+		target = cool
+		if phase < duty {
+			equipment = append(equipment, "compCool1", "fan")
+		}
+	}
+	swing := 0.5
+	if duty > 0 {
+		if phase < duty {
+			swing = phase / duty
+		} else {
+			swing = 1 - (phase-duty)/(1-duty)
+		}
+		if out > cool {
+			swing = 1 - swing
+		}
+	}
+
+	return state{
+		temperature: target - 0.5 + swing + th.offset + 0.2*jitter(th.id, t),
+		humidity:    th.humidity + 4*math.Sin(2*math.Pi*hourOfDay(t)/24) + jitter(th.id+"/rh", t),
+		heat:        heat,
+		cool:        cool,
+		equipment:   equipment,
+	}
+}
+
+// filterChanged returns the day the filter was last changed as of t, a
+// different number of days ago, up to two weeks, for each thermostat.
+func (th *thermostat) filterChanged(t time.Time) time.Time {
+	days := int(7 * (jitter(th.id+"/filter", time.Time{}) + 1))
+	y, m, d := t.Local().AddDate(0, 0, -days).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// history returns the equipment history of the thermostat as of now, for
+// the runtime report.
+func (th *thermostat) history(now time.Time) func(time.Time) ([]string, bool) {
+	return func(t time.Time) ([]string, bool) {
+		if t.After(now) {
+			return nil, false
+		}
+		return th.state(t).equipment, true
+	}
+}
+
+// readings returns the temperatures and humidity of the thermostat at the
+// end of the five-minute interval starting at t, for the runtime report.
+func (th *thermostat) readings(t time.Time) map[string]float64 {
+	end := t.Add(5 * time.Minute)
+	st := th.state(end)
+	return map[string]float64{
+		"zoneAveTemp":  st.temperature,
+		"zoneHumidity": math.Round(st.humidity),
+		"zoneHeatTemp": st.heat,
+		"zoneCoolTemp": st.cool,
+		"outdoorTemp":  outdoor(end),
+	}
+}
+
+// extendedRuntime returns the extended runtime of the thermostat as of
+// now: its state at the ends of the last three 5-minute intervals, and how
+// long its equipment ran in each of them.
+func (th *thermostat) extendedRuntime(now time.Time) ecobee.ExtendedRuntime {
+	last := now.UTC().Truncate(5 * time.Minute)
+	er := ecobee.ExtendedRuntime{
+		LastReadingTimestamp: last.Format("2006-01-02 15:04:05"),
+		RuntimeDate:          last.Format("2006-01-02"),
+		RuntimeInterval:      last.Hour()*12 + last.Minute()/5,
+	}
+	for i := 2; i >= 0; i-- {
+		end := last.Add(-time.Duration(i) * 5 * time.Minute)
+		st := th.state(end)
+		er.ActualTemperature = append(er.ActualTemperature, tenths(st.temperature))
+		er.ActualHumidity = append(er.ActualHumidity, int(math.Round(st.humidity)))
+		er.DesiredHeat = append(er.DesiredHeat, tenths(st.heat))
+		er.DesiredCool = append(er.DesiredCool, tenths(st.cool))
+
+		// sample the equipment every 15 seconds of the interval
+		seconds := map[string]int{}
+		for t := end.Add(-5 * time.Minute); t.Before(end); t = t.Add(15 * time.Second) {
+			for _, e := range th.state(t).equipment {
+				seconds[e] += 15
+			}
+		}
+		er.HeatPump1 = append(er.HeatPump1, seconds["heatPump"])
+		er.HeatPump2 = append(er.HeatPump2, 0)
+		er.AuxHeat1 = append(er.AuxHeat1, seconds["auxHeat1"])
+		er.AuxHeat2 = append(er.AuxHeat2, 0)
+		er.AuxHeat3 = append(er.AuxHeat3, 0)
+		er.Cool1 = append(er.Cool1, seconds["compCool1"])
+		er.Cool2 = append(er.Cool2, 0)
+		er.Fan = append(er.Fan, seconds["fan"])
+		er.Humidifier = append(er.Humidifier, 0)
+		er.Dehumidifier = append(er.Dehumidifier, 0)
+		er.Economizer = append(er.Economizer, 0)
+		er.Ventilator = append(er.Ventilator, 0)
+	}
+	return er
+}
+
+func tenths(f float64) int {
+	return int(math.Round(f * 10))
+}
+
+// program is the schedule of every thermostat, matching setpoints: Home
+// from 6:00 to 22:00 and Sleep overnight.
+var program = func() ecobee.Program {
+	p := ecobee.Program{
+		Climates: []ecobee.Climate{
+			{Name: "Home", ClimateRef: "home", IsOccupied: true, HeatTemp: 690, CoolTemp: 760},
+			{Name: "Sleep", ClimateRef: "sleep", IsOccupied: true, HeatTemp: 630, CoolTemp: 800},
+		},
+	}
+	for d := 0; d < 7; d++ {
+		day := make([]string, 48)
+		for i := range day {
+			day[i] = "sleep"
+			if i >= 12 && i < 44 {
+				day[i] = "home"
+			}
+		}
+		p.Schedule = append(p.Schedule, day)
+	}
+	return p
+}()
+
+// Fixtures returns the current state of the home's thermostats. Home
+// implements mockapi.Fixtures.
+func (h *Home) Fixtures() []mockapi.Fixture {
+	now := h.clock.Now()
+	fs := make([]mockapi.Fixture, 0, len(h.thermostats))
+	for _, th := range h.thermostats {
+		st := th.state(now)
+		prog := program
+		prog.CurrentClimateRef = "sleep"
+		if h := hourOfDay(now); h >= 6 && h < 22 {
+			prog.CurrentClimateRef = "home"
+		}
+		t := client.Thermostat{
+			Identifier:     th.id,
+			Name:           th.name,
+			ThermostatRev:  now.Truncate(time.Hour).UTC().Format("060102150405"),
+			IsRegistered:   true,
+			ModelNumber:    "athenaSmart",
+			Brand:          "ecobee",
+			ThermostatTime: now.Local().Format("2006-01-02 15:04:05"),
+			UtcTime:        now.UTC().Format("2006-01-02 15:04:05"),
+			Settings: client.Settings{
+				HvacMode:         "auto",
+				HeatRangeHigh:    790,
+				HeatRangeLow:     450,
+				CoolRangeHigh:    920,
+				CoolRangeLow:     650,
+				HeatCoolMinDelta: 50,
+
+				ColdTempAlert:        450,
+				ColdTempAlertEnabled: true,
+				HotTempAlert:         920,
+				HotTempAlertEnabled:  true,
+				HumidityHighAlert:    60,
+				HumidityLowAlert:     15,
+
+				BacklightOnIntensity:    10,
+				BacklightSleepIntensity: 4,
+			},
+			Audio: &client.Audio{
+				PlaybackVolume:    7,
+				MicrophoneEnabled: true,
+				SoundAlertVolume:  5,
+				VoiceEngines:      []client.VoiceEngine{{Name: "alexa", Enabled: true}},
+			},
+			Runtime: client.Runtime{
+				RuntimeRev:         now.Truncate(5 * time.Minute).UTC().Format("060102150405"),
+				Connected:          true,
+				LastStatusModified: now.Truncate(5 * time.Minute).UTC().Format("2006-01-02 15:04:05"),
+				ActualTemperature:  tenths(st.temperature),
+				RawTemperature:     tenths(st.temperature),
+				ActualHumidity:     int(math.Round(st.humidity)),
+				DesiredHeat:        tenths(st.heat),
+				DesiredCool:        tenths(st.cool),
+				DesiredFanMode:     "auto",
+			},
+			ExtendedRuntime: th.extendedRuntime(now),
+			Program:         prog,
+			Weather: ecobee.Weather{
+				Timestamp:      now.UTC().Format("2006-01-02 15:04:05"),
+				WeatherStation: "DEMO",
+				Forecasts: []ecobee.WeatherForecast{{
+					DateTime:         now.Local().Format("2006-01-02 15:04:05"),
+					Temperature:      tenths(outdoor(now)),
+					Pressure:         1016,
+					RelativeHumidity: 60,
+					WindSpeed:        7,
+					TempHigh:         tenths(50),
+					TempLow:          tenths(26),
+				}, {
+					DateTime:         now.Add(24 * time.Hour).Local().Format("2006-01-02 15:04:05"),
+					Temperature:      tenths(outdoor(now)),
+					Pressure:         1012,
+					RelativeHumidity: 70,
+					WindSpeed:        11,
+					TempHigh:         tenths(48),
+					TempLow:          tenths(29),
+				}},
+			},
+		}
+		t.RemoteSensors = append(t.RemoteSensors, ecobee.RemoteSensor{
+			ID: "ei:0", Name: th.name, Type: "thermostat", InUse: true,
+			Capability: []ecobee.RemoteSensorCapability{
+				{ID: "1", Type: "temperature", Value: strconv.Itoa(tenths(st.temperature))},
+				{ID: "2", Type: "humidity", Value: strconv.Itoa(int(math.Round(st.humidity)))},
+				{ID: "3", Type: "occupancy", Value: "false"},
+			},
+		})
+		for _, s := range th.sensors {
+			occupied := s.occupied(hourOfDay(now))
+			rs := ecobee.RemoteSensor{
+				ID: s.id, Name: s.name, Type: "ecobee3_remote_sensor", Code: strings.ToUpper(s.id[3:]), InUse: occupied,
+				Capability: []ecobee.RemoteSensorCapability{
+					{ID: "1", Type: "temperature", Value: strconv.Itoa(tenths(st.temperature + s.offset + 0.3*jitter(s.id, now)))},
+					{ID: "2", Type: "occupancy", Value: strconv.FormatBool(occupied)},
+				},
+			}
+			if s.switchPlus {
+				// daylight until 19:00, and the light when someone's in
+				lux := 0.0
+				if h := hourOfDay(now); h >= 7 && h < 19 {
+					lux = 250 + 50*jitter(s.id, now)
+				} else if occupied {
+					lux = 120
+				}
+				rs.Type, rs.Code, rs.InUse = "ecobee_switch_plus", "", false
+				rs.Capability = append(rs.Capability,
+					ecobee.RemoteSensorCapability{ID: "3", Type: "ambientLight", Value: strconv.Itoa(int(math.Round(lux)))},
+					ecobee.RemoteSensorCapability{ID: "4", Type: "relay", Value: strconv.FormatBool(occupied)},
+				)
+			}
+			t.RemoteSensors = append(t.RemoteSensors, rs)
+		}
+		if th.enrolled {
+			t.Events = append(t.Events, peakEvent(now))
+		}
+		t.NotificationSettings = &client.NotificationSettings{
+			Equipment: []client.EquipmentNotification{{
+				Type:              "hvac",
+				Enabled:           true,
+				FilterLastChanged: th.filterChanged(now).Format("2006-01-02"),
+				FilterLife:        3,
+				FilterLifeUnits:   "month",
+			}},
+		}
+		if th.heatPump {
+			// a whole-home humidifier
+			t.Settings.HasHumidifier, t.Settings.HumidifierMode = true, "auto"
+			t.Runtime.DesiredHumidity = 36
+
+			// the UV lamp was due when the filter was changed, and its
+			// reminder is waiting to be acknowledged
+			changed := th.filterChanged(now)
+			t.NotificationSettings.Equipment = append(t.NotificationSettings.Equipment, client.EquipmentNotification{
+				Type:              "uvLamp",
+				Enabled:           true,
+				FilterLastChanged: changed.AddDate(0, -12, 0).Format("2006-01-02"),
+				FilterLife:        12,
+				FilterLifeUnits:   "month",
+			})
+			t.Alerts = append(t.Alerts, client.Alert{
+				AlertNumber:      1004,
+				AlertType:        "reminder",
+				NotificationType: "uvLamp",
+				Severity:         "low",
+				Text:             "Time to replace your UV lamp.",
+				Date:             changed.Format("2006-01-02"),
+				Time:             "00:00",
+				Reminder:         true,
+			})
+		}
+		fs = append(fs, mockapi.Fixture{
+			Thermostat: t,
+			Equipment:  st.equipment,
+			Group:      th.group,
+			Set:        th.set,
+			History:    th.history(now),
+			Readings:   th.readings,
+		})
+	}
+	return fs
+}
+
+// Transport returns an http.RoundTripper that answers API requests with the
+// home's current state.
+func (h *Home) Transport() http.RoundTripper {
+	mh := mockapi.NewHandler(h)
+	mh.Privileges = h.privileges
+	return mockapi.Transport(mh)
+}
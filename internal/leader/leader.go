@@ -0,0 +1,123 @@
+// Package leader elects one of several exporter replicas to poll the ecobee
+// API, using a lock in Redis, and shares the leader's metrics with the
+// standbys so they can serve them without using any API quota.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// renew extends the lock if it is still held by this replica.
+var renew = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// release deletes the lock if it is still held by this replica.
+var release = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Elector holds or waits for a lease stored in Redis under a key shared
+// by all replicas.
+type Elector struct {
+	client *redis.Client
+	key    string
+	id     string
+	lease  time.Duration
+	leader atomic.Bool
+	since  atomic.Int64 // unix nanoseconds
+}
+
+// New returns an Elector competing for key with leases of the given
+// length. Call Run to take part in the election.
+func New(client *redis.Client, key string, lease time.Duration) *Elector {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Elector{client: client, key: key, id: hex.EncodeToString(b), lease: lease}
+}
+
+// IsLeader reports whether this replica currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Since returns when this replica last became the leader or stepped
+// down, or the zero time if it never has.
+func (e *Elector) Since() time.Time {
+	if ns := e.since.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// Run tries to acquire or renew the lease every third of its length until
+// ctx is done, then releases it.
+func (e *Elector) Run(ctx context.Context) {
+	t := time.NewTicker(e.lease / 3)
+	defer t.Stop()
+	for {
+		e.tick(ctx)
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				rctx, cancel := context.WithTimeout(context.Background(), e.lease/3)
+				release.Run(rctx, e.client, []string{e.key}, e.id)
+				cancel()
+				e.leader.Store(false)
+				e.since.Store(time.Now().UnixNano())
+			}
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	var held bool
+	var err error
+	if e.IsLeader() {
+		var n int64
+		n, err = renew.Run(ctx, e.client, []string{e.key}, e.id, e.lease.Milliseconds()).Int64()
+		held = n == 1
+	} else {
+		held, err = e.client.SetNX(ctx, e.key, e.id, e.lease).Result()
+	}
+	if err != nil {
+		// Step down rather than risk two leaders while Redis is
+		// unreachable; the lease expires on its own.
+		slog.WarnContext(ctx, "leader election failed", "error", err)
+		held = false
+	}
+	if was := e.leader.Swap(held); was != held {
+		e.since.Store(time.Now().UnixNano())
+		slog.InfoContext(ctx, "leadership changed", "leader", held)
+	}
+}
+
+// Publish stores the leader's latest metrics, in the Prometheus text
+// format, for standbys to serve. They expire if not refreshed within ten
+// leases.
+func (e *Elector) Publish(ctx context.Context, metrics []byte) error {
+	return e.client.Set(ctx, e.key+":metrics", metrics, 10*e.lease).Err()
+}
+
+// Latest returns the metrics most recently published by a leader, or nil
+// if there are none.
+func (e *Elector) Latest(ctx context.Context) ([]byte, error) {
+	b, err := e.client.Get(ctx, e.key+":metrics").Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return b, err
+}
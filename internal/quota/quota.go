@@ -0,0 +1,100 @@
+// Package quota shares a budget of Ecobee API calls between the exporter
+// and other tools using the same API key, counted in Redis.
+//
+// Each tool increments the key "<key>:<window>", where window is the start
+// of the current window in Unix seconds, before every call, and makes the
+// call only if the result is no more than the limit. The counter expires
+// along with its window.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// ErrExhausted is returned by requests rejected because the budget for the
+// current window has been used up.
+var ErrExhausted = errors.New("shared quota for the Ecobee API exhausted for this window")
+
+// Budget allows up to limit API calls per window across every tool sharing
+// its Redis key.
+type Budget struct {
+	client *redis.Client
+	key    string
+	limit  int64
+	window time.Duration
+
+	remaining prometheus.Gauge
+	rejected  prometheus.Counter
+}
+
+// New returns a Budget of limit calls per window, counted under key, and
+// registers its metrics, with the given prefix, with reg.
+func New(c *redis.Client, key string, limit int, window time.Duration, reg prometheus.Registerer, metricPrefix string) *Budget {
+	b := &Budget{
+		client: c,
+		key:    key,
+		limit:  int64(limit),
+		window: window,
+		remaining: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: fmt.Sprintf("%s_api_quota_remaining", metricPrefix),
+			Help: "API calls left in the shared budget for the current window, as of the last call",
+		}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: fmt.Sprintf("%s_api_quota_rejected_total", metricPrefix),
+			Help: "API calls not made because the shared budget was used up",
+		}),
+	}
+	limitGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: fmt.Sprintf("%s_api_quota_limit", metricPrefix),
+		Help: "API calls allowed in the shared budget per window",
+	})
+	limitGauge.Set(float64(limit))
+	b.remaining.Set(float64(limit))
+	reg.MustRegister(b.remaining, b.rejected, limitGauge)
+	return b
+}
+
+// take counts a call against the current window and reports whether it is
+// within the budget. If Redis can't be reached the call is allowed, so that
+// an outage of Redis doesn't stop collection.
+func (b *Budget) take(ctx context.Context) bool {
+	start := time.Now().Truncate(b.window)
+	key := b.key + ":" + strconv.FormatInt(start.Unix(), 10)
+	pipe := b.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, start.Add(b.window))
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "unable to count API call against the shared quota", "error", err)
+		return true
+	}
+	used := incr.Val()
+	if remaining := b.limit - used; remaining >= 0 {
+		b.remaining.Set(float64(remaining))
+	} else {
+		b.remaining.Set(0)
+	}
+	return used <= b.limit
+}
+
+// Middleware rejects requests with ErrExhausted once the budget for the
+// current window is used up.
+func (b *Budget) Middleware(next http.RoundTripper) http.RoundTripper {
+	return client.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if !b.take(r.Context()) {
+			b.rejected.Inc()
+			return nil, ErrExhausted
+		}
+		return next.RoundTrip(r)
+	})
+}
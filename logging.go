@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+)
+
+// setupLogging installs the default slog logger according to the --log
+// flags.
+func setupLogging() {
+	var level slog.Level
+	switch *logLevel {
+	case "trace":
+		level = client.LevelTrace
+	default:
+		level.UnmarshalText([]byte(*logLevel))
+	}
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == client.LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}
+	format := func(w io.Writer) slog.Handler {
+		if *logFormat == "json" {
+			return slog.NewJSONHandler(w, opts)
+		}
+		return slog.NewTextHandler(w, opts)
+	}
+	h := format(os.Stderr)
+	if *logFile != "" {
+		h = format(&lumberjack.Logger{
+			Filename:   *logFile,
+			MaxSize:    *logMaxSize,
+			MaxAge:     int(math.Ceil(logMaxAge.Hours() / 24)),
+			MaxBackups: *logMaxBackups,
+		})
+	}
+	if *logSyslog != "" {
+		// syslog timestamps messages itself
+		replace := opts.ReplaceAttr
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return replace(groups, a)
+		}
+		var err error
+		if h, err = newSyslogHandler(*logSyslog, format); err != nil {
+			fatal(fmt.Errorf("error connecting to syslog: %v", err))
+		}
+	}
+	h = collector.LogHandler(h)
+	if *logDedup > 0 {
+		h = newDedupHandler(h, *logDedup)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// fatal logs err and exits.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// kitLogger adapts the default slog logger to the go-kit logger the
+// exporter toolkit logs to.
+type kitLogger struct{}
+
+func (kitLogger) Log(keyvals ...interface{}) error {
+	level, msg := slog.LevelInfo, ""
+	var args []any
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch k := fmt.Sprint(keyvals[i]); k {
+		case "level":
+			level.UnmarshalText([]byte(fmt.Sprint(keyvals[i+1])))
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		default:
+			args = append(args, k, keyvals[i+1])
+		}
+	}
+	slog.Log(context.Background(), level, msg, args...)
+	return nil
+}
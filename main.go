@@ -14,40 +14,868 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	log "github.com/sirupsen/logrus"
-
-	"github.com/billykwooten/go-ecobee/ecobee"
-	"github.com/joeshaw/ecobee-exporter/collector"
+	"github.com/joeshaw/ecobee-exporter/internal/config"
+	"github.com/joeshaw/ecobee-exporter/internal/demo"
+	"github.com/joeshaw/ecobee-exporter/internal/leader"
+	"github.com/joeshaw/ecobee-exporter/internal/quota"
+	"github.com/joeshaw/ecobee-exporter/pkg/cassette"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+	"github.com/joeshaw/ecobee-exporter/pkg/poller"
+	"github.com/joeshaw/ecobee-exporter/pkg/sinks"
+	"github.com/joeshaw/ecobee-exporter/pkg/tokenstore"
+	"github.com/joeshaw/ecobee-exporter/pkg/weather"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/redis/go-redis/v9"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	app            = kingpin.New("ecobee-exporter", "Ecobee Exporter utilizing Ecobee API").Author("Billy Wooten")
-	addr           = app.Flag("listen-address", "HTTP port to listen on").Envar("ECOBEE_LISTEN_ADDRESS").Default(":9098").String()
-	applicationKey = app.Flag("appkey", "Application API Key").Envar("ECOBEE_APPKEY").Default("p3NbLx6iSYTjXDFHIMtM77SWWPLRuEZ0").String()
-	cacheFile      = app.Flag("cachefile", "Cache file so the exporter can store and sync authorization tokens").Envar("ECOBEE_CACHEFILE").Default("/db/auth.cache").String()
+	app               = kingpin.New("ecobee-exporter", "Ecobee Exporter utilizing Ecobee API").Author("Billy Wooten")
+	addr              = app.Flag("listen-address", "HTTP port to listen on").Envar("ECOBEE_LISTEN_ADDRESS").Default(":9098").String()
+	webConfigFile     = app.Flag("web.config.file", "Path to a configuration file that can enable TLS or basic authentication").Envar("ECOBEE_WEB_CONFIG_FILE").String()
+	applicationKey    = app.Flag("appkey", "Application API Key").Envar("ECOBEE_APPKEY").Default("p3NbLx6iSYTjXDFHIMtM77SWWPLRuEZ0").String()
+	cacheFile         = app.Flag("cachefile", "Cache file so the exporter can store and sync authorization tokens").Envar("ECOBEE_CACHEFILE").Default("/db/auth.cache").String()
+	authScope         = app.Flag("auth.scope", "Scope to request when authorizing: smartRead, or ems for EMS and utility accounts").Envar("ECOBEE_AUTH_SCOPE").Default("smartRead").Enum("smartRead", "ems")
+	configFile        = app.Flag("config.file", "Path to an optional YAML configuration file").Envar("ECOBEE_CONFIG_FILE").String()
+	demoMode          = app.Flag("demo", "Serve synthetic thermostats and sensors instead of querying the Ecobee API").Envar("ECOBEE_DEMO").Bool()
+	demoThermostats   = app.Flag("demo.thermostats", "Simulate a fleet of this many thermostats in demo mode instead of a single home").Envar("ECOBEE_DEMO_THERMOSTATS").Default("0").Int()
+	demoSensors       = app.Flag("demo.sensors", "Number of remote sensors per thermostat in a simulated fleet").Envar("ECOBEE_DEMO_SENSORS").Default("3").Int()
+	recordPath        = app.Flag("cassette.record", "Append every Ecobee API response to this cassette file").Envar("ECOBEE_CASSETTE_RECORD").String()
+	replayPath        = app.Flag("cassette.replay", "Serve metrics from a recorded cassette file instead of querying the Ecobee API").Envar("ECOBEE_CASSETTE_REPLAY").String()
+	apiRetries        = app.Flag("api.retries", "Number of times to retry failed Ecobee API requests").Envar("ECOBEE_API_RETRIES").Default("0").Int()
+	circuitFailures   = app.Flag("api.circuit-failures", "Consecutive failed API requests after which to stop calling the API for --api.circuit-cooldown, 0 to never stop").Envar("ECOBEE_API_CIRCUIT_FAILURES").Default("0").Int()
+	circuitCooldown   = app.Flag("api.circuit-cooldown", "How long to stop calling the API after --api.circuit-failures consecutive failures").Envar("ECOBEE_API_CIRCUIT_COOLDOWN").Default("5m").Duration()
+	throttlePause     = app.Flag("api.throttle-pause", "How long to pause API requests after a 429 or 503 response without a Retry-After header, 0 to not pause").Envar("ECOBEE_API_THROTTLE_PAUSE").Default("1m").Duration()
+	changeDetection   = app.Flag("api.change-detection", "Skip fetching thermostats whose revisions haven't changed since they were last fetched").Envar("ECOBEE_API_CHANGE_DETECTION").Bool()
+	apiGroups         = app.Flag("api.groups", "Fetch thermostat groups and export them as ecobee_thermostat_group_info").Envar("ECOBEE_API_GROUPS").Bool()
+	groupsRefresh     = app.Flag("api.groups-refresh", "How often to fetch thermostat groups again with --api.groups").Envar("ECOBEE_API_GROUPS_REFRESH").Default("1h").Duration()
+	filterRuntime     = app.Flag("api.filter-runtime", "Fetch runtime reports and export fan runtime since each filter change as ecobee_fan_runtime_since_filter_change_seconds").Envar("ECOBEE_API_FILTER_RUNTIME").Bool()
+	filterRefresh     = app.Flag("api.filter-runtime-refresh", "How often to fetch runtime reports again with --api.filter-runtime").Envar("ECOBEE_API_FILTER_RUNTIME_REFRESH").Default("1h").Duration()
+	apiIntervals      = app.Flag("api.intervals", "Fetch the extended runtime and export the last three 5-minute intervals of each thermostat as timestamped samples").Envar("ECOBEE_API_INTERVALS").Bool()
+	equipmentRuntime  = app.Flag("api.equipment-runtime", "Fetch the extended runtime and count each thermostat's equipment runtime as ecobee_equipment_runtime_seconds_total").Envar("ECOBEE_API_EQUIPMENT_RUNTIME").Bool()
+	apiAlerts         = app.Flag("api.alerts", "Fetch alerts and reminders and export their counts as ecobee_alerts and the due dates of maintenance reminders").Envar("ECOBEE_API_ALERTS").Bool()
+	emsSet            = app.Flag("ems.set", "Collect the thermostats at and below this set of an EMS account's management hierarchy, such as /, instead of the registered thermostats").Envar("ECOBEE_EMS_SET").String()
+	emsRefresh        = app.Flag("ems.refresh", "How often to fetch the management hierarchy again with --ems.set").Envar("ECOBEE_EMS_REFRESH").Default("1h").Duration()
+	apiMinInterval    = app.Flag("api.min-interval", "Minimum time between Ecobee API requests").Envar("ECOBEE_API_MIN_INTERVAL").Default("0s").Duration()
+	scrapeTimeout     = app.Flag("scrape.timeout", "Time limit for collecting metrics when Prometheus doesn't send one, 0 for none").Envar("ECOBEE_SCRAPE_TIMEOUT").Default("0s").Duration()
+	timeoutOffset     = app.Flag("scrape.timeout-offset", "Time subtracted from Prometheus' scrape timeout to allow for network and encoding overhead").Envar("ECOBEE_SCRAPE_TIMEOUT_OFFSET").Default("500ms").Duration()
+	shutdownTimeout   = app.Flag("shutdown-timeout", "Time to wait for in-flight requests and sinks when shutting down").Envar("ECOBEE_SHUTDOWN_TIMEOUT").Default("10s").Duration()
+	textfilePath      = app.Flag("sink.textfile", "Also write metrics to this file for node_exporter's textfile collector").Envar("ECOBEE_SINK_TEXTFILE").String()
+	influxURL         = app.Flag("sink.influx-url", "Also push metrics in the InfluxDB line protocol to this write URL, including the database or bucket").Envar("ECOBEE_SINK_INFLUX_URL").String()
+	influxToken       = app.Flag("sink.influx-token", "Token for --sink.influx-url").Envar("ECOBEE_SINK_INFLUX_TOKEN").String()
+	sinkBufferFile    = app.Flag("sink.buffer-file", "Keep metrics that push sinks fail to accept in this file, and push them again when the sink recovers").Envar("ECOBEE_SINK_BUFFER_FILE").String()
+	sinkBufferSize    = app.Flag("sink.buffer-size", "Maximum size of --sink.buffer-file").Envar("ECOBEE_SINK_BUFFER_SIZE").Default("10MB").Bytes()
+	sinkInterval      = app.Flag("sink.interval", "How often to write metrics to sinks").Envar("ECOBEE_SINK_INTERVAL").Default("1m").Duration()
+	debugLastResponse = app.Flag("debug.last-response", "Serve the most recent thermostat objects returned by the API, redacted, on /debug/last-response").Envar("ECOBEE_DEBUG_LAST_RESPONSE").Bool()
+	logLevel          = app.Flag("log.level", "Log level: trace, debug, info, warn or error").Envar("ECOBEE_LOG_LEVEL").Default("info").Enum("trace", "debug", "info", "warn", "error")
+	logFormat         = app.Flag("log.format", "Log format: logfmt or json").Envar("ECOBEE_LOG_FORMAT").Default("logfmt").Enum("logfmt", "json")
+	logSyslog         = app.Flag("log.syslog", "Send logs to syslog instead of stderr: local, or an address such as udp://router:514").Envar("ECOBEE_LOG_SYSLOG").String()
+	logDedup          = app.Flag("log.dedup-interval", "Log identical warnings and errors at most once per interval, with a count of those suppressed; 0 to log all").Envar("ECOBEE_LOG_DEDUP_INTERVAL").Default("5m").Duration()
+	logFile           = app.Flag("log.file", "Write logs to this file instead of stderr, rotating it by size and age").Envar("ECOBEE_LOG_FILE").String()
+	logMaxSize        = app.Flag("log.file.max-size", "Size in megabytes at which the log file is rotated").Envar("ECOBEE_LOG_FILE_MAX_SIZE").Default("10").Int()
+	logMaxAge         = app.Flag("log.file.max-age", "How long rotated log files are kept, rounded up to days; 0 to keep them regardless of age").Envar("ECOBEE_LOG_FILE_MAX_AGE").Default("168h").Duration()
+	logMaxBackups     = app.Flag("log.file.max-backups", "Number of rotated log files to keep; 0 to keep all").Envar("ECOBEE_LOG_FILE_MAX_BACKUPS").Default("3").Int()
+	logTrace          = app.Flag("log.trace-endpoints", "API endpoints, such as thermostat or token, whose requests and responses are logged at trace level; all if empty").Envar("ECOBEE_LOG_TRACE_ENDPOINTS").Strings()
+	alertWebhook      = app.Flag("alert.webhook-url", "URL to POST a JSON event to on panics and repeated collection failures").Envar("ECOBEE_ALERT_WEBHOOK_URL").String()
+	alertFailures     = app.Flag("alert.failures", "Number of consecutive failed collections before alerting").Envar("ECOBEE_ALERT_FAILURES").Default("3").Int()
+	healthStaleAfter  = app.Flag("health.stale-after", "Report /healthz as degraded when no collection has succeeded for this long").Envar("ECOBEE_HEALTH_STALE_AFTER").Default("10m").Duration()
+	haRedis           = app.Flag("ha.redis-address", "Redis address for electing one of several replicas to poll the Ecobee API").Envar("ECOBEE_HA_REDIS_ADDRESS").String()
+	haKey             = app.Flag("ha.key", "Redis key shared by the replicas").Envar("ECOBEE_HA_KEY").Default("ecobee-exporter").String()
+	haLease           = app.Flag("ha.lease", "How long the leader holds its lease without renewing it").Envar("ECOBEE_HA_LEASE").Default("15s").Duration()
+	pollInterval      = app.Flag("poll.interval", "Collect in the background this often and serve scrapes from the latest poll, 0 to collect on every scrape").Envar("ECOBEE_POLL_INTERVAL").Default("0s").Duration()
+	pollBusyInterval  = app.Flag("poll.busy-interval", "Background poll interval while equipment is running or a hold is in effect, 0 to always use --poll.interval").Envar("ECOBEE_POLL_BUSY_INTERVAL").Default("0s").Duration()
+	pollJitter        = app.Flag("poll.jitter", "Delay each background poll by a random duration up to this").Envar("ECOBEE_POLL_JITTER").Default("0s").Duration()
+	pollAlign         = app.Flag("poll.align", "Schedule background polls at multiples of --poll.interval rather than after the previous poll").Envar("ECOBEE_POLL_ALIGN").Bool()
+	warmUp            = app.Flag("startup.warm-up", "Fetch once at startup, reporting /-/ready only once it finishes").Envar("ECOBEE_STARTUP_WARM_UP").Default("true").Bool()
+	snapshotFile      = app.Flag("snapshot.file", "Path to keep the last successful fetch of each thermostat in, to export when fetches fail, including after a restart").Envar("ECOBEE_SNAPSHOT_FILE").String()
+	snapshotMaxAge    = app.Flag("snapshot.max-age", "Stop exporting a thermostat from the snapshot once it hasn't been fetched for this long, 0 for never").Envar("ECOBEE_SNAPSHOT_MAX_AGE").Default("1h").Duration()
+	shardCount        = app.Flag("shard.count", "Number of exporters sharing the thermostats by hash of their IDs").Envar("ECOBEE_SHARD_COUNT").Int()
+	shardIndex        = app.Flag("shard.index", "Shard of the thermostats collected by this exporter, from 0 to --shard.count-1").Envar("ECOBEE_SHARD_INDEX").Int()
+	aggregateInUse    = app.Flag("aggregate.in-use-only", "Aggregate the temperatures of only the sensors each thermostat currently uses").Envar("ECOBEE_AGGREGATE_IN_USE_ONLY").Bool()
+	moldHumidity      = app.Flag("risk.mold-humidity", "Humidity in percent at or above which a sensor risks mold").Envar("ECOBEE_RISK_MOLD_HUMIDITY").Default("70").Float64()
+	moldTemperature   = app.Flag("risk.mold-temperature", "Temperature in degrees Fahrenheit at or below which a damp sensor risks mold").Envar("ECOBEE_RISK_MOLD_TEMPERATURE").Default("68").Float64()
+	moldDuration      = app.Flag("risk.mold-duration", "How long a sensor must stay damp and cool before it is flagged as risking mold").Envar("ECOBEE_RISK_MOLD_DURATION").Default("6h").Duration()
+	frostTemperature  = app.Flag("risk.frost-temperature", "Temperature in degrees Fahrenheit at or below which a sensor risks frost").Envar("ECOBEE_RISK_FROST_TEMPERATURE").Default("40").Float64()
+	conflictGrace     = app.Flag("equipment.conflict-grace", "How long equipment that shouldn't run together, such as cooling and auxiliary heat, may before it is flagged, to allow for heat pump defrost cycles").Envar("ECOBEE_EQUIPMENT_CONFLICT_GRACE").Default("15m").Duration()
+	weatherSources    = app.Flag("weather.source", "Outdoor conditions to export when a thermostat's ecobee weather is missing or stale: none, open-meteo or nws; may be repeated, to try each in order").Envar("ECOBEE_WEATHER_SOURCE").Default("none").Enums("none", "open-meteo", "nws")
+	weatherLatitude   = app.Flag("weather.latitude", "Latitude of the location to fetch outdoor conditions for with --weather.source").Envar("ECOBEE_WEATHER_LATITUDE").Float64()
+	weatherLongitude  = app.Flag("weather.longitude", "Longitude of the location to fetch outdoor conditions for with --weather.source").Envar("ECOBEE_WEATHER_LONGITUDE").Float64()
+	weatherMaxAge     = app.Flag("weather.max-age", "Age beyond which a thermostat's ecobee weather is stale").Envar("ECOBEE_WEATHER_MAX_AGE").Default("3h").Duration()
+	weatherRefresh    = app.Flag("weather.refresh", "How often to fetch outdoor conditions again from --weather.source").Envar("ECOBEE_WEATHER_REFRESH").Default("15m").Duration()
+	thermalModel      = app.Flag("thermal.model", "Fit a thermal model of each thermostat's space and export its heat loss coefficient and time constant").Envar("ECOBEE_THERMAL_MODEL").Bool()
+	thermalWindow     = app.Flag("thermal.window", "How long the thermal model weighs past observations over").Envar("ECOBEE_THERMAL_WINDOW").Default("168h").Duration()
+	balancePoint      = app.Flag("balance.point", "Count heat pump compressor and auxiliary heat runtime by outdoor temperature band as ecobee_heat_pump_runtime_seconds_total").Envar("ECOBEE_BALANCE_POINT").Bool()
+	balanceBandWidth  = app.Flag("balance.band-width", "Width in degrees Fahrenheit of the outdoor temperature bands of --balance.point").Envar("ECOBEE_BALANCE_BAND_WIDTH").Default("5").Float64()
+	metricPrefix      = app.Flag("metric.prefix", "Prefix of the exported metric names, instead of ecobee").Envar("ECOBEE_METRIC_PREFIX").Default("ecobee").String()
+	previousPrefix    = app.Flag("metric.previous-prefix", "Prefix to also export the metrics under while dashboards and rules migrate to --metric.prefix").Envar("ECOBEE_METRIC_PREVIOUS_PREFIX").String()
+	previousUntil     = app.Flag("metric.previous-until", "Date, such as 2026-12-31, or time from which to stop exporting the metrics under --metric.previous-prefix; empty to never stop").Envar("ECOBEE_METRIC_PREVIOUS_UNTIL").String()
+	fetchTime         = app.Flag("metric.fetch-time", "Also export ecobee_fetch_time, the duration of each collection, superseded by ecobee_api_request_duration_seconds").Envar("ECOBEE_METRIC_FETCH_TIME").Bool()
+	units             = app.Flag("units", "Convert the temperature metrics to celsius or fahrenheit and suffix their names with the unit; unset keeps them in unsuffixed degrees Fahrenheit").Envar("ECOBEE_UNITS").Enum("celsius", "fahrenheit")
+	limitSeries       = app.Flag("limit.series", "Maximum number of series to export per account per scrape, 0 for no limit").Envar("ECOBEE_LIMIT_SERIES").Default("0").Int()
+	limitSensors      = app.Flag("limit.sensors", "Maximum number of sensors to export per thermostat, 0 for no limit").Envar("ECOBEE_LIMIT_SENSORS").Default("0").Int()
+	quotaRedis        = app.Flag("quota.redis-address", "Redis address for a budget of API calls shared with other tools using the same API key").Envar("ECOBEE_QUOTA_REDIS_ADDRESS").String()
+	quotaKey          = app.Flag("quota.key", "Redis key prefix of the shared API call budget").Envar("ECOBEE_QUOTA_KEY").Default("ecobee-quota").String()
+	quotaLimit        = app.Flag("quota.limit", "API calls allowed per --quota.window by all tools sharing the budget").Envar("ECOBEE_QUOTA_LIMIT").Default("1000").Int()
+	quotaWindow       = app.Flag("quota.window", "Length of each shared API call budget window").Envar("ECOBEE_QUOTA_WINDOW").Default("1h").Duration()
+	accountPaths      = app.Flag("web.account-paths", "Serve the metrics of each account of the configuration file on /metrics/<account> instead of together on /metrics").Envar("ECOBEE_WEB_ACCOUNT_PATHS").Bool()
+	dryRun            = app.Flag("dry-run", "Validate the configuration, collect once, report what would be exported and exit").Envar("ECOBEE_DRY_RUN").Bool()
+
+	serveCmd = app.Command("serve", "Serve metrics over HTTP for Prometheus to scrape").Default()
+	onceCmd  = app.Command("once", "Collect metrics once and print them to stdout")
+	listCmd  = app.Command("list-thermostats", "List the thermostats registered to the account")
+	listJSON = listCmd.Flag("json", "Print the thermostats as JSON instead of a table").Bool()
+
+	sensorsCmd  = app.Command("list-sensors", "List the remote sensors of each thermostat")
+	sensorsJSON = sensorsCmd.Flag("json", "Print the sensors as JSON instead of a table").Bool()
+
+	versionCmd = app.Command("version", "Print version and build information")
+	lintCmd    = app.Command("lint", "Collect metrics once and check them for naming and exposition problems")
+
+	healthcheckCmd     = app.Command("healthcheck", "Check the health of the exporter listening on --listen-address, exiting with a non-zero status if it is unhealthy")
+	healthcheckURL     = healthcheckCmd.Flag("url", "URL of the health endpoint to check instead of /healthz on --listen-address").String()
+	healthcheckTimeout = healthcheckCmd.Flag("timeout", "How long to wait for the health endpoint to respond").Default("5s").Duration()
+
+	manifestsCmd           = app.Command("manifests", "Print Kubernetes manifests for running the exporter with the flags given to this command and scraping it with the Prometheus Operator")
+	manifestsName          = manifestsCmd.Flag("name", "Name of the generated resources").Default("ecobee-exporter").String()
+	manifestsNamespace     = manifestsCmd.Flag("namespace", "Namespace of the generated resources").Default("monitoring").String()
+	manifestsImage         = manifestsCmd.Flag("image", "Container image to run instead of the image of this version").String()
+	manifestsMonitor       = manifestsCmd.Flag("monitor", "Prometheus Operator resource to generate: service for a ServiceMonitor, or pod for a PodMonitor").Default("service").Enum("service", "pod")
+	manifestsMonitorLabels = manifestsCmd.Flag("monitor-label", "Label, such as release=prometheus, for the Prometheus Operator to select the monitor by; may be repeated").StringMap()
+
+	serviceCmd          = app.Command("service", "Manage the exporter as a Windows service")
+	serviceInstallCmd   = serviceCmd.Command("install", "Install the Windows service, running the exporter with the flags given to this command")
+	serviceUninstallCmd = serviceCmd.Command("uninstall", "Remove the Windows service")
+	serviceStartCmd     = serviceCmd.Command("start", "Start the Windows service")
+	serviceStopCmd      = serviceCmd.Command("stop", "Stop the Windows service")
+
+	dumpCmd     = app.Command("dump", "Print the raw thermostat objects returned by the API, with personal details redacted")
+	dumpType    = dumpCmd.Flag("selection.type", "Selection type, such as registered or thermostats").Default("registered").String()
+	dumpMatch   = dumpCmd.Flag("selection.match", "Selection match, such as a comma-separated list of thermostat IDs").String()
+	dumpInclude = dumpCmd.Flag("include", "Thermostat object to include, such as runtime or weather; may be repeated").Default("runtime", "settings", "sensors").Strings()
+
+	backfillCmd         = app.Command("backfill", "Export the 5-minute history of each thermostat's runtime report, for importing history from before the exporter ran")
+	backfillFrom        = backfillCmd.Flag("from", "First day of the history, such as 2026-01-31").Required().String()
+	backfillTo          = backfillCmd.Flag("to", "Last day of the history; empty for today").String()
+	backfillRemoteWrite = backfillCmd.Flag("remote-write", "Prometheus remote write URL to post the history to, instead of printing it in the OpenMetrics format").String()
+	backfillToken       = backfillCmd.Flag("remote-write.bearer-token", "Bearer token to send with --remote-write").String()
 )
 
 func main() {
 	// Parse Kingpin Variables
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	if err := applyConfigFlags(); err != nil {
+		fatal(err)
+	}
+	setupLogging()
+
+	if *dryRun {
+		check()
+		return
+	}
+	switch cmd {
+	case serveCmd.FullCommand():
+		if isService() {
+			runService()
+		} else {
+			serve(interrupted())
+		}
+	case onceCmd.FullCommand():
+		once()
+	case listCmd.FullCommand():
+		listThermostats()
+	case sensorsCmd.FullCommand():
+		listSensors()
+	case dumpCmd.FullCommand():
+		dump()
+	case backfillCmd.FullCommand():
+		backfill(*backfillFrom, *backfillTo, *backfillRemoteWrite, *backfillToken)
+	case versionCmd.FullCommand():
+		printVersion()
+	case lintCmd.FullCommand():
+		lint()
+	case healthcheckCmd.FullCommand():
+		healthcheck(*healthcheckURL, *healthcheckTimeout)
+	case manifestsCmd.FullCommand():
+		manifests(*manifestsName, *manifestsNamespace, *manifestsImage, *manifestsMonitor, *manifestsMonitorLabels)
+	case serviceInstallCmd.FullCommand():
+		installService()
+	case serviceUninstallCmd.FullCommand():
+		uninstallService()
+	case serviceStartCmd.FullCommand():
+		startService()
+	case serviceStopCmd.FullCommand():
+		stopService()
+	}
+}
+
+// loadConfig returns the configuration file, or an empty configuration if
+// there is none.
+func loadConfig() *config.Config {
+	if *configFile == "" {
+		return &config.Config{}
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	return cfg
+}
+
+// applyConfigFlags sets the flags of the configuration file, if any, that
+// weren't given on the command line or in the environment.
+func applyConfigFlags() error {
+	if *configFile == "" {
+		return nil
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	set, err := setFlags()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cfg.Flags))
+	for name := range cfg.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := app.GetFlag(name)
+		switch {
+		case f == nil:
+			return fmt.Errorf("%s: unknown flag %q", *configFile, name)
+		case name == "config.file":
+			return fmt.Errorf("%s: config.file can't be set in the configuration file", *configFile)
+		case set[name]:
+			continue
+		}
+		for _, v := range cfg.Flags[name] {
+			if err := f.Model().Value.Set(v); err != nil {
+				return fmt.Errorf("%s: flag %s: %v", *configFile, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setup builds a collector using c and the metric transforms from the
+// command line flags and the configuration file.
+func setup(c *client.Client, opts ...collector.Option) (*collector.Collector, []pipeline.Transformer) {
+	return setupAccount(c, flagAccount(), loadConfig(), nil, opts...)
+}
+
+// setupAccount builds a collector of acct using c, the configuration cfg
+// and the command line flags, returning the metric transforms of the
+// configuration file followed by those of the flags. With a reloader r,
+// the transforms and shard thermostats of the configuration file are those
+// of its latest reload.
+func setupAccount(c *client.Client, acct account, cfg *config.Config, r *configReloader, opts ...collector.Option) (*collector.Collector, []pipeline.Transformer) {
+	transforms := []pipeline.Transformer{r}
+	if r == nil {
+		var err error
+		if transforms, err = cfg.Transformers(); err != nil {
+			fatal(err)
+		}
+	}
+	definitions, err := cfg.Definitions("ecobee")
+	if err != nil {
+		fatal(err)
+	}
+
+	opts = append([]collector.Option{
+		collector.WithDefinitions(definitions...),
+		collector.WithTimeout(*scrapeTimeout),
+	}, opts...)
+	shardOpt, shardInfo, err := shard(cfg, r)
+	if err != nil {
+		fatal(err)
+	}
+	if *changeDetection {
+		opts = append(opts, collector.WithChangeDetection())
+	}
+	if *apiGroups {
+		opts = append(opts, collector.WithGroups(*groupsRefresh))
+	}
+	if *filterRuntime {
+		opts = append(opts, collector.WithFilterRuntime(*filterRefresh))
+	}
+	if *apiIntervals {
+		opts = append(opts, collector.WithIntervals())
+		transforms = append(transforms, pipeline.Unlabel(collector.IntervalLabel))
+	}
+	if *equipmentRuntime {
+		opts = append(opts, collector.WithEquipmentRuntime())
+	}
+	if *apiAlerts {
+		opts = append(opts, collector.WithAlerts())
+	}
+	if *emsSet != "" {
+		opts = append(opts, collector.WithHierarchy(*emsSet, *emsRefresh))
+	}
+	opts = append(opts, collector.WithRisk(collector.Risk{
+		MoldHumidity:     *moldHumidity,
+		MoldTemperature:  *moldTemperature,
+		MoldDuration:     *moldDuration,
+		FrostTemperature: *frostTemperature,
+	}))
+	opts = append(opts, collector.WithEquipmentConflicts(*conflictGrace))
+	var sources []weather.Source
+	for _, name := range *weatherSources {
+		switch name {
+		case "open-meteo":
+			sources = append(sources, weather.NewOpenMeteo(*weatherLatitude, *weatherLongitude))
+		case "nws":
+			ua := "ecobee-exporter/" + Version + " (https://github.com/joeshaw/ecobee-exporter)"
+			sources = append(sources, weather.NewNWS(*weatherLatitude, *weatherLongitude, ua))
+		}
+	}
+	if len(sources) > 0 && *weatherLatitude == 0 && *weatherLongitude == 0 {
+		fatal(fmt.Errorf("--weather.source=%s needs --weather.latitude and --weather.longitude", strings.Join(*weatherSources, ",")))
+	}
+	opts = append(opts, collector.WithWeatherFallback(*weatherMaxAge, *weatherRefresh, sources...))
+	if *thermalModel {
+		opts = append(opts, collector.WithThermalModel(*thermalWindow))
+	}
+	if *balancePoint {
+		if *balanceBandWidth <= 0 {
+			fatal(fmt.Errorf("--balance.band-width must be positive"))
+		}
+		opts = append(opts, collector.WithBalancePoint(*balanceBandWidth))
+	}
+	if *aggregateInUse {
+		opts = append(opts, collector.WithInUseAggregates())
+	}
+	if *limitSensors > 0 {
+		opts = append(opts, collector.WithSensorLimit(*limitSensors))
+	}
+	if *fetchTime {
+		opts = append(opts, collector.WithFetchTime())
+	}
+	if *units != "" {
+		transforms = append(transforms, unitsTransform(*units, cfg.TemperatureMetrics())...)
+	}
+	rename, err := prefixTransform()
+	if err != nil {
+		fatal(err)
+	}
+	if rename != nil {
+		transforms = append(transforms, rename)
+	}
+	if *limitSeries > 0 {
+		truncated := prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ecobee_exporter_truncated_series_total",
+			Help: "series not exported because a scrape had more than the series limit",
+		})
+		acct.reg.MustRegister(truncated)
+		transforms = append(transforms, pipeline.Limit(*limitSeries, func(dropped int) {
+			slog.Warn("too many series, dropping the rest", "dropped", dropped, "limit", *limitSeries)
+			truncated.Add(float64(dropped))
+		}))
+	}
+	if acct.snapshotFile != "" {
+		opts = append(opts, collector.WithSnapshot(acct.snapshotFile, *snapshotMaxAge))
+	}
+	if shardOpt != nil {
+		opts = append(opts, shardOpt)
+		acct.reg.MustRegister(shardInfo)
+	}
+	return collector.NewEcobeeCollector(c, "ecobee", opts...), transforms
+}
+
+// unitsTransform returns the transforms converting the temperature metrics,
+// and the additional metrics named extra, from degrees Fahrenheit to unit
+// and suffixing their names with it.
+func unitsTransform(unit string, extra []string) []pipeline.Transformer {
+	names := func(ms []string) *regexp.Regexp {
+		return regexp.MustCompile("^ecobee_(" + strings.Join(ms, "|") + ")$")
+	}
+	temperatures := names(append(collector.TemperatureMetrics[:len(collector.TemperatureMetrics):len(collector.TemperatureMetrics)], extra...))
+	differences := names(collector.TemperatureDifferenceMetrics)
+	var ts []pipeline.Transformer
+	if unit == "celsius" {
+		ts = append(ts,
+			pipeline.Scale(temperatures, 5.0/9, -32*5.0/9),
+			pipeline.Scale(differences, 5.0/9, 0),
+		)
+	}
+	return append(ts,
+		pipeline.Suffix(temperatures, "_"+unit),
+		pipeline.Suffix(differences, "_"+unit),
+	)
+}
+
+// prefixTransform returns the transform exporting the metrics under
+// --metric.prefix and, until --metric.previous-until, also under
+// --metric.previous-prefix, or nil if the metrics keep their names.
+func prefixTransform() (pipeline.Transformer, error) {
+	for _, p := range []string{*metricPrefix, *previousPrefix} {
+		if p != "" && !model.IsValidMetricName(model.LabelValue(p+"_info")) {
+			return nil, fmt.Errorf("invalid metric prefix %q", p)
+		}
+	}
+	if *metricPrefix == "" {
+		return nil, errors.New("--metric.prefix can't be empty")
+	}
+	var until time.Time
+	if *previousUntil != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, *previousUntil); err != nil {
+			if until, err = time.Parse(time.DateOnly, *previousUntil); err != nil {
+				return nil, fmt.Errorf("invalid --metric.previous-until %q: want a date such as 2026-12-31 or an RFC 3339 time", *previousUntil)
+			}
+		}
+	}
+	if *metricPrefix == "ecobee" && (*previousPrefix == "" || *previousPrefix == "ecobee") {
+		return nil, nil
+	}
+	renamed := pipeline.Prefix("ecobee", *metricPrefix, "")
+	both := pipeline.Prefix("ecobee", *metricPrefix, *previousPrefix)
+	return pipeline.TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		if *previousPrefix == "" || (!until.IsZero() && !time.Now().Before(until)) {
+			return renamed.Transform(mfs)
+		}
+		return both.Transform(mfs)
+	}), nil
+}
+
+// newClient returns an API client for the ecobee API, a cassette or the
+// demo home, depending on the command line flags. extra middleware is
+// added innermost, next to the transport's instrumentation.
+func newClient(extra ...client.Middleware) *client.Client {
+	return newAccountClient(flagAccount(), extra...)
+}
+
+// newAccountClient is newClient for the ecobee API account acct.
+func newAccountClient(acct account, extra ...client.Middleware) *client.Client {
+	// Wrap the API transport with throttling, a circuit breaker, retries,
+	// logging, rate limiting, the shared quota and instrumentation,
+	// outermost first, so that every attempt is logged, rate limited and
+	// charged to the quota, a request that fails after its retries counts
+	// once towards opening the circuit, and none are made while the API
+	// has asked to be left alone. Instrumentation is innermost so that it
+	// counts only the requests that reach the API and times them without
+	// the waits for the rate limit or the quota.
+	mws := []client.Middleware{client.Throttle(*throttlePause, acct.reg, "ecobee")}
+	if *circuitFailures > 0 {
+		mws = append(mws, client.CircuitBreaker(*circuitFailures, *circuitCooldown, acct.reg, "ecobee"))
+	}
+	if *apiRetries > 0 {
+		mws = append(mws, client.Retry(*apiRetries, time.Second))
+	}
+	mws = append(mws,
+		client.Logging(slog.Default()),
+		client.QuotaHeaders(acct.reg, "ecobee"),
+	)
+	if *apiMinInterval > 0 {
+		mws = append(mws, client.RateLimit(*apiMinInterval))
+	}
+	if *quotaRedis != "" {
+		budget := quota.New(redis.NewClient(&redis.Options{Addr: *quotaRedis}), *quotaKey, *quotaLimit, *quotaWindow, acct.reg, "ecobee")
+		mws = append(mws, budget.Middleware)
+	}
+	if *recordPath != "" {
+		record, err := cassette.Record(*recordPath)
+		if err != nil {
+			fatal(err)
+		}
+		mws = append(mws, record)
+	}
+	mws = append(mws, extra...)
+	authClient := http.DefaultClient
+	if slog.Default().Enabled(context.Background(), client.LevelTrace) {
+		trace := client.Trace(slog.Default(), *logTrace...)
+		mws = append(mws, trace)
+		authClient = &http.Client{Transport: client.Chain(http.DefaultTransport, trace)}
+	}
+	mws = append(mws, client.Instrument(acct.reg, "ecobee"))
+
+	switch {
+	case *replayPath != "":
+		player, err := cassette.Load(*replayPath)
+		if err != nil {
+			fatal(err)
+		}
+		slog.Info("Replaying API responses", "path", *replayPath)
+		return client.New(nil, client.WithTransport(player), client.WithMiddleware(mws...))
+	case *demoMode:
+		home := demo.New(clock.Real)
+		if *demoThermostats > 0 {
+			slog.Info("Serving a synthetic fleet", "thermostats", *demoThermostats, "sensors", *demoSensors)
+			home = demo.NewFleet(clock.Real, *demoThermostats, *demoSensors)
+		} else {
+			slog.Info("Serving synthetic demo data")
+		}
+		return client.New(nil, client.WithTransport(home.Transport()), client.WithMiddleware(mws...))
+	default:
+		ts := tokenstore.TokenSource(acct.appKey, tokenstore.NewFile(acct.cacheFile),
+			tokenstore.WithScopes(*authScope),
+			tokenstore.WithHTTPClient(authClient),
+		)
+		return client.New(ts, client.WithMiddleware(mws...))
+	}
+}
+
+// interrupted returns a channel that is closed once the process is asked
+// to terminate.
+func interrupted() <-chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		close(stop)
+	}()
+	return stop
+}
+
+// serve exposes metrics over HTTP until stop is closed.
+func serve(stop <-chan struct{}) {
+	prometheus.MustRegister(buildInfo())
+	reloader, cfg, err := newConfigReloader(*configFile, prometheus.DefaultRegisterer)
+	if err != nil {
+		fatal(err)
+	}
+	if *configFile != "" {
+		reloader.watch(stop)
+	}
+	accts, err := accounts(cfg)
+	if err != nil {
+		fatal(err)
+	}
+	if *accountPaths && accts[0].name == "" {
+		fatal(fmt.Errorf("--web.account-paths needs accounts in the configuration file"))
+	}
+	if *haRedis != "" && len(accts) > 1 {
+		fatal(fmt.Errorf("--ha.redis-address can't be used with several accounts"))
+	}
+	if *haRedis != "" && *pollInterval <= 0 {
+		fatal(fmt.Errorf("--ha.redis-address needs --poll.interval, for the leader to poll and publish its metrics"))
+	}
+	if *webConfigFile != "" {
+		if err := web.Validate(*webConfigFile); err != nil {
+			fatal(fmt.Errorf("invalid --web.config.file: %v", err))
+		}
+	}
+	var extra []client.Middleware
+	var last *lastResponse
+	if *debugLastResponse {
+		last = newLastResponse()
+		extra = append(extra, last.Middleware)
+	}
+	errs := &recentErrors{}
+	health := newHealth(*healthStaleAfter)
+	collectors := make([]*accountCollector, len(accts))
+	for i, acct := range accts {
+		a := &accountCollector{account: acct, client: newAccountClient(acct, extra...)}
+		// health and alerts are tracked per account, so that one account
+		// succeeding doesn't hide another failing
+		h := health.account(acct.name)
+		opts := []collector.Option{
+			collector.WithErrorHandler(errs.add),
+			collector.WithErrorHandler(h.error),
+			collector.WithResultHandler(h.result),
+			collector.WithResultHandler(func(r collector.Result) { a.busy.Store(r.Active) }),
+		}
+		if *alertWebhook != "" {
+			alerts := newAlerter(*alertWebhook, acct.name, *alertFailures)
+			opts = append(opts,
+				collector.WithErrorHandler(alerts.error),
+				collector.WithResultHandler(alerts.result),
+			)
+		}
+		a.collector, a.transforms = setupAccount(a.client, acct, cfg, reloader, opts...)
+		collectors[i] = a
+	}
+	// the exporter's own metrics, such as those of the API clients, are
+	// only renamed along with the ecobee metrics
+	own := prometheus.Gatherer(prometheus.DefaultGatherer)
+	rename, err := prefixTransform()
+	if err != nil {
+		fatal(err)
+	}
+	if rename != nil {
+		own = pipeline.New(own, rename)
+	}
+	// hooks of the exporter as a whole run when the first collector
+	// closes, while the others still work
+	first := collectors[0].collector
 
-	// Setup Scopes for API Requests
-	ecobee.Scopes = []string{"smartRead"}
+	var elector *leader.Elector
+	if *haRedis != "" {
+		elector = leader.New(redis.NewClient(&redis.Options{Addr: *haRedis}), *haKey, *haLease)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			elector.Run(ctx)
+			close(done)
+		}()
+		first.OnClose(func(context.Context) error {
+			cancel()
+			<-done
+			return nil
+		})
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ecobee_exporter_leader",
+			Help: "whether this replica holds the leader lease and polls the Ecobee API (0 or 1)",
+		}, func() float64 { return collector.Bool2Float[elector.IsLeader()] }))
+		health.elector = elector
+	}
 
-	//Create a new instance of the ecobeeCollector and
-	//register it with the prometheus client.
-	ecobeeCollector := collector.NewEcobeeCollector(ecobee.NewClient(*applicationKey, *cacheFile), "ecobee")
-	prometheus.MustRegister(ecobeeCollector)
+	if *pollInterval > 0 {
+		var active func() bool
+		if elector != nil {
+			active = elector.IsLeader
+		}
+		schedule := func(a *accountCollector) poller.Schedule {
+			return poller.Schedule{
+				Interval:     *pollInterval,
+				Jitter:       *pollJitter,
+				Align:        *pollAlign,
+				BusyInterval: *pollBusyInterval,
+				Busy:         a.busy.Load,
+			}
+		}
+		var opts []poller.Option
+		if elector != nil {
+			opts = append(opts, poller.WithPollHandler(publish(context.Background(), elector)))
+		}
+		for _, a := range collectors {
+			a.poll = poller.Start(a.collector, schedule(a), active, opts...)
+			a.collector.OnClose(a.poll.Close)
+			poll := a.poll
+			a.reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "ecobee_poll_age_seconds",
+				Help: "time since the latest background poll, which scrapes are served from, finished, 0 before the first",
+			}, func() float64 {
+				age, _ := poll.Age()
+				return age.Seconds()
+			}))
+		}
+		// reloads of the configuration file can change the poll flags
+		reloader.onReload(func() {
+			for _, a := range collectors {
+				a.poll.SetSchedule(schedule(a))
+			}
+		})
+	}
 
 	//This section will start the HTTP server and expose
 	//any metrics on the /metrics endpoint.
-	http.Handle("/metrics", promhttp.Handler())
-	log.Info("Beginning to serve on port " + *addr)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	var sinkList []sinks.Sink
+	if *textfilePath != "" {
+		sinkList = append(sinkList, sinks.NewTextfile(*textfilePath))
+	}
+	if *influxURL != "" {
+		var influx sinks.Sink = sinks.NewInflux(*influxURL, *influxToken)
+		if *sinkBufferFile != "" {
+			buf := sinks.NewBuffer(influx, *sinkBufferFile, int64(*sinkBufferSize))
+			prometheus.MustRegister(
+				prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+					Name: "ecobee_exporter_sink_buffer_bytes",
+					Help: "size of --sink.buffer-file, holding the metrics waiting to be pushed again",
+				}, func() float64 { return float64(buf.Size()) }),
+				prometheus.NewCounterFunc(prometheus.CounterOpts{
+					Name: "ecobee_exporter_sink_buffer_dropped_samples_total",
+					Help: "samples a push sink failed to accept that were dropped because --sink.buffer-file was full",
+				}, func() float64 { return float64(buf.Dropped()) }),
+			)
+			influx = buf
+		}
+		sinkList = append(sinkList, influx)
+	}
+	if len(sinkList) > 0 {
+		gatherers := prometheus.Gatherers{own}
+		for _, a := range collectors {
+			a := a
+			gatherers = append(gatherers, prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return a.gatherer(context.Background(), elector, true).Gather()
+			}))
+		}
+		runner := sinks.Start(gatherers, *sinkInterval, sinkList...)
+		first.OnClose(runner.Close)
+		health.runner = runner
+	}
+	if *accountPaths {
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer, metricsHandler(own, nil, false, elector),
+		))
+		for _, a := range collectors {
+			http.Handle("/metrics/"+a.name, requireBearer(a.bearerToken, metricsHandler(nil, []*accountCollector{a}, false, elector)))
+			http.Handle("/metrics/"+a.name+"/equipment", requireBearer(a.bearerToken, equipmentHandler([]*accountCollector{a}, false, elector)))
+			http.Handle("/probe/"+a.name, requireBearer(a.bearerToken, probeHandler([]*accountCollector{a}, false, elector)))
+		}
+	} else {
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer, metricsHandler(own, collectors, true, elector),
+		))
+		http.Handle("/metrics/equipment", equipmentHandler(collectors, true, elector))
+		http.Handle("/probe", probeHandler(collectors, true, elector))
+	}
+	http.Handle("/-/selftest", newSelfTest(collectors[0].client))
+	http.Handle("/-/errors", errs)
+	http.Handle("/healthz", health)
+	warm := make(chan struct{})
+	if *warmUp {
+		go func() {
+			for _, a := range collectors {
+				if a.poll != nil {
+					<-a.poll.Polled()
+				} else {
+					warmUpCollector(a.collector)
+				}
+			}
+			close(warm)
+		}()
+	} else {
+		close(warm)
+	}
+	http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-warm:
+		default:
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ready\n%s\n", errs.summary())
+	})
+	if last != nil {
+		http.Handle("/debug/last-response", last)
+	}
+	srv := &http.Server{Addr: *addr}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-stop
+		slog.Info("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("error shutting down http server", "error", err)
+		}
+		for _, a := range collectors {
+			if err := a.collector.Close(ctx); err != nil {
+				slog.Error("error closing collector", "account", a.name, "error", err)
+			}
+		}
+	}()
+	slog.Info("Beginning to serve", "address", *addr, "accounts", len(collectors))
+	if err := web.ListenAndServe(srv, *webConfigFile, kitLogger{}); err != http.ErrServerClosed {
+		fatal(err)
+	}
+	// ListenAndServe returns as soon as shutdown begins; wait for the
+	// collectors to close.
+	<-closed
+}
+
+// warmUpCollector collects once, discarding the metrics, so that the token
+// is refreshed, connections to the API are open and the snapshot is filled
+// before the first scrape.
+func warmUpCollector(c *collector.Collector) {
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	c.Collect(ch)
+	close(ch)
+	<-done
+	slog.Info("Warm-up fetch finished", "duration", time.Since(start))
+}
+
+// minScrapeTimeout is the least time a scrape is given to collect when the
+// scrape timeout Prometheus sends is no longer than
+// --scrape.timeout-offset, so that it still has a deadline.
+const minScrapeTimeout = 100 * time.Millisecond
+
+// metricsHandler serves the metrics of own, if not nil, along with the
+// ecobee metrics of accts, each after its account's transforms and
+// labelled with its account name if labelled, and then the transforms
+// only, collected within the scrape timeout Prometheus sends (less
+// --scrape.timeout-offset) or --scrape.timeout if it doesn't send one,
+// taken from the latest poll when polling in the background, or taken
+// from the leader if e is a standby.
+func metricsHandler(own prometheus.Gatherer, accts []*accountCollector, labelled bool, e *leader.Elector, only ...pipeline.Transformer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		timeout := *scrapeTimeout
+		if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+			if secs, err := strconv.ParseFloat(v, 64); err == nil {
+				timeout = max(time.Duration(secs*float64(time.Second))-*timeoutOffset, minScrapeTimeout)
+			}
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		var gs prometheus.Gatherers
+		if own != nil {
+			gs = append(gs, own)
+		}
+		for _, a := range accts {
+			gs = append(gs, a.gatherer(ctx, e, labelled))
+		}
+		g := pipeline.New(gs, only...)
+		promhttp.HandlerFor(g, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// probeHandler serves the metrics of the thermostat given by the
+// thermostat_id parameter, for scraping each thermostat as its own target.
+// Only that thermostat is fetched, and only metrics labelled with its ID
+// are served.
+func probeHandler(accts []*accountCollector, labelled bool, e *leader.Elector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("thermostat_id")
+		if id == "" {
+			http.Error(w, "missing thermostat_id parameter", http.StatusBadRequest)
+			return
+		}
+		r = r.WithContext(collector.ForThermostat(r.Context(), id))
+		metricsHandler(nil, accts, labelled, e, pipeline.Only("thermostat_id", id)).ServeHTTP(w, r)
+	})
+}
+
+// equipmentHandler serves the equipment metrics of accts, which only take
+// fetching the thermostat summary of each, after the account's transforms
+// and labelled with the account name if labelled. A standby serves none,
+// leaving the API to the leader.
+func equipmentHandler(accts []*accountCollector, labelled bool, e *leader.Elector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var gs prometheus.Gatherers
+		if e == nil || e.IsLeader() {
+			for _, a := range accts {
+				reg := prometheus.NewRegistry()
+				reg.MustRegister(a.collector.Equipment(r.Context()))
+				gs = append(gs, a.transformed(reg, labelled))
+			}
+		}
+		promhttp.HandlerFor(gs, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
 }
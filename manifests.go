@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// secretFlags are the flags whose values go in the Secret of the generated
+// manifests rather than in the Deployment's environment.
+var secretFlags = map[string]bool{"appkey": true, "sink.influx-token": true}
+
+// manifestEnv is an environment variable of the generated Deployment.
+type manifestEnv struct {
+	Name, Value string
+}
+
+// manifestConfig is the data of the manifests template.
+type manifestConfig struct {
+	Name, Namespace, Image, Monitor string
+	MonitorLabels                   map[string]string
+	Port                            string
+	CacheDir                        string
+	ConfigDir, ConfigName, Config   string
+	Env, Secret                     []manifestEnv
+	Interval, Timeout               string
+}
+
+var manifestsTemplate = template.Must(template.New("manifests").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+	},
+}).Parse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+type: Opaque
+stringData:
+{{- range .Secret}}
+  {{.Name}}: {{quote .Value}}
+{{- end}}
+{{- if .Config}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+data:
+  {{.ConfigName}}: |
+{{indent 4 .Config}}
+{{- end}}
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+spec:
+  accessModes:
+    - ReadWriteOnce
+  resources:
+    requests:
+      storage: 16Mi
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: {{.Name}}
+    spec:
+      containers:
+        - name: exporter
+          image: {{.Image}}
+          ports:
+            - name: http
+              containerPort: {{.Port}}
+          envFrom:
+            - secretRef:
+                name: {{.Name}}
+{{- if .Env}}
+          env:
+{{- range .Env}}
+            - name: {{.Name}}
+              value: {{quote .Value}}
+{{- end}}
+{{- end}}
+          readinessProbe:
+            httpGet:
+              path: /-/ready
+              port: http
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: http
+            periodSeconds: 30
+            timeoutSeconds: 10
+            failureThreshold: 3
+          volumeMounts:
+            - name: cache
+              mountPath: {{.CacheDir}}
+{{- if .Config}}
+            - name: config
+              mountPath: {{.ConfigDir}}
+              readOnly: true
+{{- end}}
+      volumes:
+        - name: cache
+          persistentVolumeClaim:
+            claimName: {{.Name}}
+{{- if .Config}}
+        - name: config
+          configMap:
+            name: {{.Name}}
+{{- end}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+spec:
+  selector:
+    app.kubernetes.io/name: {{.Name}}
+  ports:
+    - name: http
+      port: {{.Port}}
+      targetPort: http
+---
+apiVersion: monitoring.coreos.com/v1
+{{- if eq .Monitor "pod"}}
+kind: PodMonitor
+{{- else}}
+kind: ServiceMonitor
+{{- end}}
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: {{.Name}}
+{{- range $k, $v := .MonitorLabels}}
+    {{$k}}: {{quote $v}}
+{{- end}}
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{.Name}}
+{{- if eq .Monitor "pod"}}
+  podMetricsEndpoints:
+{{- else}}
+  endpoints:
+{{- end}}
+    - port: http
+      path: /metrics
+      interval: {{.Interval}}
+{{- if .Timeout}}
+      scrapeTimeout: {{.Timeout}}
+{{- end}}
+`))
+
+// manifests prints Kubernetes manifests for running the exporter with the
+// flags given to this command, and for the Prometheus Operator to scrape
+// it. Flags set on the command line or in the environment are passed to
+// the Deployment as environment variables, secrets through a Secret, and
+// the configuration file, if any, through a ConfigMap.
+func manifests(name, namespace, image, monitor string, monitorLabels map[string]string) {
+	_, port, err := net.SplitHostPort(*addr)
+	if err != nil {
+		fatal(fmt.Errorf("invalid --listen-address: %v", err))
+	}
+	if image == "" {
+		tag := Version
+		if tag == "dev" {
+			tag = "latest"
+		}
+		image = "billykwooten/ecobee-exporter:" + tag
+	}
+	mc := manifestConfig{
+		Name:          name,
+		Namespace:     namespace,
+		Image:         image,
+		Monitor:       monitor,
+		MonitorLabels: monitorLabels,
+		Port:          port,
+		CacheDir:      filepath.Dir(*cacheFile),
+		Secret:        []manifestEnv{{"ECOBEE_APPKEY", *applicationKey}},
+	}
+
+	// Scrape as often as the exporter polls the API; more often only
+	// serves the same poll again.
+	interval := time.Minute
+	if *pollInterval > 0 {
+		interval = *pollInterval
+	}
+	mc.Interval = model.Duration(interval).String()
+	if *scrapeTimeout > 0 && *scrapeTimeout < interval {
+		mc.Timeout = model.Duration(*scrapeTimeout).String()
+	}
+
+	if *configFile != "" {
+		b, err := os.ReadFile(*configFile)
+		if err != nil {
+			fatal(fmt.Errorf("error reading configuration file: %v", err))
+		}
+		mc.ConfigDir, mc.ConfigName, mc.Config = "/etc/ecobee-exporter", filepath.Base(*configFile), string(b)
+		mc.Env = append(mc.Env, manifestEnv{"ECOBEE_CONFIG_FILE", mc.ConfigDir + "/" + mc.ConfigName})
+	}
+
+	set, err := setFlags()
+	if err != nil {
+		fatal(err)
+	}
+	for _, f := range app.Model().Flags {
+		if !set[f.Name] || f.Envar == "" || f.Name == "appkey" || f.Name == "config.file" {
+			continue
+		}
+		e := manifestEnv{f.Envar, flagValue(f)}
+		if secretFlags[f.Name] {
+			mc.Secret = append(mc.Secret, e)
+		} else {
+			mc.Env = append(mc.Env, e)
+		}
+	}
+	sort.Slice(mc.Env, func(i, j int) bool { return mc.Env[i].Name < mc.Env[j].Name })
+
+	if err := manifestsTemplate.Execute(os.Stdout, mc); err != nil {
+		fatal(err)
+	}
+}
+
+// setFlags returns the names of the flags set on the command line or in
+// the environment, rather than left at their defaults.
+func setFlags() (map[string]bool, error) {
+	ctx, err := app.ParseContext(os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	for _, e := range ctx.Elements {
+		if f, ok := e.Clause.(*kingpin.FlagClause); ok {
+			set[f.Model().Name] = true
+		}
+	}
+	for _, f := range app.Model().Flags {
+		if _, ok := os.LookupEnv(f.Envar); ok && f.Envar != "" {
+			set[f.Name] = true
+		}
+	}
+	return set, nil
+}
+
+// flagValue returns the value of f in the form its environment variable
+// takes, with the values of repeatable flags on separate lines.
+func flagValue(f *kingpin.FlagModel) string {
+	g, ok := f.Value.(kingpin.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	if v := reflect.Indirect(reflect.ValueOf(g.Get())); v.Kind() == reflect.Slice {
+		vs := make([]string, v.Len())
+		for i := range vs {
+			vs[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(vs, "\n")
+	}
+	return f.Value.String()
+}
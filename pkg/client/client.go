@@ -0,0 +1,363 @@
+// Package client is a context-aware client for the read side of the ecobee
+// API.
+//
+// Requests pass through a chain of Middleware, which lets callers add
+// logging, instrumentation, retries, rate limiting or their own hooks
+// around every API call.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"golang.org/x/oauth2"
+)
+
+// DefaultBaseURL is the address of the ecobee API.
+const DefaultBaseURL = "https://api.ecobee.com"
+
+// Client makes requests to the ecobee API. It is safe for concurrent use.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+type options struct {
+	baseURL   string
+	transport http.RoundTripper
+	mws       []Middleware
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithBaseURL sends requests to u instead of DefaultBaseURL, for example to
+// talk to a mock server.
+func WithBaseURL(u string) Option {
+	return func(o *options) {
+		o.baseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithTransport sets the transport that ultimately carries requests. It
+// defaults to http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithMiddleware wraps mws around the transport, with the first middleware
+// being the outermost. Middleware see requests after authorization headers
+// have been added.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.mws = append(o.mws, mws...)
+	}
+}
+
+// New returns a Client that authorizes its requests with tokens from ts. If
+// ts is nil, requests are sent without authorization.
+func New(ts oauth2.TokenSource, opts ...Option) *Client {
+	o := options{
+		baseURL:   DefaultBaseURL,
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var rt http.RoundTripper = Chain(o.transport, o.mws...)
+	if ts != nil {
+		rt = &oauth2.Transport{Source: ts, Base: rt}
+	}
+	return &Client{http: &http.Client{Transport: rt}, baseURL: o.baseURL}
+}
+
+// Error is returned when the ecobee API responds with an error status.
+type Error struct {
+	// HTTPStatus is the HTTP status code of the response.
+	HTTPStatus int
+
+	// Code and Message are taken from the status object of the response
+	// body, if there was one.
+	Code    int
+	Message string
+}
+
+// ErrAuth matches, with errors.Is, the errors of requests the API rejected
+// for their authorization: an HTTP 401 or 403, or one of the ecobee status
+// codes 1, 14 and 16, for failed authentication and expired and revoked
+// tokens, which the API sends with an HTTP 500.
+var ErrAuth = errors.New("ecobee api authorization failed")
+
+// authCode reports whether code is an ecobee status code of failed
+// authorization.
+func authCode(code int) bool {
+	return code == 1 || code == 14 || code == 16
+}
+
+// Is reports whether e is an ErrAuth.
+func (e *Error) Is(target error) bool {
+	return target == ErrAuth && (e.HTTPStatus == http.StatusUnauthorized || e.HTTPStatus == http.StatusForbidden || authCode(e.Code))
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("invalid server response: %d %s", e.HTTPStatus, http.StatusText(e.HTTPStatus))
+	}
+	return fmt.Sprintf("api error %d: %s", e.Code, e.Message)
+}
+
+type getThermostatsRequest struct {
+	Selection ecobee.Selection `json:"selection"`
+	Page      *pageRequest     `json:"page,omitempty"`
+}
+
+type pageRequest struct {
+	Page int `json:"page"`
+}
+
+type getThermostatsResponse struct {
+	Page           ecobee.Page   `json:"page"`
+	ThermostatList []Thermostat  `json:"thermostatList"`
+	Status         ecobee.Status `json:"status"`
+}
+
+// GetThermostats returns the thermostats matching sel, fetching every page
+// of results.
+func (c *Client) GetThermostats(ctx context.Context, sel ecobee.Selection) ([]Thermostat, error) {
+	var tt []Thermostat
+	for page := 1; ; page++ {
+		req := getThermostatsRequest{Selection: sel}
+		if page > 1 {
+			req.Page = &pageRequest{Page: page}
+		}
+		var r getThermostatsResponse
+		if err := c.Get(ctx, "/1/thermostat", &req, &r); err != nil {
+			return nil, fmt.Errorf("error fetching thermostats: %w", err)
+		}
+		tt = append(tt, r.ThermostatList...)
+		if r.Page.TotalPages <= page {
+			return tt, nil
+		}
+	}
+}
+
+type getThermostatSummaryRequest struct {
+	Selection ecobee.Selection `json:"selection"`
+}
+
+type getThermostatSummaryResponse struct {
+	RevisionList    []string      `json:"revisionList"`
+	ThermostatCount int           `json:"thermostatCount"`
+	StatusList      []string      `json:"statusList"`
+	Status          ecobee.Status `json:"status"`
+}
+
+// GetThermostatSummary returns the revisions, connectivity and, if
+// requested by sel, equipment status of the thermostats matching sel, keyed
+// by thermostat identifier.
+func (c *Client) GetThermostatSummary(ctx context.Context, sel ecobee.Selection) (map[string]ecobee.ThermostatSummary, error) {
+	var r getThermostatSummaryResponse
+	if err := c.Get(ctx, "/1/thermostatSummary", &getThermostatSummaryRequest{Selection: sel}, &r); err != nil {
+		return nil, fmt.Errorf("error fetching thermostat summary: %w", err)
+	}
+
+	statuses := make(map[string]ecobee.EquipmentStatus, len(r.StatusList))
+	for _, s := range r.StatusList {
+		id, es := parseEquipmentStatus(s)
+		statuses[id] = es
+	}
+
+	tsm := make(map[string]ecobee.ThermostatSummary, len(r.RevisionList))
+	for _, rev := range r.RevisionList {
+		rl := strings.Split(rev, ":")
+		if len(rl) < 7 {
+			return nil, fmt.Errorf("invalid revision list, not enough fields: %s", rev)
+		}
+		connected, err := strconv.ParseBool(rl[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision list connected field: %v", err)
+		}
+		tsm[rl[0]] = ecobee.ThermostatSummary{
+			Identifier:         rl[0],
+			Name:               rl[1],
+			Connected:          connected,
+			ThermostatRevision: rl[3],
+			AlertsRevision:     rl[4],
+			RuntimeRevision:    rl[5],
+			IntervalRevision:   rl[6],
+			EquipmentStatus:    statuses[rl[0]],
+		}
+	}
+	return tsm, nil
+}
+
+type getGroupsRequest struct {
+	Selection ecobee.Selection `json:"selection"`
+}
+
+type getGroupsResponse struct {
+	Groups []Group       `json:"groups"`
+	Status ecobee.Status `json:"status"`
+}
+
+// GetGroups returns the thermostat groups of the account, with the
+// identifiers of the thermostats in each.
+func (c *Client) GetGroups(ctx context.Context) ([]Group, error) {
+	var r getGroupsResponse
+	req := getGroupsRequest{Selection: ecobee.Selection{SelectionType: "registered"}}
+	if err := c.Get(ctx, "/1/group", &req, &r); err != nil {
+		return nil, fmt.Errorf("error fetching groups: %w", err)
+	}
+	return r.Groups, nil
+}
+
+type hierarchyRequest struct {
+	Operation string `json:"operation"`
+	SetPath   string `json:"setPath"`
+	Recursive bool   `json:"recursive"`
+}
+
+type getManagementSetsResponse struct {
+	Sets   []ManagementSet `json:"sets"`
+	Status ecobee.Status   `json:"status"`
+}
+
+// GetManagementSets returns the sets at and below path in the management
+// hierarchy of an EMS account. Sets below the ones returned are nested in
+// their Children.
+func (c *Client) GetManagementSets(ctx context.Context, path string) ([]ManagementSet, error) {
+	var r getManagementSetsResponse
+	req := hierarchyRequest{Operation: "list", SetPath: path, Recursive: true}
+	if err := c.Get(ctx, "/1/hierarchy/set", &req, &r); err != nil {
+		return nil, fmt.Errorf("error fetching management sets: %w", err)
+	}
+	return r.Sets, nil
+}
+
+type getManagementPrivilegesResponse struct {
+	Privileges []Privilege   `json:"privileges"`
+	Status     ecobee.Status `json:"status"`
+}
+
+// GetManagementPrivileges returns the privileges users of an EMS account
+// have on the sets at and below path in its management hierarchy.
+func (c *Client) GetManagementPrivileges(ctx context.Context, path string) ([]Privilege, error) {
+	var r getManagementPrivilegesResponse
+	req := hierarchyRequest{Operation: "list", SetPath: path, Recursive: true}
+	if err := c.Get(ctx, "/1/hierarchy/user", &req, &r); err != nil {
+		return nil, fmt.Errorf("error fetching management users: %w", err)
+	}
+	return r.Privileges, nil
+}
+
+type getRuntimeReportRequest struct {
+	Selection ecobee.Selection `json:"selection"`
+	StartDate string           `json:"startDate"`
+	EndDate   string           `json:"endDate"`
+	Columns   string           `json:"columns"`
+}
+
+type getRuntimeReportResponse struct {
+	ReportList []RuntimeReport `json:"reportList"`
+	Status     ecobee.Status   `json:"status"`
+}
+
+// GetRuntimeReport returns the runtime history of columns, such as "fan",
+// of the thermostats in ids, from the start of startDate to the end of
+// endDate in the thermostats' local time, both of the form "2006-01-02".
+// The API allows up to 25 thermostats and 31 days per report.
+func (c *Client) GetRuntimeReport(ctx context.Context, ids, columns []string, startDate, endDate string) ([]RuntimeReport, error) {
+	var r getRuntimeReportResponse
+	req := getRuntimeReportRequest{
+		Selection: ecobee.Selection{SelectionType: "thermostats", SelectionMatch: strings.Join(ids, ",")},
+		StartDate: startDate,
+		EndDate:   endDate,
+		Columns:   strings.Join(columns, ","),
+	}
+	if err := c.Get(ctx, "/1/runtimeReport", &req, &r); err != nil {
+		return nil, fmt.Errorf("error fetching runtime report: %w", err)
+	}
+	return r.ReportList, nil
+}
+
+// parseEquipmentStatus parses a status list entry of the form
+// "identifier:equipment1,equipment2".
+func parseEquipmentStatus(s string) (string, ecobee.EquipmentStatus) {
+	var es ecobee.EquipmentStatus
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		return parts[0], es
+	}
+	for _, e := range strings.Split(parts[1], ",") {
+		es.Set(e, true)
+	}
+	return parts[0], es
+}
+
+// Get sends req, encoded as JSON, to the API endpoint at path and decodes
+// the response body into resp. It returns an *Error if the API reports a
+// failure.
+func (c *Client) Get(ctx context.Context, path string, req, resp interface{}) error {
+	body, err := c.GetRaw(ctx, path, req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("error unmarshalling json: %v", err)
+	}
+	var s struct {
+		Status ecobee.Status `json:"status"`
+	}
+	if err := json.Unmarshal(body, &s); err == nil && s.Status.Code != 0 {
+		return &Error{HTTPStatus: http.StatusOK, Code: s.Status.Code, Message: s.Status.Message}
+	}
+	return nil
+}
+
+// GetRaw sends req, encoded as JSON, to the API endpoint at path and
+// returns the undecoded response body.
+func (c *Client) GetRaw(ctx context.Context, path string, req interface{}) ([]byte, error) {
+	j, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling json: %v", err)
+	}
+	u := c.baseURL + path + "?" + url.Values{"json": {string(j)}}.Encode()
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json;charset=UTF-8")
+
+	resp, err := c.http.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{HTTPStatus: resp.StatusCode}
+		var s struct {
+			Status ecobee.Status `json:"status"`
+		}
+		if json.Unmarshal(body, &s) == nil {
+			e.Code, e.Message = s.Status.Code, s.Status.Message
+		}
+		return nil, e
+	}
+	return body, nil
+}
@@ -0,0 +1,539 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+// Middleware wraps an http.RoundTripper with additional behavior such as
+// logging, retries or rate limiting.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r).
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Chain wraps rt in mws. The first middleware is the outermost, so it sees
+// each request first and each response last.
+func Chain(rt http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	for i := len(mws) - 1; i >= 0; i-- {
+		rt = mws[i](rt)
+	}
+	return rt
+}
+
+// LevelTrace is the slog level below debug used by Trace.
+const LevelTrace = slog.LevelDebug - 4
+
+// Logging logs every request and its outcome at debug level.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			l := logger.With(
+				"method", r.Method,
+				"path", r.URL.Path,
+				"duration", time.Since(start),
+			)
+			if err != nil {
+				l.DebugContext(r.Context(), "ecobee api request failed", "error", err)
+				return nil, err
+			}
+			l.DebugContext(r.Context(), "ecobee api request", "status", resp.StatusCode)
+			return resp, nil
+		})
+	}
+}
+
+// secretParams are query parameters and JSON keys holding credentials.
+var secretParams = []string{"client_id", "code", "access_token", "refresh_token"}
+
+var secretJSON = regexp.MustCompile(`"(client_id|code|access_token|refresh_token)"(\s*:\s*)"[^"]*"`)
+
+// Trace logs the full URL, headers and response body of requests at
+// LevelTrace, with API keys and tokens replaced by REDACTED. If endpoints are
+// given, only requests whose final path element is one of them are
+// logged, such as "thermostat" or "token".
+func Trace(logger *slog.Logger, endpoints ...string) Middleware {
+	traced := func(p string) bool {
+		if len(endpoints) == 0 {
+			return true
+		}
+		for _, e := range endpoints {
+			if path.Base(p) == e {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if !traced(r.URL.Path) || !logger.Enabled(r.Context(), LevelTrace) {
+				return next.RoundTrip(r)
+			}
+			u := *r.URL
+			q := u.Query()
+			for _, p := range secretParams {
+				if q.Get(p) != "" {
+					q.Set(p, "REDACTED")
+				}
+			}
+			u.RawQuery = q.Encode()
+			header := r.Header.Clone()
+			if header.Get("Authorization") != "" {
+				header.Set("Authorization", "REDACTED")
+			}
+			l := logger.With(
+				"method", r.Method,
+				"url", u.String(),
+				"header", header,
+			)
+
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				l.Log(r.Context(), LevelTrace, "ecobee api request failed", "error", err)
+				return nil, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			l.Log(r.Context(), LevelTrace, "ecobee api response",
+				"status", resp.StatusCode,
+				"body", string(secretJSON.ReplaceAll(body, []byte(`"$1"$2"REDACTED"`))),
+			)
+			return resp, nil
+		})
+	}
+}
+
+// Retry retries idempotent requests that fail with a transport error or a
+// 429 or 5xx response, up to attempts additional times, unless the
+// response says when to retry in Retry-After or is an ecobee authorization
+// failure, which retrying doesn't fix. The delay between attempts
+// starts at backoff and doubles after each attempt.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return retry(attempts, backoff, clock.Real)
+}
+
+func retry(attempts int, backoff time.Duration, clk clock.Clock) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return next.RoundTrip(r)
+			}
+			delay := backoff
+			for i := 0; ; i++ {
+				resp, err := next.RoundTrip(r)
+				if i >= attempts || !retryable(resp, err) {
+					return resp, err
+				}
+				if _, ok := retryAfter(resp, clk.Now()); ok {
+					// the API said when to come back; leave it to Throttle
+					return resp, err
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+				select {
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				case <-clk.After(delay):
+				}
+				delay *= 2
+			}
+		})
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 && !authFailure(resp)
+}
+
+// authFailure reports whether resp carries the ecobee status code of an
+// authorization failure, such as an expired token, which the API sends
+// with an HTTP 500. It leaves the body to be read again.
+func authFailure(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	var s struct {
+		Status struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	return json.Unmarshal(body, &s) == nil && authCode(s.Status.Code)
+}
+
+// RateLimit spaces requests at least interval apart. Requests that would
+// exceed the limit wait for their turn or until their context is done.
+func RateLimit(interval time.Duration) Middleware {
+	var (
+		mu   sync.Mutex
+		next time.Time
+	)
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			now := time.Now()
+			if next.Before(now) {
+				next = now
+			}
+			wait := next.Sub(now)
+			next = next.Add(interval)
+			mu.Unlock()
+
+			if wait > 0 {
+				t := time.NewTimer(wait)
+				defer t.Stop()
+				select {
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+				case <-t.C:
+				}
+			}
+			return rt.RoundTrip(r)
+		})
+	}
+}
+
+// Instrument records request counts and latencies as Prometheus metrics
+// with the given prefix, registering them with reg. Latencies are labelled
+// with the API endpoint requested, such as thermostat, thermostatSummary or
+// runtimeReport, to tell which of them is slow.
+func Instrument(reg prometheus.Registerer, metricPrefix string) Middleware {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: fmt.Sprintf("%s_api_requests_total", metricPrefix),
+		Help: "requests made to the Ecobee API by status code and method",
+	}, []string{"code", "method"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: fmt.Sprintf("%s_api_request_duration_seconds", metricPrefix),
+		Help: "latency of requests made to the Ecobee API by method and endpoint",
+	}, []string{"method", "endpoint"})
+	reg.MustRegister(requests, duration)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		timed := RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			if err == nil {
+				duration.WithLabelValues(strings.ToLower(r.Method), endpoint(r.URL.Path)).Observe(time.Since(start).Seconds())
+			}
+			return resp, err
+		})
+		return promhttp.InstrumentRoundTripperCounter(requests, timed)
+	}
+}
+
+// endpoint returns the API endpoint of a request path, the part after the
+// API version, such as thermostat for /1/thermostat.
+func endpoint(p string) string {
+	if _, e, ok := strings.Cut(p, "/1/"); ok {
+		return e
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// ErrCircuitOpen is returned by requests rejected by CircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit open: too many consecutive Ecobee API failures")
+
+// Circuit breaker states, as exported by CircuitBreaker.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops sending requests after failures consecutive ones
+// fail with a transport error or a 429 or 5xx response, rejecting them with
+// ErrCircuitOpen instead. After cooldown, one request is let through: if it
+// succeeds, the circuit closes again, and if not, it stays open for another
+// cooldown. Requests canceled by their context and authorization failures
+// count as neither successes nor failures, so that the latter are reported
+// as such rather than as an open circuit. The state is exported as a
+// Prometheus metric with the given prefix, registered with reg.
+func CircuitBreaker(failures int, cooldown time.Duration, reg prometheus.Registerer, metricPrefix string) Middleware {
+	return circuitBreaker(failures, cooldown, reg, metricPrefix, clock.Real)
+}
+
+func circuitBreaker(failures int, cooldown time.Duration, reg prometheus.Registerer, metricPrefix string, clk clock.Clock) Middleware {
+	state := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: fmt.Sprintf("%s_api_circuit_state", metricPrefix),
+		Help: "state of the circuit breaker for the Ecobee API, 1 for the current state and 0 for the others",
+	}, []string{"state"})
+	reg.MustRegister(state)
+
+	var (
+		mu      sync.Mutex
+		current string
+		failed  int
+		retryAt time.Time
+	)
+	set := func(s string) {
+		current = s
+		for _, l := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+			state.WithLabelValues(l).Set(boolFloat(l == s))
+		}
+	}
+	set(circuitClosed)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			switch {
+			case current == circuitHalfOpen, current == circuitOpen && clk.Now().Before(retryAt):
+				mu.Unlock()
+				return nil, ErrCircuitOpen
+			case current == circuitOpen:
+				set(circuitHalfOpen)
+			}
+			mu.Unlock()
+
+			resp, err := next.RoundTrip(r)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil && r.Context().Err() != nil:
+				// the trial request was abandoned; let the next one try
+				if current == circuitHalfOpen {
+					set(circuitOpen)
+				}
+			case retryable(resp, err):
+				failed++
+				if current == circuitHalfOpen || failed >= failures {
+					set(circuitOpen)
+					retryAt = clk.Now().Add(cooldown)
+				}
+			case resp.StatusCode >= 500 && authFailure(resp):
+				// says nothing of the API's health either way; a trial
+				// leaves the next request to try again
+				if current == circuitHalfOpen {
+					set(circuitOpen)
+				}
+			default:
+				failed = 0
+				set(circuitClosed)
+			}
+			return resp, err
+		})
+	}
+}
+
+// ErrThrottled is returned by requests rejected by Throttle.
+var ErrThrottled = errors.New("throttled by the Ecobee API")
+
+// Throttle pauses requests after a 429 or 503 response, such as when the
+// API is rate limiting or down for maintenance, until the time given by its
+// Retry-After header, or for fallback if it has none, rejecting them with
+// ErrThrottled instead. Whether requests are paused, and until when, is
+// exported as Prometheus metrics with the given prefix, registered with
+// reg.
+func Throttle(fallback time.Duration, reg prometheus.Registerer, metricPrefix string) Middleware {
+	return throttle(fallback, reg, metricPrefix, clock.Real)
+}
+
+func throttle(fallback time.Duration, reg prometheus.Registerer, metricPrefix string, clk clock.Clock) Middleware {
+	var (
+		mu    sync.Mutex
+		until time.Time
+	)
+	reg.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: fmt.Sprintf("%s_api_throttled", metricPrefix),
+			Help: "whether requests to the Ecobee API are paused after a throttled or unavailable response (0 or 1)",
+		}, func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return boolFloat(clk.Now().Before(until))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: fmt.Sprintf("%s_api_next_allowed_fetch_timestamp_seconds", metricPrefix),
+			Help: "time after which requests to the Ecobee API may be made again, as of the last throttled or unavailable response",
+		}, func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			if until.IsZero() {
+				return 0
+			}
+			return float64(until.UnixNano()) / 1e9
+		}),
+	)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			resume := until
+			mu.Unlock()
+			if clk.Now().Before(resume) {
+				return nil, fmt.Errorf("%w until %s", ErrThrottled, resume.Format(time.RFC3339))
+			}
+
+			resp, err := next.RoundTrip(r)
+			if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+				return resp, err
+			}
+			now := clk.Now()
+			wait, ok := retryAfter(resp, now)
+			if !ok {
+				wait = fallback
+			}
+			if wait > 0 {
+				mu.Lock()
+				if t := now.Add(wait); t.After(until) {
+					until = t
+				}
+				mu.Unlock()
+			}
+			return resp, err
+		})
+	}
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// QuotaHeaders exports the rate limit headers of API responses, if the API
+// sends them, as Prometheus metrics with the given prefix, registered with
+// reg: X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset, and
+// Retry-After on throttled or unavailable responses. Each metric is only
+// exported once a response has carried its header.
+func QuotaHeaders(reg prometheus.Registerer, metricPrefix string) Middleware {
+	q := &quotaHeaders{
+		limit: prometheus.NewDesc(
+			fmt.Sprintf("%s_api_ratelimit_limit", metricPrefix),
+			"request limit reported by the Ecobee API in X-RateLimit-Limit",
+			nil, nil,
+		),
+		remaining: prometheus.NewDesc(
+			fmt.Sprintf("%s_api_ratelimit_remaining", metricPrefix),
+			"requests left reported by the Ecobee API in X-RateLimit-Remaining",
+			nil, nil,
+		),
+		reset: prometheus.NewDesc(
+			fmt.Sprintf("%s_api_ratelimit_reset_seconds", metricPrefix),
+			"seconds until the request limit resets reported by the Ecobee API in X-RateLimit-Reset, as of the last response",
+			nil, nil,
+		),
+		retryAfter: prometheus.NewDesc(
+			fmt.Sprintf("%s_api_retry_after_seconds", metricPrefix),
+			"seconds to wait before retrying reported by the Ecobee API in Retry-After, as of the last throttled response",
+			nil, nil,
+		),
+		values: make(map[*prometheus.Desc]float64),
+	}
+	reg.MustRegister(q)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(r)
+			if err == nil {
+				q.record(resp)
+			}
+			return resp, err
+		})
+	}
+}
+
+type quotaHeaders struct {
+	limit, remaining, reset, retryAfter *prometheus.Desc
+
+	mu     sync.Mutex
+	values map[*prometheus.Desc]float64
+}
+
+func (q *quotaHeaders) record(resp *http.Response) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for desc, h := range map[*prometheus.Desc]string{
+		q.limit:     "X-RateLimit-Limit",
+		q.remaining: "X-RateLimit-Remaining",
+		q.reset:     "X-RateLimit-Reset",
+	} {
+		if v, err := strconv.ParseFloat(resp.Header.Get(h), 64); err == nil {
+			if desc == q.reset && v > 1e9 {
+				// a Unix timestamp rather than a number of seconds
+				v = time.Until(time.Unix(int64(v), 0)).Seconds()
+			}
+			q.values[desc] = v
+		}
+	}
+	if d, ok := retryAfter(resp, time.Now()); ok {
+		q.values[q.retryAfter] = d.Seconds()
+	}
+}
+
+// retryAfter returns the time to wait before retrying given by the
+// Retry-After header of a throttled or unavailable response, if it has one.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), now)
+}
+
+// parseRetryAfter parses a Retry-After header, either a number of seconds
+// or an HTTP date, which is made relative to now.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+func (q *quotaHeaders) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.limit
+	ch <- q.remaining
+	ch <- q.reset
+	ch <- q.retryAfter
+}
+
+func (q *quotaHeaders) Collect(ch chan<- prometheus.Metric) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for desc, v := range q.values {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+}
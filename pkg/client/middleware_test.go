@@ -0,0 +1,393 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+// respond returns a transport answering every request with status and
+// body, counting the requests in n.
+func respond(n *int, status int, body string) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		*n++
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+}
+
+// replies returns a transport answering the requests with statuses in
+// turn, then with the last one, counting the requests in n. A Retry-After
+// header is set to retryAfter on 429 and 503 responses if it isn't empty.
+func replies(n *int, retryAfter string, statuses ...int) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		status := statuses[len(statuses)-1]
+		if *n < len(statuses) {
+			status = statuses[*n]
+		}
+		*n++
+		h := http.Header{}
+		if retryAfter != "" && (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) {
+			h.Set("Retry-After", retryAfter)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     h,
+			Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+			Request:    r,
+		}, nil
+	})
+}
+
+func get(t *testing.T, rt http.RoundTripper) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "https://api.ecobee.com/1/thermostat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt.RoundTrip(req)
+}
+
+var now = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+const (
+	expiredBody = `{"status":{"code":14,"message":"Authentication token has expired."}}`
+	serverBody  = `{"status":{"code":3,"message":"Processing error."}}`
+)
+
+func TestRetryAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		requests int
+	}{
+		{"expired token", http.StatusInternalServerError, expiredBody, 1},
+		{"deauthorized token", http.StatusInternalServerError, `{"status":{"code":16}}`, 1},
+		{"processing error", http.StatusInternalServerError, serverBody, 3},
+		{"ok", http.StatusOK, `{}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int
+			rt := Retry(2, time.Millisecond)(respond(&n, tt.status, tt.body))
+			req, _ := http.NewRequest(http.MethodGet, "https://api.ecobee.com/1/thermostat", nil)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := ioutil.ReadAll(resp.Body); string(b) != tt.body {
+				t.Errorf("body %q, want %q", b, tt.body)
+			}
+			if n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerAuth(t *testing.T) {
+	var n int
+	rt := CircuitBreaker(2, time.Hour, prometheus.NewRegistry(), "test")(respond(&n, http.StatusInternalServerError, expiredBody))
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.ecobee.com/1/thermostat", nil)
+		if _, err := rt.RoundTrip(req); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("circuit opened after %d authorization failures", i)
+		}
+	}
+}
+
+func TestErrorIsAuth(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		auth bool
+	}{
+		{&Error{HTTPStatus: http.StatusInternalServerError, Code: 14}, true},
+		{&Error{HTTPStatus: http.StatusInternalServerError, Code: 16}, true},
+		{&Error{HTTPStatus: http.StatusOK, Code: 1}, true},
+		{&Error{HTTPStatus: http.StatusUnauthorized}, true},
+		{&Error{HTTPStatus: http.StatusInternalServerError, Code: 3}, false},
+		{&Error{HTTPStatus: http.StatusTooManyRequests}, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, ErrAuth); got != tt.auth {
+			t.Errorf("errors.Is(%v, ErrAuth) = %t, want %t", tt.err, got, tt.auth)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		waits      []time.Duration // before each retry
+		status     int
+	}{
+		{"success", []int{200}, "", nil, 200},
+		{"not found", []int{404}, "", nil, 404},
+		{"recovers", []int{500, 502, 200}, "", []time.Duration{time.Second, 2 * time.Second}, 200},
+		{"gives up", []int{503}, "", []time.Duration{time.Second, 2 * time.Second}, 503},
+		{"throttled", []int{429, 200}, "", []time.Duration{time.Second}, 200},
+		{"retry after", []int{429, 200}, "30", nil, 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(now)
+			var n int
+			rt := retry(2, time.Second, clk)(replies(&n, tt.retryAfter, tt.statuses...))
+			done := make(chan *http.Response, 1)
+			go func() {
+				resp, err := get(t, rt)
+				if err != nil {
+					t.Error(err)
+				}
+				done <- resp
+			}()
+			for _, wait := range tt.waits {
+				clk.BlockUntil(1)
+				clk.Advance(wait - time.Millisecond)
+				select {
+				case <-done:
+					t.Fatalf("returned %v before the backoff", wait)
+				case <-time.After(10 * time.Millisecond):
+				}
+				clk.Advance(time.Millisecond)
+			}
+			resp := <-done
+			if resp == nil {
+				return
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if n != len(tt.waits)+1 {
+				t.Errorf("%d requests, want %d", n, len(tt.waits)+1)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	clk := clock.NewFake(now)
+	var n int
+	rt := retry(2, time.Second, clk)(replies(&n, "", 500))
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.ecobee.com/1/thermostat", nil)
+	done := make(chan error, 1)
+	go func() {
+		_, err := rt.RoundTrip(req)
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		open    bool   // whether the request is rejected
+		state   string // afterwards
+	}
+	tests := []struct {
+		name     string
+		statuses []int
+		steps    []step
+	}{
+		{
+			name:     "closed",
+			statuses: []int{500, 200, 500, 200},
+			steps: []step{
+				{0, false, circuitClosed},
+				{0, false, circuitClosed},
+				{0, false, circuitClosed},
+				{0, false, circuitClosed},
+			},
+		},
+		{
+			name:     "opens and recovers",
+			statuses: []int{500, 500, 200},
+			steps: []step{
+				{0, false, circuitClosed},
+				{0, false, circuitOpen},
+				{0, true, circuitOpen},
+				{time.Minute - time.Second, true, circuitOpen},
+				{time.Second, false, circuitClosed},
+				{0, false, circuitClosed},
+			},
+		},
+		{
+			name:     "trial fails",
+			statuses: []int{500, 429, 500, 200},
+			steps: []step{
+				{0, false, circuitClosed},
+				{0, false, circuitOpen},
+				{time.Minute, false, circuitOpen},
+				{0, true, circuitOpen},
+				{time.Minute, false, circuitClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(now)
+			reg := prometheus.NewRegistry()
+			var n int
+			rt := circuitBreaker(2, time.Minute, reg, "test", clk)(replies(&n, "", tt.statuses...))
+			for i, s := range tt.steps {
+				clk.Advance(s.advance)
+				_, err := get(t, rt)
+				if open := errors.Is(err, ErrCircuitOpen); open != s.open {
+					t.Fatalf("step %d: rejected %t, want %t", i, open, s.open)
+				}
+				for _, l := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+					want := 0.0
+					if l == s.state {
+						want = 1
+					}
+					if got := gathered(t, reg, "test_api_circuit_state", l); got != want {
+						t.Fatalf("step %d: state %s is %v, want %v", i, l, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerAuthNeutral(t *testing.T) {
+	const auth = 0 // an authorization failure
+	tests := []struct {
+		name     string
+		statuses []int
+		advance  []time.Duration // before each request
+		states   []string        // after each request
+	}{
+		{
+			name:     "keeps failures",
+			statuses: []int{500, auth, 500},
+			advance:  []time.Duration{0, 0, 0},
+			states:   []string{circuitClosed, circuitClosed, circuitOpen},
+		},
+		{
+			name:     "trial",
+			statuses: []int{500, 500, auth, 200},
+			advance:  []time.Duration{0, 0, time.Minute, 0},
+			states:   []string{circuitClosed, circuitOpen, circuitOpen, circuitClosed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(now)
+			reg := prometheus.NewRegistry()
+			var n int
+			rt := circuitBreaker(2, time.Minute, reg, "test", clk)(RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				status, body := tt.statuses[n], `{}`
+				if status == auth {
+					status, body = http.StatusInternalServerError, expiredBody
+				}
+				n++
+				return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body)), Request: r}, nil
+			}))
+			for i, state := range tt.states {
+				clk.Advance(tt.advance[i])
+				if _, err := get(t, rt); errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("request %d rejected", i)
+				}
+				if got := gathered(t, reg, "test_api_circuit_state", state); got != 1 {
+					t.Fatalf("request %d: state %s is %v, want 1", i, state, got)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		paused     time.Duration
+	}{
+		{"ok", 200, "", 0},
+		{"server error", 500, "", 0},
+		{"throttled", 429, "", time.Minute},
+		{"unavailable", 503, "", time.Minute},
+		{"retry after seconds", 429, "30", 30 * time.Second},
+		{"retry after date", 503, now.Add(2 * time.Minute).Format(http.TimeFormat), 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(now)
+			reg := prometheus.NewRegistry()
+			var n int
+			rt := throttle(time.Minute, reg, "test", clk)(replies(&n, tt.retryAfter, tt.status, 200))
+			if _, err := get(t, rt); err != nil {
+				t.Fatal(err)
+			}
+			if tt.paused > 0 {
+				clk.Advance(tt.paused - time.Second)
+				if _, err := get(t, rt); !errors.Is(err, ErrThrottled) {
+					t.Fatalf("error %v before the pause ended, want %v", err, ErrThrottled)
+				}
+				want := float64(now.Add(tt.paused).Unix())
+				if got := gathered(t, reg, "test_api_next_allowed_fetch_timestamp_seconds"); got != want {
+					t.Errorf("next allowed fetch %v, want %v", got, want)
+				}
+				if got := gathered(t, reg, "test_api_throttled"); got != 1 {
+					t.Errorf("throttled %v, want 1", got)
+				}
+				clk.Advance(time.Second)
+			}
+			if _, err := get(t, rt); err != nil {
+				t.Fatalf("error %v after the pause", err)
+			}
+			if got := gathered(t, reg, "test_api_throttled"); got != 0 {
+				t.Errorf("throttled %v, want 0", got)
+			}
+			if n != 2 {
+				t.Errorf("%d requests, want 2", n)
+			}
+		})
+	}
+}
+
+// gathered returns the value of the gauge name in reg with the label
+// values.
+func gathered(t *testing.T, reg *prometheus.Registry, name string, values ...string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			for i, lp := range m.GetLabel() {
+				if lp.GetValue() != values[i] {
+					continue metrics
+				}
+			}
+			return m.GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("no %s%q", name, values)
+	return 0
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+)
+
+// Thermostat is an ecobee thermostat object. Only the objects requested in
+// the selection are populated.
+type Thermostat struct {
+	Identifier      string                 `json:"identifier"`
+	Name            string                 `json:"name"`
+	ThermostatRev   string                 `json:"thermostatRev"`
+	IsRegistered    bool                   `json:"isRegistered"`
+	ModelNumber     string                 `json:"modelNumber"`
+	Brand           string                 `json:"brand"`
+	Features        string                 `json:"features"`
+	LastModified    string                 `json:"lastModified"`
+	ThermostatTime  string                 `json:"thermostatTime"`
+	UtcTime         string                 `json:"utcTime"`
+	Settings        Settings               `json:"settings"`
+	Runtime         Runtime                `json:"runtime"`
+	ExtendedRuntime ecobee.ExtendedRuntime `json:"extendedRuntime"`
+	Events          []ecobee.Event         `json:"events"`
+	Program         ecobee.Program         `json:"program"`
+	RemoteSensors   []ecobee.RemoteSensor  `json:"remoteSensors"`
+	Weather         ecobee.Weather         `json:"weather"`
+	Audio           *Audio                 `json:"audio"`
+	Alerts          []Alert                `json:"alerts"`
+
+	NotificationSettings *NotificationSettings `json:"notificationSettings"`
+
+	// Raw is the thermostat object as sent by the API, including fields
+	// not represented above.
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes a thermostat object, retaining a copy of it in Raw.
+func (t *Thermostat) UnmarshalJSON(b []byte) error {
+	type plain Thermostat
+	if err := json.Unmarshal(b, (*plain)(t)); err != nil {
+		return err
+	}
+	t.Raw = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// Settings holds the thermostat's configuration. Temperatures are in
+// tenths of a degree Fahrenheit.
+type Settings struct {
+	HvacMode         string `json:"hvacMode"`
+	HeatRangeHigh    int    `json:"heatRangeHigh"`
+	HeatRangeLow     int    `json:"heatRangeLow"`
+	CoolRangeHigh    int    `json:"coolRangeHigh"`
+	CoolRangeLow     int    `json:"coolRangeLow"`
+	HeatCoolMinDelta int    `json:"heatCoolMinDelta"`
+
+	// Alert thresholds. Humidity thresholds are in percent, -1 when the
+	// alert is disabled.
+	ColdTempAlert        int  `json:"coldTempAlert"`
+	ColdTempAlertEnabled bool `json:"coldTempAlertEnabled"`
+	HotTempAlert         int  `json:"hotTempAlert"`
+	HotTempAlertEnabled  bool `json:"hotTempAlertEnabled"`
+	HumidityHighAlert    int  `json:"humidityHighAlert"`
+	HumidityLowAlert     int  `json:"humidityLowAlert"`
+
+	// Humidity control. HumidifierMode is "auto", "manual" or "off", and
+	// DehumidifierMode "on" or "off"; the setpoints are in Runtime.
+	HasHumidifier    bool   `json:"hasHumidifier"`
+	HasDehumidifier  bool   `json:"hasDehumidifier"`
+	HumidifierMode   string `json:"humidifierMode"`
+	DehumidifierMode string `json:"dehumidifierMode"`
+
+	// Display settings. Intensities range from 0 to 10.
+	BacklightOnIntensity    int  `json:"backlightOnIntensity"`
+	BacklightSleepIntensity int  `json:"backlightSleepIntensity"`
+	BacklightOffDuringSleep bool `json:"backlightOffDuringSleep"`
+}
+
+// Audio holds the speaker and microphone settings of thermostats that have
+// them.
+type Audio struct {
+	PlaybackVolume    int           `json:"playbackVolume"`
+	MicrophoneEnabled bool          `json:"microphoneEnabled"`
+	SoundAlertVolume  int           `json:"soundAlertVolume"`
+	SoundTickVolume   int           `json:"soundTickVolume"`
+	VoiceEngines      []VoiceEngine `json:"voiceEngines"`
+}
+
+// VoiceEngine is a voice assistant built into the thermostat, such as
+// "alexa".
+type VoiceEngine struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Alert is an alert or reminder raised by the thermostat that hasn't been
+// acknowledged. Severity is "high", "medium" or "low", and
+// NotificationType what it is about, such as "lowTemp", "furnaceFilter",
+// or "alert" for faults of the equipment or sensors. Date and Time are
+// when it was raised, in the thermostat's local time.
+type Alert struct {
+	AlertNumber      int    `json:"alertNumber"`
+	AlertType        string `json:"alertType"`
+	NotificationType string `json:"notificationType"`
+	Severity         string `json:"severity"`
+	Text             string `json:"text"`
+	Date             string `json:"date"`
+	Time             string `json:"time"`
+	IsOperatorAlert  bool   `json:"isOperatorAlert"`
+	Reminder         bool   `json:"reminder"`
+}
+
+// NotificationSettings holds the thermostat's alert and reminder
+// configuration.
+type NotificationSettings struct {
+	Equipment []EquipmentNotification `json:"equipment"`
+}
+
+// EquipmentNotification configures the maintenance reminder of a piece of
+// equipment. For the "hvac" type, which reminds to change the filter,
+// FilterLastChanged is the date the filter was last changed, of the form
+// "2006-01-02", and FilterLife how long it lasts in FilterLifeUnits, such
+// as "month" or "hour".
+type EquipmentNotification struct {
+	Type              string `json:"type"`
+	Enabled           bool   `json:"enabled"`
+	FilterLastChanged string `json:"filterLastChanged"`
+	FilterLife        int    `json:"filterLife"`
+	FilterLifeUnits   string `json:"filterLifeUnits"`
+	RemindMeDate      string `json:"remindMeDate"`
+}
+
+// Runtime holds the thermostat's current state as last reported to ecobee.
+// Temperatures are in tenths of a degree Fahrenheit.
+type Runtime struct {
+	RuntimeRev         string `json:"runtimeRev"`
+	Connected          bool   `json:"connected"`
+	FirstConnected     string `json:"firstConnected"`
+	ConnectDateTime    string `json:"connectDateTime"`
+	DisconnectDateTime string `json:"disconnectDateTime"`
+	LastModified       string `json:"lastModified"`
+	LastStatusModified string `json:"lastStatusModified"`
+	RuntimeDate        string `json:"runtimeDate"`
+	RuntimeInterval    int    `json:"runtimeInterval"`
+	ActualTemperature  int    `json:"actualTemperature"`
+	RawTemperature     int    `json:"rawTemperature"`
+	ActualHumidity     int    `json:"actualHumidity"`
+	DesiredHeat        int    `json:"desiredHeat"`
+	DesiredCool        int    `json:"desiredCool"`
+	DesiredHumidity    int    `json:"desiredHumidity"`
+	DesiredDehumidity  int    `json:"desiredDehumidity"`
+	DesiredFanMode     string `json:"desiredFanMode"`
+	DesiredHeatRange   []int  `json:"desiredHeatRange"`
+	DesiredCoolRange   []int  `json:"desiredCoolRange"`
+}
+
+// Group is an ecobee thermostat group, which shares settings between the
+// thermostats in it.
+type Group struct {
+	GroupRef    string   `json:"groupRef"`
+	GroupName   string   `json:"groupName"`
+	Thermostats []string `json:"thermostats"`
+}
+
+// ManagementSet is a set in the management hierarchy of an EMS (ecobee
+// Management System) account, such as a building or a floor of one.
+type ManagementSet struct {
+	SetName     string          `json:"setName"`
+	SetPath     string          `json:"setPath"`
+	ParentPath  string          `json:"parentPath"`
+	Children    []ManagementSet `json:"children"`
+	Thermostats []string        `json:"thermostats"`
+}
+
+// Privilege grants a user of an EMS account access to a set of the
+// management hierarchy and the sets below it.
+type Privilege struct {
+	UserName string `json:"userName"`
+	SetPath  string `json:"setPath"`
+}
+
+// RuntimeReport is the runtime history of a thermostat, with a row for
+// each five-minute interval of the form "2006-01-02,15:04:05,value,...",
+// holding the value of each requested column, or nothing where the
+// thermostat reported no data.
+type RuntimeReport struct {
+	ThermostatIdentifier string   `json:"thermostatIdentifier"`
+	RowCount             int      `json:"rowCount"`
+	RowList              []string `json:"rowList"`
+}
@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		after   time.Duration
+		advance []time.Duration
+		fired   bool
+	}{
+		{"immediate", 0, nil, true},
+		{"negative", -time.Second, nil, true},
+		{"not yet", time.Minute, []time.Duration{59 * time.Second}, false},
+		{"exactly", time.Minute, []time.Duration{time.Minute}, true},
+		{"in steps", time.Minute, []time.Duration{30 * time.Second, 30 * time.Second}, true},
+		{"past", time.Minute, []time.Duration{time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFake(start)
+			ch := f.After(tt.after)
+			var elapsed time.Duration
+			for _, d := range tt.advance {
+				f.Advance(d)
+				elapsed += d
+			}
+			if got := f.Since(start); got != elapsed {
+				t.Errorf("Since = %v, want %v", got, elapsed)
+			}
+			select {
+			case at := <-ch:
+				if !tt.fired {
+					t.Fatal("fired early")
+				}
+				if !at.Equal(f.Now()) {
+					t.Errorf("fired with %v, want %v", at, f.Now())
+				}
+			default:
+				if tt.fired {
+					t.Fatal("didn't fire")
+				}
+			}
+		})
+	}
+}
+
+func TestFakeSet(t *testing.T) {
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	soon, later := f.After(time.Minute), f.After(time.Hour)
+	f.Set(start.Add(10 * time.Minute))
+	select {
+	case <-soon:
+	default:
+		t.Error("After(1m) didn't fire 10m later")
+	}
+	select {
+	case <-later:
+		t.Error("After(1h) fired 10m later")
+	default:
+	}
+	// BlockUntil returns at once for the waiter still pending
+	f.BlockUntil(1)
+}
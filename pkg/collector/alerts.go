@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// WithAlerts exports the number of alerts and reminders each thermostat
+// has raised that haven't been acknowledged, by severity and type, as
+// alerts, and when each of its enabled maintenance reminders, such as for
+// its filter or UV lamp, is next due, as
+// filter_reminder_timestamp_seconds.
+func WithAlerts() Option {
+	return func(c *Collector) {
+		c.selection.IncludeAlerts = true
+		c.selection.IncludeNotificationSettings = true
+		c.alerts = true
+	}
+}
+
+// collectAlerts exports the alerts and maintenance reminders of t.
+func (c *Collector) collectAlerts(ch chan<- prometheus.Metric, t client.Thermostat) {
+	type key struct{ severity, typ string }
+	counts := map[key]int{}
+	var keys []key
+	for _, a := range t.Alerts {
+		k := key{a.Severity, a.NotificationType}
+		if k.typ == "" {
+			k.typ = a.AlertType
+		}
+		if counts[k] == 0 {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	for _, k := range keys {
+		ch <- prometheus.MustNewConstMetric(c.alertCount, prometheus.GaugeValue, float64(counts[k]), t.Identifier, t.Name, k.severity, k.typ)
+	}
+
+	if t.NotificationSettings == nil {
+		return
+	}
+	loc, ok := Location(t)
+	if !ok {
+		loc = time.UTC
+	}
+	for _, e := range t.NotificationSettings.Equipment {
+		if due, ok := reminderDue(e, loc); ok {
+			ch <- prometheus.MustNewConstMetric(c.filterReminder, prometheus.GaugeValue, float64(due.Unix()), t.Identifier, t.Name, e.Type)
+		}
+	}
+}
+
+// reminderDue returns when the maintenance reminder e is next due, at the
+// start of the day in loc: its remind me date if it is snoozed, or else
+// its life in months after it was last changed. Reminders whose life is
+// in hours of runtime have no due date.
+func reminderDue(e client.EquipmentNotification, loc *time.Location) (time.Time, bool) {
+	if !e.Enabled {
+		return time.Time{}, false
+	}
+	if e.RemindMeDate != "" {
+		due, err := time.ParseInLocation("2006-01-02", e.RemindMeDate, loc)
+		return due, err == nil
+	}
+	if e.FilterLastChanged == "" || e.FilterLife <= 0 || e.FilterLifeUnits != "month" {
+		return time.Time{}, false
+	}
+	changed, err := time.ParseInLocation("2006-01-02", e.FilterLastChanged, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return changed.AddDate(0, e.FilterLife, 0), true
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// Heating stages, the values of the stage label of
+// heat_pump_runtime_seconds_total.
+const (
+	// HeatingCompressor is a heat pump's compressor heating.
+	HeatingCompressor = "compressor"
+
+	// HeatingAux is auxiliary heat, such as resistive strips.
+	HeatingAux = "aux"
+)
+
+// balanceMaxGap is the longest time between two collections of a
+// thermostat that is credited to its heating. Longer gaps, such as while
+// the exporter was down, say nothing of what ran in between.
+const balanceMaxGap = 30 * time.Minute
+
+// WithBalancePoint counts how long each thermostat's heat pump compressor
+// and auxiliary heat run in bands of outdoor temperature bandWidth degrees
+// wide, as heat_pump_runtime_seconds_total, so that the outdoor temperature
+// below which the heat pump can't keep up, its balance point, can be read
+// from how the runtime shifts from the compressor to auxiliary heat. The
+// time between two collections is credited to the equipment running, and
+// the outdoor temperature, at the first of them.
+func WithBalancePoint(bandWidth float64) Option {
+	return func(c *Collector) {
+		c.balance = &balance{bandWidth: bandWidth, byID: make(map[string]heating)}
+	}
+}
+
+type balance struct {
+	bandWidth float64
+
+	mu   sync.Mutex
+	byID map[string]heating
+}
+
+// heating is what was heating a thermostat's space at a collection, and
+// the outdoor temperature band it was in.
+type heating struct {
+	at              time.Time
+	band            string
+	compressor, aux bool
+}
+
+// collectBalance credits the time since t was last collected to the
+// heating then running, and records what is running now.
+func (c *Collector) collectBalance(t client.Thermostat, es ecobee.EquipmentStatus, outdoor float64) {
+	b := c.balance
+	now := heating{
+		at:         c.clock.Now(),
+		band:       strconv.FormatFloat(math.Floor(outdoor/b.bandWidth)*b.bandWidth, 'f', -1, 64),
+		compressor: es.HeatPump || es.HeatPump2 || es.HeatPump3,
+		aux:        es.AuxHeat1 || es.AuxHeat2 || es.AuxHeat3,
+	}
+	b.mu.Lock()
+	prev, ok := b.byID[t.Identifier]
+	b.byID[t.Identifier] = now
+	b.mu.Unlock()
+
+	elapsed := now.at.Sub(prev.at)
+	if !ok || !(prev.compressor || prev.aux) || elapsed <= 0 || elapsed > balanceMaxGap {
+		return
+	}
+	// both stages start at zero in every band heated in, so that their
+	// shares of its runtime can be compared
+	compressor := c.heatPumpRuntime.with(t.Identifier, t.Name, HeatingCompressor, prev.band)
+	aux := c.heatPumpRuntime.with(t.Identifier, t.Name, HeatingAux, prev.band)
+	if prev.compressor {
+		compressor.Add(elapsed.Seconds())
+	}
+	if prev.aux {
+		aux.Add(elapsed.Seconds())
+	}
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+	"github.com/joeshaw/ecobee-exporter/pkg/mockapi"
+)
+
+func TestCollectBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      string        // thermostat whose requests fail
+		deadline  time.Duration // from the start, if set
+		requests  []int         // thermostats per request
+		collected int
+		partial   bool
+	}{
+		{
+			name:      "batched",
+			requests:  []int{25, 5},
+			collected: 30,
+		},
+		{
+			name:      "failed batch",
+			fail:      "107",
+			requests:  append(append([]int{25}, ones(25)...), 5),
+			collected: 29,
+			partial:   true,
+		},
+		{
+			name:      "deadline",
+			deadline:  90 * time.Minute,
+			requests:  []int{25},
+			collected: 25,
+			partial:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fixtures mockapi.Static
+			for i := 0; i < 30; i++ {
+				id := fmt.Sprint(100 + i)
+				fixtures = append(fixtures, mockapi.Fixture{Thermostat: client.Thermostat{
+					Identifier: id,
+					Name:       "Thermostat " + id,
+					Runtime:    client.Runtime{Connected: true},
+				}})
+			}
+			// each thermostat request takes an hour
+			clk := clock.NewFake(time.Now())
+			api := mockapi.Transport(mockapi.NewHandler(fixtures))
+			var requests []int
+			rt := client.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if r.URL.Path != "/1/thermostat" {
+					return api.RoundTrip(r)
+				}
+				var req struct {
+					Selection ecobee.Selection `json:"selection"`
+				}
+				if err := json.Unmarshal([]byte(r.URL.Query().Get("json")), &req); err != nil {
+					t.Fatal(err)
+				}
+				ids := strings.Split(req.Selection.SelectionMatch, ",")
+				requests = append(requests, len(ids))
+				clk.Advance(time.Hour)
+				for _, id := range ids {
+					if id == tt.fail {
+						return &http.Response{
+							StatusCode: http.StatusInternalServerError,
+							Body:       io.NopCloser(strings.NewReader(`{"status":{"code":3,"message":"Processing error."}}`)),
+							Request:    r,
+						}, nil
+					}
+				}
+				return api.RoundTrip(r)
+			})
+			var result Result
+			c := NewEcobeeCollector(client.New(nil, client.WithTransport(rt)), "ecobee",
+				WithClock(clk),
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithResultHandler(func(r Result) { result = r }),
+			)
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, clk.Now().Add(tt.deadline))
+				defer cancel()
+			}
+			ch := make(chan prometheus.Metric, 1024)
+			go func() {
+				c.CollectContext(ctx, ch)
+				close(ch)
+			}()
+			for range ch {
+			}
+			if fmt.Sprint(requests) != fmt.Sprint(tt.requests) {
+				t.Errorf("requested %v thermostats, want %v", requests, tt.requests)
+			}
+			if result.Thermostats != tt.collected || result.Partial != tt.partial {
+				t.Errorf("collected %d thermostats (partial %t), want %d (partial %t)", result.Thermostats, result.Partial, tt.collected, tt.partial)
+			}
+		})
+	}
+}
+
+// ones returns n ones, the sizes of n requests for a single thermostat.
+func ones(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = 1
+	}
+	return s
+}
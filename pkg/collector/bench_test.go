@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/internal/demo"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+// fleet returns a collector of a simulated fleet of 20 thermostats with 5
+// remote sensors each.
+func fleet(opts ...Option) (*Collector, *demo.Home) {
+	home := demo.NewFleet(clock.NewFake(time.Date(2021, 1, 15, 14, 0, 0, 0, time.UTC)), 20, 5)
+	c := client.New(nil, client.WithTransport(home.Transport()))
+	opts = append([]Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	return NewEcobeeCollector(c, "ecobee", opts...), home
+}
+
+// drain collects from c and discards the metrics.
+func drain(c prometheus.Collector) {
+	ch := make(chan prometheus.Metric, 1024)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+}
+
+// BenchmarkCollect measures a whole collection, including decoding the API
+// responses.
+func BenchmarkCollect(b *testing.B) {
+	c, _ := fleet()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		drain(c)
+	}
+}
+
+// BenchmarkCollectUnchanged measures a collection in which change
+// detection skips every thermostat fetch.
+func BenchmarkCollectUnchanged(b *testing.B) {
+	c, _ := fleet(WithChangeDetection())
+	drain(c)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		drain(c)
+	}
+}
+
+// BenchmarkCollectThermostat measures building the metrics of fetched
+// thermostats, without the API.
+func BenchmarkCollectThermostat(b *testing.B) {
+	c, home := fleet()
+	fs := home.Fixtures()
+	ctx := context.Background()
+	ch := make(chan prometheus.Metric, 1024)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range fs {
+			c.collectThermostat(ctx, ch, f.Thermostat, equipmentStatus(f.Equipment))
+		}
+	}
+	b.StopTimer()
+	close(ch)
+	<-done
+}
+
+func equipmentStatus(equipment []string) ecobee.EquipmentStatus {
+	var es ecobee.EquipmentStatus
+	for _, e := range equipment {
+		es.Set(e, true)
+	}
+	return es
+}
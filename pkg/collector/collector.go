@@ -0,0 +1,1416 @@
+// Package collector provides a Prometheus collector for ecobee thermostat
+// and sensor metrics.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxBatch is the most thermostats the API returns in one request.
+const maxBatch = 25
+
+// descs names a Collector's metrics with its prefix, recording the names
+// without it.
+type descs struct {
+	prefix string
+	names  map[string]bool
+}
+
+func (d *descs) new(fqName, help string, variableLabels []string) *prometheus.Desc {
+	return prometheus.NewDesc(d.name(fqName), help, variableLabels, nil)
+}
+
+func (d *descs) name(name string) string {
+	d.names[name] = true
+	return d.prefix + "_" + name
+}
+
+// Collector implements prometheus.Collector to gather ecobee metrics on-demand.
+type Collector struct {
+	client           *client.Client
+	clock            clock.Clock
+	logger           *slog.Logger
+	onError          []func(*Error)
+	onResult         []func(Result)
+	descs            *descs
+	selection        ecobee.Selection
+	summary          ecobee.Selection
+	timeout          time.Duration
+	keep             func(id string) bool
+	maxSensors       int
+	inUseOnly        bool
+	exportFetchTime  bool
+	intervals        bool
+	risk             *risk
+	conflicts        *conflicts
+	snapshot         *snapshot
+	revisions        *revisions
+	groups           *groups
+	hierarchy        *hierarchy
+	filterRuntime    *filterRuntime
+	thermal          *thermalModels
+	balance          *balance
+	equipmentRuntime *equipmentRuntime
+	alerts           bool
+	weather          *weatherFallback
+	setpoints        setpoints
+	clockSkews       clockSkews
+	fetchDurations   fetchDurations
+	occupancies      occupancies
+	defined          []definedMetric
+	lifecycle        lifecycle
+
+	// per-query descriptors
+	fetchTime, partialScrape, thermostatFetchDuration *prometheus.Desc
+	scrapeSuccess, lastSuccessfulScrape               *prometheus.Desc
+
+	// lastSuccess is the Unix time in nanoseconds of the end of the last
+	// successful collection.
+	lastSuccess atomic.Int64
+
+	// snapshot descriptors
+	cacheAge *prometheus.Desc
+
+	// summary descriptors
+	connected, thermostatsDiscovered, equipmentConflict *prometheus.Desc
+
+	// connectivity descriptors
+	lastStatusModified *prometheus.Desc
+
+	// group descriptors
+	groupInfo *prometheus.Desc
+
+	// management hierarchy descriptors
+	setInfo, setThermostats, setConnected, setEquipmentRunning, setUsers *prometheus.Desc
+
+	// runtime descriptors
+	actualTemperature, rawTemperature, targetTemperatureMin, targetTemperatureMax, currentFanMode, equipmentRunning *prometheus.Desc
+
+	// extended runtime descriptors
+	intervalTemperature, intervalHumidity, intervalTargetMin, intervalTargetMax *prometheus.Desc
+
+	// settings descriptors
+	heatRangeHigh, heatRangeLow, coolRangeHigh, coolRangeLow, heatCoolMinDelta     *prometheus.Desc
+	temperatureAlertLow, temperatureAlertHigh, humidityAlertLow, humidityAlertHigh *prometheus.Desc
+	hardwareSettings                                                               *prometheus.Desc
+	desiredHumidity, desiredDehumidity, humidifierMode, dehumidifierMode           *prometheus.Desc
+
+	// weather descriptors
+	outdoorTemperature, outdoorHumidity             *prometheus.Desc
+	outdoorPressure, outdoorWindSpeed               *prometheus.Desc
+	forecastTemperatureHigh, forecastTemperatureLow *prometheus.Desc
+
+	// local time descriptors
+	utcOffset, clockSkew, nextTransition *prometheus.Desc
+
+	// program descriptors
+	programClimate, programTargetMin, programTargetMax *prometheus.Desc
+
+	// event descriptors
+	demandResponse, eventRunning *prometheus.Desc
+
+	// alert descriptors
+	alertCount, filterReminder *prometheus.Desc
+
+	// runtime report descriptors
+	fanRuntimeSinceFilterChange *prometheus.Desc
+
+	// sensor descriptors
+	temperature, humidity, occupancy, contactOpen, inUse, currentHvacMode *prometheus.Desc
+	ambientLight, relayOn, sensorsDiscovered                              *prometheus.Desc
+
+	// comfort descriptors, derived from temperature and humidity
+	dewPoint, heatIndex, thermostatDewPoint, thermostatHeatIndex *prometheus.Desc
+
+	// risk descriptors
+	moldRisk, frostRisk *prometheus.Desc
+
+	// thermal model descriptors
+	heatLoss, timeConstant, thermalSamples *prometheus.Desc
+
+	// sensor aggregate descriptors
+	temperatureMean, temperatureMin, temperatureMax *prometheus.Desc
+
+	// unparsedCapabilities counts sensor capabilities that couldn't be
+	// exported; loggedCapabilities holds the types already logged.
+	unparsedCapabilities *prometheus.CounterVec
+	loggedCapabilities   sync.Map
+
+	// setpointChanges counts setpoint changes by cause.
+	setpointChanges *series
+
+	// occupancyTransitions counts occupancy transitions of sensors.
+	occupancyTransitions *series
+
+	// heatPumpRuntime counts heating runtime by stage and outdoor
+	// temperature band.
+	heatPumpRuntime *series
+
+	// equipmentRuntimeSeconds counts equipment runtime from the extended
+	// runtime.
+	equipmentRuntimeSeconds *series
+
+	// truncatedSensors counts sensors dropped by WithSensorLimit.
+	truncatedSensors prometheus.Counter
+
+	// skippedFetches counts fetches avoided by WithChangeDetection.
+	skippedFetches prometheus.Counter
+
+	// scrapeErrors counts the errors of collections by stage.
+	scrapeErrors *prometheus.CounterVec
+}
+
+// NewEcobeeCollector returns a new Collector with the given prefix assigned to all
+// metrics. Note that Prometheus metrics must be unique! Don't try to create
+// two Collectors with the same metric prefix.
+func NewEcobeeCollector(c *client.Client, metricPrefix string, opts ...Option) *Collector {
+	d := &descs{prefix: metricPrefix, names: make(map[string]bool)}
+
+	// fields common across multiple metrics
+	runtime := []string{"thermostat_id", "thermostat_name"}
+	sensor := append(runtime, "sensor_id", "sensor_name", "sensor_type")
+
+	ec := &Collector{
+		client:         c,
+		clock:          clock.Real,
+		logger:         slog.Default(),
+		descs:          d,
+		setpoints:      setpoints{byID: make(map[string]setpoint)},
+		clockSkews:     clockSkews{byID: make(map[string]float64)},
+		fetchDurations: fetchDurations{byID: make(map[string]float64)},
+		occupancies:    occupancies{bySensor: make(map[string]bool)},
+		selection: ecobee.Selection{
+			SelectionType:   "registered",
+			IncludeSensors:  true,
+			IncludeRuntime:  true,
+			IncludeSettings: true,
+			IncludeEvents:   true,
+			IncludeAudio:    true,
+			IncludeProgram:  true,
+			IncludeWeather:  true,
+		},
+		summary: ecobee.Selection{
+			SelectionType:          "registered",
+			IncludeEquipmentStatus: true,
+		},
+
+		// collector metrics
+		fetchTime: d.new(
+			"fetch_time",
+			"elapsed time fetching data via Ecobee API",
+			nil,
+		),
+		thermostatFetchDuration: d.new(
+			"thermostat_fetch_duration_seconds",
+			"elapsed time of the last fetch of a thermostat's details via Ecobee API",
+			[]string{"thermostat_id"},
+		),
+		partialScrape: d.new(
+			"partial_scrape",
+			"whether some thermostats were skipped or failed to fetch (0 or 1)",
+			nil,
+		),
+		scrapeSuccess: d.new(
+			"scrape_success",
+			"whether the last collection fetched every thermostat without any errors (0 or 1)",
+			nil,
+		),
+		lastSuccessfulScrape: d.new(
+			"last_successful_scrape_timestamp_seconds",
+			"when the last successful collection ended, 0 if none has",
+			nil,
+		),
+		cacheAge: d.new(
+			"cache_age_seconds",
+			"age of the data exported for a thermostat, non-zero when it failed to fetch and was taken from the snapshot",
+			runtime,
+		),
+
+		// summary metrics
+		connected: d.new(
+			"connected",
+			"whether the thermostat is connected to the Ecobee servers (0 or 1)",
+			runtime,
+		),
+		equipmentConflict: d.new(
+			"equipment_conflict",
+			"whether equipment that shouldn't run together has for longer than the grace period (0 or 1)",
+			append(runtime, "conflict"),
+		),
+		thermostatsDiscovered: d.new(
+			"thermostats_discovered",
+			"number of thermostats found on the account, of those the exporter collects",
+			nil,
+		),
+
+		// group metrics
+		groupInfo: d.new(
+			"thermostat_group_info",
+			"ecobee group of a thermostat, with a constant value of 1",
+			append(runtime, "group"),
+		),
+
+		// management hierarchy metrics
+		setInfo: d.new(
+			"thermostat_set_info",
+			"management set of a thermostat in an EMS account, with a constant value of 1",
+			append(runtime, "set_path"),
+		),
+		setThermostats: d.new(
+			"set_thermostats",
+			"number of thermostats in a management set and the sets below it",
+			[]string{"set_path"},
+		),
+		setConnected: d.new(
+			"set_connected_thermostats",
+			"number of connected thermostats in a management set and the sets below it",
+			[]string{"set_path"},
+		),
+		setEquipmentRunning: d.new(
+			"set_equipment_running",
+			"number of thermostats in a management set and the sets below it running a piece of equipment",
+			[]string{"set_path", "equipment"},
+		),
+		setUsers: d.new(
+			"set_users",
+			"number of users with privileges on a management set",
+			[]string{"set_path"},
+		),
+
+		// thermostat (aka runtime) metrics
+		lastStatusModified: d.new(
+			"last_status_modified_timestamp_seconds",
+			"when a thermostat last reported its status to the Ecobee servers, as a Unix timestamp",
+			runtime,
+		),
+		actualTemperature: d.new(
+			"actual_temperature",
+			"thermostat-averaged current temperature",
+			runtime,
+		),
+		rawTemperature: d.new(
+			"raw_temperature",
+			"thermostat-averaged current temperature before the temperature correction setting is applied",
+			runtime,
+		),
+		targetTemperatureMax: d.new(
+			"target_temperature_max",
+			"maximum temperature for thermostat to maintain",
+			runtime,
+		),
+		targetTemperatureMin: d.new(
+			"target_temperature_min",
+			"minimum temperature for thermostat to maintain",
+			runtime,
+		),
+
+		// extended runtime metrics
+		intervalTemperature: d.new(
+			"interval_temperature",
+			"thermostat-averaged temperature of a 5-minute interval, timestamped with its end",
+			append(runtime, IntervalLabel),
+		),
+		intervalHumidity: d.new(
+			"interval_humidity",
+			"thermostat-averaged humidity in percent of a 5-minute interval, timestamped with its end",
+			append(runtime, IntervalLabel),
+		),
+		intervalTargetMin: d.new(
+			"interval_target_temperature_min",
+			"minimum temperature for thermostat to maintain during a 5-minute interval, timestamped with its end",
+			append(runtime, IntervalLabel),
+		),
+		intervalTargetMax: d.new(
+			"interval_target_temperature_max",
+			"maximum temperature for thermostat to maintain during a 5-minute interval, timestamped with its end",
+			append(runtime, IntervalLabel),
+		),
+
+		// sensor metrics
+		temperature: d.new(
+			"temperature",
+			"temperature reported by a sensor in degrees",
+			sensor,
+		),
+		humidity: d.new(
+			"humidity",
+			"humidity reported by a sensor in percent",
+			sensor,
+		),
+		occupancy: d.new(
+			"occupancy",
+			"occupancy reported by a sensor (0 or 1)",
+			sensor,
+		),
+		contactOpen: d.new(
+			"contact_open",
+			"whether the door or window of a contact sensor is open (0 or 1)",
+			sensor,
+		),
+		ambientLight: d.new(
+			"ambient_light_lux",
+			"ambient light reported by a sensor, such as that of a Switch+, in lux",
+			sensor,
+		),
+		relayOn: d.new(
+			"relay_on",
+			"whether the relay of a Switch+ is on (0 or 1)",
+			sensor,
+		),
+		inUse: d.new(
+			"in_use",
+			"is sensor being used in thermostat calculations (0 or 1)",
+			sensor,
+		),
+		sensorsDiscovered: d.new(
+			"sensors_discovered",
+			"number of sensors found on a thermostat, including its own",
+			[]string{"thermostat_id"},
+		),
+		dewPoint: d.new(
+			"dew_point",
+			"dew point in degrees derived from the temperature and humidity reported by a sensor",
+			sensor,
+		),
+		heatIndex: d.new(
+			"heat_index",
+			"heat index in degrees derived from the temperature and humidity reported by a sensor",
+			sensor,
+		),
+		thermostatDewPoint: d.new(
+			"thermostat_dew_point",
+			"dew point in degrees derived from the thermostat-averaged temperature and humidity",
+			runtime,
+		),
+		thermostatHeatIndex: d.new(
+			"thermostat_heat_index",
+			"heat index in degrees derived from the thermostat-averaged temperature and humidity",
+			runtime,
+		),
+		moldRisk: d.new(
+			"mold_risk",
+			"whether a sensor has been damp and cool enough for long enough to risk mold (0 or 1)",
+			sensor,
+		),
+		frostRisk: d.new(
+			"frost_risk",
+			"whether a sensor is cold enough to risk frost, such as frozen pipes (0 or 1)",
+			sensor,
+		),
+		heatLoss: d.new(
+			"thermal_heat_loss_coefficient",
+			"fraction of the indoor-outdoor temperature difference a thermostat's space loses per hour while idle, fitted by the thermal model",
+			runtime,
+		),
+		timeConstant: d.new(
+			"thermal_time_constant_seconds",
+			"time a thermostat's space takes to close about 63% of the indoor-outdoor temperature difference while idle, fitted by the thermal model",
+			runtime,
+		),
+		thermalSamples: d.new(
+			"thermal_model_samples",
+			"number of idle intervals the thermal model of a thermostat is fitted to, weighed by age",
+			runtime,
+		),
+		temperatureMean: d.new(
+			"sensor_temperature_mean",
+			"mean temperature reported by the sensors of a thermostat in degrees",
+			runtime,
+		),
+		temperatureMin: d.new(
+			"sensor_temperature_min",
+			"lowest temperature reported by the sensors of a thermostat in degrees",
+			runtime,
+		),
+		temperatureMax: d.new(
+			"sensor_temperature_max",
+			"highest temperature reported by the sensors of a thermostat in degrees",
+			runtime,
+		),
+		currentHvacMode: d.new(
+			"currenthvacmode",
+			"current hvac mode of thermostat",
+			[]string{"thermostat_id", "thermostat_name", "current_hvac_mode"},
+		),
+		currentFanMode: d.new(
+			"currentfanmode",
+			"current fan mode of thermostat",
+			[]string{"thermostat_id", "thermostat_name", "current_fan_mode"},
+		),
+		equipmentRunning: d.new(
+			"equipment_running",
+			"current equipment status (0 or 1)",
+			[]string{"thermostat_id", "thermostat_name", "equipment"},
+		),
+		heatRangeHigh: d.new(
+			"heat_range_high",
+			"highest heat setpoint in degrees the thermostat allows",
+			runtime,
+		),
+		heatRangeLow: d.new(
+			"heat_range_low",
+			"lowest heat setpoint in degrees the thermostat allows",
+			runtime,
+		),
+		coolRangeHigh: d.new(
+			"cool_range_high",
+			"highest cool setpoint in degrees the thermostat allows",
+			runtime,
+		),
+		coolRangeLow: d.new(
+			"cool_range_low",
+			"lowest cool setpoint in degrees the thermostat allows",
+			runtime,
+		),
+		heatCoolMinDelta: d.new(
+			"heat_cool_min_delta",
+			"minimum difference in degrees the thermostat keeps between the heat and cool setpoints in auto mode",
+			runtime,
+		),
+		temperatureAlertLow: d.new(
+			"temperature_alert_low",
+			"temperature in degrees below which the thermostat alerts, if the alert is enabled",
+			runtime,
+		),
+		temperatureAlertHigh: d.new(
+			"temperature_alert_high",
+			"temperature in degrees above which the thermostat alerts, if the alert is enabled",
+			runtime,
+		),
+		humidityAlertLow: d.new(
+			"humidity_alert_low",
+			"humidity in percent below which the thermostat alerts, if the alert is enabled",
+			runtime,
+		),
+		humidityAlertHigh: d.new(
+			"humidity_alert_high",
+			"humidity in percent above which the thermostat alerts, if the alert is enabled",
+			runtime,
+		),
+		hardwareSettings: d.new(
+			"hardware_settings_info",
+			"microphone, voice assistant and display settings of a thermostat, with a constant value of 1; "+
+				"microphone and alexa are empty on models without them",
+			append(runtime, "microphone", "alexa", "backlight_on_intensity", "backlight_sleep_intensity", "backlight_off_during_sleep"),
+		),
+		desiredHumidity: d.new(
+			"desired_humidity_percent",
+			"humidity in percent a thermostat's humidifier maintains",
+			runtime,
+		),
+		desiredDehumidity: d.new(
+			"desired_dehumidity_percent",
+			"humidity in percent a thermostat's dehumidifier maintains",
+			runtime,
+		),
+		humidifierMode: d.new(
+			"humidifier_mode",
+			"mode of a thermostat's humidifier, one of auto, manual or off, with a constant value of 1",
+			append(runtime, "mode"),
+		),
+		dehumidifierMode: d.new(
+			"dehumidifier_mode",
+			"mode of a thermostat's dehumidifier, on or off, with a constant value of 1",
+			append(runtime, "mode"),
+		),
+		outdoorTemperature: d.new(
+			"outdoor_temperature",
+			"outdoor temperature at a thermostat in degrees, with the source it is from",
+			append(runtime, "source"),
+		),
+		outdoorHumidity: d.new(
+			"outdoor_humidity",
+			"outdoor humidity at a thermostat in percent, with the source it is from",
+			append(runtime, "source"),
+		),
+		outdoorPressure: d.new(
+			"outdoor_pressure_pascals",
+			"barometric pressure at a thermostat as ecobee reports it with its weather",
+			runtime,
+		),
+		outdoorWindSpeed: d.new(
+			"outdoor_wind_speed_meters_per_second",
+			"wind speed at a thermostat as ecobee reports it with its weather",
+			runtime,
+		),
+		forecastTemperatureHigh: d.new(
+			"forecast_temperature_high",
+			"next day's forecast high temperature at a thermostat in degrees",
+			runtime,
+		),
+		forecastTemperatureLow: d.new(
+			"forecast_temperature_low",
+			"next day's forecast low temperature at a thermostat in degrees",
+			runtime,
+		),
+		utcOffset: d.new(
+			"thermostat_utc_offset_seconds",
+			"offset of a thermostat's local time from UTC",
+			runtime,
+		),
+		clockSkew: d.new(
+			"clock_skew_seconds",
+			"how far the time reported by the API with a thermostat is ahead of the exporter's clock",
+			runtime,
+		),
+		nextTransition: d.new(
+			"next_schedule_transition_timestamp_seconds",
+			"when a thermostat's program next moves to another comfort setting, named by climate, as a Unix timestamp",
+			append(runtime, "climate"),
+		),
+		programClimate: d.new(
+			"program_climate",
+			"comfort setting a thermostat's program schedules now, named by climate, with a constant value of 1",
+			append(runtime, "climate"),
+		),
+		programTargetMin: d.new(
+			"program_target_temperature_min",
+			"minimum temperature the comfort setting a thermostat's program schedules now maintains",
+			runtime,
+		),
+		programTargetMax: d.new(
+			"program_target_temperature_max",
+			"maximum temperature the comfort setting a thermostat's program schedules now maintains",
+			runtime,
+		),
+		demandResponse: d.new(
+			"demand_response_active",
+			"whether a utility demand response event on a thermostat is running (0 or 1), 0 while it is scheduled",
+			[]string{"thermostat_id", "thermostat_name", "event_name"},
+		),
+		eventRunning: d.new(
+			"event_running",
+			"whether an event overriding a thermostat's program, such as a hold or vacation, is running (0 or 1), 0 while it is scheduled",
+			[]string{"thermostat_id", "thermostat_name", "event_type", "event_name"},
+		),
+		alertCount: d.new(
+			"alerts",
+			"number of alerts and reminders a thermostat has raised that haven't been acknowledged, by severity and type",
+			[]string{"thermostat_id", "thermostat_name", "severity", "type"},
+		),
+		filterReminder: d.new(
+			"filter_reminder_timestamp_seconds",
+			"time a thermostat's maintenance reminder of a type, such as for its filter or UV lamp, is next due",
+			[]string{"thermostat_id", "thermostat_name", "type"},
+		),
+		fanRuntimeSinceFilterChange: d.new(
+			"fan_runtime_since_filter_change_seconds",
+			"how long a thermostat's fan has run since its filter was last changed, as set in its filter change reminder",
+			runtime,
+		),
+		unparsedCapabilities: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("unparsed_capabilities_total"),
+			Help: "sensor capabilities with an unknown type or malformed value",
+		}, []string{"type"}),
+		setpointChanges: newSeries(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("setpoint_changes_total"),
+			Help: "changes of a thermostat's setpoints seen between collections, by cause: manual, hold or schedule",
+		}, []string{"thermostat_id", "thermostat_name", "cause"}), 1),
+		occupancyTransitions: newSeries(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("occupancy_transitions_total"),
+			Help: "changes of a sensor's occupancy seen between collections, by the state changed to: occupied or vacant",
+		}, append(sensor, "to")), 1, 3),
+		heatPumpRuntime: newSeries(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("heat_pump_runtime_seconds_total"),
+			Help: "time a thermostat's heating ran by stage, compressor or aux, and by outdoor temperature band, named by its lowest temperature",
+		}, append(runtime, "stage", "outdoor_band")), 1),
+		equipmentRuntimeSeconds: newSeries(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("equipment_runtime_seconds_total"),
+			Help: "time a thermostat's equipment ran, from the 5-minute intervals of its extended runtime",
+		}, append(runtime, "equipment")), 1),
+		skippedFetches: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: d.name("fetches_skipped_total"),
+			Help: "thermostat fetches skipped because its revisions hadn't changed",
+		}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: d.name("scrape_errors_total"),
+			Help: "errors of collections by the stage that failed, such as summary or thermostats",
+		}, []string{"stage"}),
+		truncatedSensors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: d.name("truncated_sensors_total"),
+			Help: "sensors not exported because their thermostat had more than the sensor limit",
+		}),
+	}
+	for _, opt := range opts {
+		opt(ec)
+	}
+	// start the counts of the stages every collection has at zero
+	for _, stage := range []string{StageSummary, StageThermostats} {
+		ec.scrapeErrors.WithLabelValues(stage)
+	}
+	return ec
+}
+
+// Describe dumps all metric descriptors into ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	if c.exportFetchTime {
+		ch <- c.fetchTime
+	}
+	ch <- c.thermostatFetchDuration
+	ch <- c.partialScrape
+	ch <- c.scrapeSuccess
+	ch <- c.lastSuccessfulScrape
+	c.scrapeErrors.Describe(ch)
+	if c.snapshot != nil {
+		ch <- c.cacheAge
+	}
+	ch <- c.connected
+	ch <- c.thermostatsDiscovered
+	if c.conflicts != nil {
+		ch <- c.equipmentConflict
+	}
+	if c.groups != nil {
+		ch <- c.groupInfo
+	}
+	if c.hierarchy != nil {
+		ch <- c.setInfo
+		ch <- c.setThermostats
+		ch <- c.setConnected
+		ch <- c.setEquipmentRunning
+		ch <- c.setUsers
+	}
+	ch <- c.lastStatusModified
+	ch <- c.actualTemperature
+	ch <- c.rawTemperature
+	ch <- c.targetTemperatureMax
+	ch <- c.targetTemperatureMin
+	if c.intervals {
+		ch <- c.intervalTemperature
+		ch <- c.intervalHumidity
+		ch <- c.intervalTargetMin
+		ch <- c.intervalTargetMax
+	}
+	ch <- c.temperature
+	ch <- c.humidity
+	ch <- c.occupancy
+	ch <- c.contactOpen
+	ch <- c.ambientLight
+	ch <- c.relayOn
+	ch <- c.inUse
+	ch <- c.sensorsDiscovered
+	ch <- c.dewPoint
+	ch <- c.heatIndex
+	ch <- c.thermostatDewPoint
+	ch <- c.thermostatHeatIndex
+	if c.risk != nil {
+		ch <- c.moldRisk
+		ch <- c.frostRisk
+	}
+	if c.thermal != nil {
+		ch <- c.heatLoss
+		ch <- c.timeConstant
+		ch <- c.thermalSamples
+	}
+	ch <- c.temperatureMean
+	ch <- c.temperatureMin
+	ch <- c.temperatureMax
+	ch <- c.currentHvacMode
+	ch <- c.currentFanMode
+	ch <- c.equipmentRunning
+	ch <- c.heatRangeHigh
+	ch <- c.heatRangeLow
+	ch <- c.coolRangeHigh
+	ch <- c.coolRangeLow
+	ch <- c.heatCoolMinDelta
+	ch <- c.temperatureAlertLow
+	ch <- c.temperatureAlertHigh
+	ch <- c.humidityAlertLow
+	ch <- c.humidityAlertHigh
+	ch <- c.hardwareSettings
+	ch <- c.desiredHumidity
+	ch <- c.desiredDehumidity
+	ch <- c.humidifierMode
+	ch <- c.dehumidifierMode
+	ch <- c.outdoorTemperature
+	ch <- c.outdoorHumidity
+	ch <- c.outdoorPressure
+	ch <- c.outdoorWindSpeed
+	ch <- c.forecastTemperatureHigh
+	ch <- c.forecastTemperatureLow
+	ch <- c.utcOffset
+	ch <- c.clockSkew
+	ch <- c.nextTransition
+	ch <- c.programClimate
+	ch <- c.programTargetMin
+	ch <- c.programTargetMax
+	ch <- c.demandResponse
+	ch <- c.eventRunning
+	if c.alerts {
+		ch <- c.alertCount
+		ch <- c.filterReminder
+	}
+	if c.filterRuntime != nil {
+		ch <- c.fanRuntimeSinceFilterChange
+	}
+	c.unparsedCapabilities.Describe(ch)
+	c.setpointChanges.Describe(ch)
+	c.occupancyTransitions.Describe(ch)
+	if c.balance != nil {
+		c.heatPumpRuntime.Describe(ch)
+	}
+	if c.equipmentRuntime != nil {
+		c.equipmentRuntimeSeconds.Describe(ch)
+	}
+	if c.maxSensors > 0 {
+		c.truncatedSensors.Describe(ch)
+	}
+	if c.revisions != nil {
+		c.skippedFetches.Describe(ch)
+	}
+	for _, dm := range c.defined {
+		ch <- dm.desc
+	}
+}
+
+var Bool2Float = map[bool]float64{false: 0, true: 1}
+
+// Collect retrieves thermostat data via the ecobee API. If the collector
+// has a timeout, the collection is bounded by it.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	c.CollectContext(ctx, ch)
+}
+
+// Result summarizes a finished collection.
+type Result struct {
+	CollectionID string
+	Start        time.Time
+	Duration     time.Duration
+
+	// Thermostats is the number of thermostats collected.
+	Thermostats int
+
+	// Partial reports whether some or all thermostats were skipped or
+	// failed to fetch.
+	Partial bool
+
+	// Active reports whether any thermostat collected had equipment
+	// running or a hold in effect.
+	Active bool
+}
+
+// CollectContext is like Collect, but bounded by ctx. Thermostats are
+// fetched one at a time; when the deadline of ctx is too close to fetch
+// another, the thermostats fetched so far are emitted and the scrape is
+// marked as partial. Each collection is assigned an ID, available from the
+// contexts of its API requests through CollectionID.
+func (c *Collector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	ctx = withCollectionID(ctx, newCollectionID())
+	ctx, failed := withFailed(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			c.error(ctx, StagePanic, "", fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	ctx, end, ok := c.lifecycle.begin(ctx)
+	if !ok {
+		// a scrape racing shutdown isn't a failed collection, so it is
+		// reported to the error handlers but not counted
+		e := &Error{Stage: StageSummary, CollectionID: CollectionID(ctx), Err: ErrClosed}
+		for _, f := range c.onError {
+			f(e)
+		}
+		return
+	}
+	defer end()
+
+	start := c.clock.Now()
+	partial := false
+	collected := 0
+	active := false
+	defer func() {
+		elapsed := c.clock.Since(start)
+		if c.exportFetchTime {
+			ch <- prometheus.MustNewConstMetric(c.fetchTime, prometheus.GaugeValue, elapsed.Seconds())
+		}
+		ch <- prometheus.MustNewConstMetric(c.partialScrape, prometheus.GaugeValue, Bool2Float[partial])
+		success := !partial && !failed.Load()
+		if success {
+			c.lastSuccess.Store(c.clock.Now().UnixNano())
+		}
+		ch <- prometheus.MustNewConstMetric(c.scrapeSuccess, prometheus.GaugeValue, Bool2Float[success])
+		ch <- prometheus.MustNewConstMetric(c.lastSuccessfulScrape, prometheus.GaugeValue, float64(c.lastSuccess.Load())/1e9)
+		c.scrapeErrors.Collect(ch)
+		c.unparsedCapabilities.Collect(ch)
+		c.setpointChanges.Collect(ch)
+		c.occupancyTransitions.Collect(ch)
+		if c.balance != nil {
+			c.heatPumpRuntime.Collect(ch)
+		}
+		if c.equipmentRuntime != nil {
+			c.equipmentRuntimeSeconds.Collect(ch)
+		}
+		if c.maxSensors > 0 {
+			c.truncatedSensors.Collect(ch)
+		}
+		if c.revisions != nil {
+			c.skippedFetches.Collect(ch)
+		}
+		r := Result{
+			CollectionID: CollectionID(ctx),
+			Start:        start,
+			Duration:     elapsed,
+			Thermostats:  collected,
+			Partial:      partial,
+			Active:       active,
+		}
+		for _, f := range c.onResult {
+			f(r)
+		}
+	}()
+
+	if c.snapshot != nil {
+		c.snapshot.load(ctx, c.logger)
+	}
+
+	// get equipment summary, which also lists the thermostats
+	ts, err := c.client.GetThermostatSummary(ctx, c.summary)
+	if err != nil {
+		c.error(ctx, StageSummary, "", err)
+		partial = true
+		if c.snapshot != nil {
+			c.collectSnapshot(ctx, ch, nil, nil)
+		}
+		return
+	}
+	if c.snapshot != nil {
+		c.snapshot.prune(c.clock.Now(), ts)
+	}
+	c.prune(ts)
+	ids := make([]string, 0, len(ts))
+	for id := range ts {
+		if c.wanted(ctx, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ch <- prometheus.MustNewConstMetric(c.thermostatsDiscovered, prometheus.GaugeValue, float64(len(ids)))
+	for _, id := range ids {
+		ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, Bool2Float[ts[id].Connected], id, ts[id].Name)
+		if c.conflicts != nil {
+			c.collectConflicts(ch, ts[id])
+		}
+	}
+	if c.groups != nil {
+		c.collectGroups(ctx, ch, ids, ts)
+	}
+	if c.hierarchy != nil {
+		c.collectHierarchy(ctx, ch, ids, ts)
+	}
+
+	// missed are the thermostats that were skipped or failed to fetch
+	var missed []string
+	fetch := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if c.revisions != nil {
+			if t, ok := c.revisions.get(ts[id], c.intervals || c.equipmentRuntime != nil, c.alerts); ok {
+				c.skippedFetches.Inc()
+				c.collectThermostat(ctx, ch, t, ts[id].EquipmentStatus)
+				collected++
+				active = active || isActive(t, ts[id].EquipmentStatus)
+				if c.snapshot != nil {
+					c.snapshot.put(t, ts[id].EquipmentStatus, c.clock.Now())
+					ch <- prometheus.MustNewConstMetric(c.cacheAge, prometheus.GaugeValue, 0, t.Identifier, t.Name)
+				}
+				continue
+			}
+		}
+		fetch = append(fetch, id)
+	}
+
+	// Fetch the rest in batches of as many thermostats as the API allows
+	// per request. A batch that fails is retried a thermostat at a time,
+	// so that one thermostat's error doesn't cost the others.
+	var batches [][]string
+	for len(fetch) > 0 {
+		n := min(len(fetch), maxBatch)
+		batches = append(batches, fetch[:n])
+		fetch = fetch[n:]
+	}
+	var slowest time.Duration
+	for len(batches) > 0 {
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(c.clock.Now()) < slowest {
+			for _, batch := range batches {
+				missed = append(missed, batch...)
+			}
+			c.logger.WarnContext(ctx, "scrape deadline near, skipping remaining thermostats", "skipped", len(missed))
+			partial = true
+			break
+		}
+		batch := batches[0]
+		batches = batches[1:]
+
+		fetchStart := c.clock.Now()
+		sel := c.selection
+		sel.SelectionType = "thermostats"
+		sel.SelectionMatch = strings.Join(batch, ",")
+		tt, err := c.client.GetThermostats(ctx, sel)
+		fetchDuration := c.clock.Since(fetchStart)
+		if fetchDuration > slowest {
+			slowest = fetchDuration
+		}
+		if err != nil && len(batch) > 1 && ctx.Err() == nil {
+			c.logger.WarnContext(ctx, "batch fetch failed, fetching its thermostats individually", "thermostats", len(batch), "error", err)
+			singles := make([][]string, len(batch))
+			for i := range batch {
+				singles[i] = batch[i : i+1]
+			}
+			batches = append(singles, batches...)
+			continue
+		}
+		if err != nil {
+			var id string
+			if len(batch) == 1 {
+				id = batch[0]
+			}
+			c.error(ctx, StageThermostats, id, err)
+			partial = true
+			missed = append(missed, batch...)
+			if ctx.Err() != nil {
+				for _, batch := range batches {
+					missed = append(missed, batch...)
+				}
+				break
+			}
+			continue
+		}
+		fetched := make(map[string]bool, len(tt))
+		for _, t := range tt {
+			fetched[t.Identifier] = true
+			c.measureClockSkew(t, fetchStart)
+			c.measureFetchDuration(t, fetchDuration)
+			c.collectThermostat(ctx, ch, t, ts[t.Identifier].EquipmentStatus)
+			collected++
+			active = active || isActive(t, ts[t.Identifier].EquipmentStatus)
+			if c.revisions != nil {
+				c.revisions.put(ts[t.Identifier], t)
+			}
+			if c.snapshot != nil {
+				c.snapshot.put(t, ts[t.Identifier].EquipmentStatus, fetchStart)
+				ch <- prometheus.MustNewConstMetric(c.cacheAge, prometheus.GaugeValue, 0, t.Identifier, t.Name)
+			}
+		}
+		for _, id := range batch {
+			if !fetched[id] {
+				partial = true
+				missed = append(missed, id)
+			}
+		}
+	}
+
+	// Export thermostats that couldn't be fetched from the snapshot or,
+	// failing that, what the summary says about them.
+	var fromSnapshot map[string]bool
+	if c.snapshot != nil && len(missed) > 0 {
+		fromSnapshot = c.collectSnapshot(ctx, ch, missed, ts)
+	}
+	for _, id := range missed {
+		if !fromSnapshot[id] {
+			c.collectSummary(ch, ts[id])
+		}
+	}
+	if c.snapshot != nil {
+		if err := c.snapshot.save(); err != nil {
+			c.logger.WarnContext(ctx, "unable to save snapshot", "path", c.snapshot.path, "error", err)
+		}
+	}
+}
+
+// collectSummary exports the equipment status of a thermostat that
+// couldn't be fetched, from its summary.
+func (c *Collector) collectSummary(ch chan<- prometheus.Metric, s ecobee.ThermostatSummary) {
+	if !s.Connected {
+		return
+	}
+	for _, e := range equipment(s.EquipmentStatus) {
+		ch <- prometheus.MustNewConstMetric(
+			c.equipmentRunning, prometheus.GaugeValue, Bool2Float[e.running], s.Identifier, s.Name, e.name,
+		)
+	}
+}
+
+type equipmentState struct {
+	name    string
+	running bool
+}
+
+// equipment returns the state of each piece of equipment in es, named after
+// its field.
+func equipment(es ecobee.EquipmentStatus) [15]equipmentState {
+	return [...]equipmentState{
+		{"HeatPump", es.HeatPump},
+		{"HeatPump2", es.HeatPump2},
+		{"HeatPump3", es.HeatPump3},
+		{"CompCool1", es.CompCool1},
+		{"CompCool2", es.CompCool2},
+		{"AuxHeat1", es.AuxHeat1},
+		{"AuxHeat2", es.AuxHeat2},
+		{"AuxHeat3", es.AuxHeat3},
+		{"Fan", es.Fan},
+		{"Humidifier", es.Humidifier},
+		{"Dehumidifier", es.Dehumidifier},
+		{"Ventilator", es.Ventilator},
+		{"Economizer", es.Economizer},
+		{"CompHotWater", es.CompHotWater},
+		{"AuxHotWater", es.AuxHotWater},
+	}
+}
+
+// collectHardwareSettings exports the settings of t that privacy-conscious
+// users may want to watch for changes, such as after firmware updates.
+func (c *Collector) collectHardwareSettings(ch chan<- prometheus.Metric, t client.Thermostat) {
+	var microphone, alexa string
+	if a := t.Audio; a != nil {
+		microphone = strconv.FormatBool(a.MicrophoneEnabled)
+		for _, e := range a.VoiceEngines {
+			if strings.EqualFold(e.Name, "alexa") {
+				alexa = strconv.FormatBool(e.Enabled)
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.hardwareSettings, prometheus.GaugeValue, 1, t.Identifier, t.Name, microphone, alexa,
+		strconv.Itoa(t.Settings.BacklightOnIntensity),
+		strconv.Itoa(t.Settings.BacklightSleepIntensity),
+		strconv.FormatBool(t.Settings.BacklightOffDuringSleep),
+	)
+}
+
+// collectHumidityControl exports the setpoints and modes of the humidifier
+// and dehumidifier of t, if it has them.
+func (c *Collector) collectHumidityControl(ch chan<- prometheus.Metric, t client.Thermostat) {
+	if t.Settings.HasHumidifier {
+		ch <- prometheus.MustNewConstMetric(c.desiredHumidity, prometheus.GaugeValue, float64(t.Runtime.DesiredHumidity), t.Identifier, t.Name)
+		ch <- prometheus.MustNewConstMetric(c.humidifierMode, prometheus.GaugeValue, 1, t.Identifier, t.Name, t.Settings.HumidifierMode)
+	}
+	if t.Settings.HasDehumidifier {
+		ch <- prometheus.MustNewConstMetric(c.desiredDehumidity, prometheus.GaugeValue, float64(t.Runtime.DesiredDehumidity), t.Identifier, t.Name)
+		ch <- prometheus.MustNewConstMetric(c.dehumidifierMode, prometheus.GaugeValue, 1, t.Identifier, t.Name, t.Settings.DehumidifierMode)
+	}
+}
+
+// collectDemandResponses exports the demand response events of t. Events
+// are keyed by name, so an event listed more than once is exported once,
+// as running if any of its listings is.
+func (c *Collector) collectDemandResponses(ch chan<- prometheus.Metric, t client.Thermostat) {
+	var running map[string]bool
+	var names []string
+	for _, e := range t.Events {
+		if e.Type != "demandResponse" {
+			continue
+		}
+		if running == nil {
+			running = make(map[string]bool)
+		}
+		if _, ok := running[e.Name]; !ok {
+			names = append(names, e.Name)
+		}
+		running[e.Name] = running[e.Name] || e.Running
+	}
+	for _, name := range names {
+		ch <- prometheus.MustNewConstMetric(c.demandResponse, prometheus.GaugeValue, Bool2Float[running[name]], t.Identifier, t.Name, name)
+	}
+}
+
+// collectEvents exports the events of t, such as holds, vacations, quick
+// saves and demand responses. Like demand responses, events are keyed by
+// type and name, and exported as running if any of their listings is.
+func (c *Collector) collectEvents(ch chan<- prometheus.Metric, t client.Thermostat) {
+	type key struct{ typ, name string }
+	running := map[key]bool{}
+	var keys []key
+	for _, e := range t.Events {
+		k := key{e.Type, e.Name}
+		if _, ok := running[k]; !ok {
+			keys = append(keys, k)
+		}
+		running[k] = running[k] || e.Running
+	}
+	for _, k := range keys {
+		ch <- prometheus.MustNewConstMetric(c.eventRunning, prometheus.GaugeValue, Bool2Float[running[k]], t.Identifier, t.Name, k.typ, k.name)
+	}
+}
+
+// isActive reports whether t has equipment running or a hold in effect.
+func isActive(t client.Thermostat, es ecobee.EquipmentStatus) bool {
+	if es != (ecobee.EquipmentStatus{}) {
+		return true
+	}
+	for _, e := range t.Events {
+		if e.Type == "hold" && e.Running {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Collector) collectThermostat(ctx context.Context, ch chan<- prometheus.Metric, t client.Thermostat, es ecobee.EquipmentStatus) {
+	tFields := []string{t.Identifier, t.Name}
+	c.collectDefined(ctx, ch, t)
+	c.collectDemandResponses(ch, t)
+	c.collectEvents(ch, t)
+	c.collectLocalTime(ch, t)
+	c.collectProgram(ch, t)
+	c.collectFetchDuration(ch, t)
+	outdoor, hasOutdoor := c.collectOutdoor(ctx, ch, t)
+	c.collectForecast(ch, t)
+	if c.alerts {
+		c.collectAlerts(ch, t)
+	}
+	if c.filterRuntime != nil {
+		c.collectFilterRuntime(ctx, ch, t)
+	}
+	if c.equipmentRuntime != nil {
+		c.collectEquipmentRuntime(t)
+	}
+	// exported while disconnected too, to tell how long it has been
+	if at, err := time.Parse(apiTime, t.Runtime.LastStatusModified); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.lastStatusModified, prometheus.GaugeValue, float64(at.Unix()), tFields...)
+	}
+	if t.Runtime.Connected {
+		ch <- prometheus.MustNewConstMetric(
+			c.actualTemperature, prometheus.GaugeValue, float64(t.Runtime.ActualTemperature)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.rawTemperature, prometheus.GaugeValue, float64(t.Runtime.RawTemperature)/10, tFields...,
+		)
+		if rh := float64(t.Runtime.ActualHumidity); rh > 0 {
+			temp := float64(t.Runtime.ActualTemperature) / 10
+			ch <- prometheus.MustNewConstMetric(c.thermostatDewPoint, prometheus.GaugeValue, dewPoint(temp, rh), tFields...)
+			ch <- prometheus.MustNewConstMetric(c.thermostatHeatIndex, prometheus.GaugeValue, heatIndex(temp, rh), tFields...)
+		}
+		c.collectSetpointChange(t)
+		if c.intervals {
+			c.collectIntervals(ch, t)
+		}
+		if c.thermal != nil && hasOutdoor {
+			c.collectThermal(ch, t, es, outdoor)
+		}
+		if c.balance != nil && hasOutdoor {
+			c.collectBalance(t, es, outdoor)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.targetTemperatureMax, prometheus.GaugeValue, float64(t.Runtime.DesiredCool)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.targetTemperatureMin, prometheus.GaugeValue, float64(t.Runtime.DesiredHeat)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.heatRangeHigh, prometheus.GaugeValue, float64(t.Settings.HeatRangeHigh)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.heatRangeLow, prometheus.GaugeValue, float64(t.Settings.HeatRangeLow)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.coolRangeHigh, prometheus.GaugeValue, float64(t.Settings.CoolRangeHigh)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.coolRangeLow, prometheus.GaugeValue, float64(t.Settings.CoolRangeLow)/10, tFields...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.heatCoolMinDelta, prometheus.GaugeValue, float64(t.Settings.HeatCoolMinDelta)/10, tFields...,
+		)
+		if t.Settings.ColdTempAlertEnabled {
+			ch <- prometheus.MustNewConstMetric(
+				c.temperatureAlertLow, prometheus.GaugeValue, float64(t.Settings.ColdTempAlert)/10, tFields...,
+			)
+		}
+		if t.Settings.HotTempAlertEnabled {
+			ch <- prometheus.MustNewConstMetric(
+				c.temperatureAlertHigh, prometheus.GaugeValue, float64(t.Settings.HotTempAlert)/10, tFields...,
+			)
+		}
+		if t.Settings.HumidityLowAlert >= 0 {
+			ch <- prometheus.MustNewConstMetric(
+				c.humidityAlertLow, prometheus.GaugeValue, float64(t.Settings.HumidityLowAlert), tFields...,
+			)
+		}
+		if t.Settings.HumidityHighAlert >= 0 {
+			ch <- prometheus.MustNewConstMetric(
+				c.humidityAlertHigh, prometheus.GaugeValue, float64(t.Settings.HumidityHighAlert), tFields...,
+			)
+		}
+		c.collectHardwareSettings(ch, t)
+		c.collectHumidityControl(ch, t)
+		ch <- prometheus.MustNewConstMetric(
+			c.currentHvacMode, prometheus.GaugeValue, 0, t.Identifier, t.Name, t.Settings.HvacMode,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.currentFanMode, prometheus.GaugeValue, 0, t.Identifier, t.Name, t.Runtime.DesiredFanMode,
+		)
+
+		for _, e := range equipment(es) {
+			ch <- prometheus.MustNewConstMetric(
+				c.equipmentRunning, prometheus.GaugeValue, Bool2Float[e.running], t.Identifier, t.Name, e.name,
+			)
+		}
+	}
+	sensors := t.RemoteSensors
+	ch <- prometheus.MustNewConstMetric(c.sensorsDiscovered, prometheus.GaugeValue, float64(len(sensors)), t.Identifier)
+	if c.maxSensors > 0 && len(sensors) > c.maxSensors {
+		c.logger.WarnContext(ctx, "too many sensors, dropping the rest",
+			"thermostat_id", t.Identifier, "sensors", len(sensors), "limit", c.maxSensors)
+		c.truncatedSensors.Add(float64(len(sensors) - c.maxSensors))
+		sensors = sensors[:c.maxSensors]
+	}
+	// label values are copied into each metric, so one slice serves
+	// every sensor
+	sFields := make([]string, 5)
+	copy(sFields, tFields)
+	var agg temperatures
+	present := make(map[string]bool, len(sensors))
+	for _, s := range sensors {
+		present[s.ID] = true
+		sFields[2], sFields[3], sFields[4] = s.ID, s.Name, s.Type
+		ch <- prometheus.MustNewConstMetric(
+			c.inUse, prometheus.GaugeValue, Bool2Float[s.InUse], sFields...,
+		)
+		// temperature and humidity, for the comfort metrics
+		var temp, rh float64
+		var hasTemp, hasRH bool
+		for _, sc := range s.Capability {
+			switch sc.Type {
+			case "temperature":
+				if v, err := strconv.ParseFloat(sc.Value, 64); err == nil {
+					ch <- prometheus.MustNewConstMetric(
+						c.temperature, prometheus.GaugeValue, v/10, sFields...,
+					)
+					if s.InUse || !c.inUseOnly {
+						agg.add(v / 10)
+					}
+					temp, hasTemp = v/10, true
+				} else {
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "humidity":
+				if v, err := strconv.ParseFloat(sc.Value, 64); err == nil {
+					ch <- prometheus.MustNewConstMetric(
+						c.humidity, prometheus.GaugeValue, v, sFields...,
+					)
+					rh, hasRH = v, true
+				} else {
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "occupancy":
+				switch sc.Value {
+				case "true":
+					ch <- prometheus.MustNewConstMetric(
+						c.occupancy, prometheus.GaugeValue, 1, sFields...,
+					)
+					c.collectOccupancy(sFields, true)
+				case "false":
+					ch <- prometheus.MustNewConstMetric(
+						c.occupancy, prometheus.GaugeValue, 0, sFields...,
+					)
+					c.collectOccupancy(sFields, false)
+				default:
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "dryContact":
+				// door/window sensors report whether their contact is
+				// open
+				switch sc.Value {
+				case "true", "open":
+					ch <- prometheus.MustNewConstMetric(
+						c.contactOpen, prometheus.GaugeValue, 1, sFields...,
+					)
+				case "false", "closed":
+					ch <- prometheus.MustNewConstMetric(
+						c.contactOpen, prometheus.GaugeValue, 0, sFields...,
+					)
+				default:
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "ambientLight":
+				if v, err := strconv.ParseFloat(sc.Value, 64); err == nil {
+					ch <- prometheus.MustNewConstMetric(
+						c.ambientLight, prometheus.GaugeValue, v, sFields...,
+					)
+				} else {
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "relay":
+				// Switch+ light switches report whether their relay, and
+				// so the light, is on
+				switch sc.Value {
+				case "true", "on":
+					ch <- prometheus.MustNewConstMetric(
+						c.relayOn, prometheus.GaugeValue, 1, sFields...,
+					)
+				case "false", "off":
+					ch <- prometheus.MustNewConstMetric(
+						c.relayOn, prometheus.GaugeValue, 0, sFields...,
+					)
+				default:
+					c.unparsedCapability(ctx, t.Identifier, sc)
+				}
+			case "airPressure":
+				// ignore air pressure sensor, as mine always reports "unknown"
+			default:
+				c.unparsedCapability(ctx, t.Identifier, sc)
+			}
+		}
+		if hasTemp && rh > 0 {
+			ch <- prometheus.MustNewConstMetric(c.dewPoint, prometheus.GaugeValue, dewPoint(temp, rh), sFields...)
+			ch <- prometheus.MustNewConstMetric(c.heatIndex, prometheus.GaugeValue, heatIndex(temp, rh), sFields...)
+		}
+		if hasTemp && c.risk != nil {
+			c.collectRisk(ch, sFields, temp, rh, hasRH)
+		}
+	}
+	c.pruneSensors(t.Identifier, present)
+	if agg.n > 0 {
+		ch <- prometheus.MustNewConstMetric(c.temperatureMean, prometheus.GaugeValue, agg.sum/float64(agg.n), tFields...)
+		ch <- prometheus.MustNewConstMetric(c.temperatureMin, prometheus.GaugeValue, agg.min, tFields...)
+		ch <- prometheus.MustNewConstMetric(c.temperatureMax, prometheus.GaugeValue, agg.max, tFields...)
+	}
+}
+
+// temperatures aggregates the temperatures reported by the sensors of a
+// thermostat.
+type temperatures struct {
+	sum, min, max float64
+	n             int
+}
+
+func (t *temperatures) add(v float64) {
+	if t.n == 0 || v < t.min {
+		t.min = v
+	}
+	if t.n == 0 || v > t.max {
+		t.max = v
+	}
+	t.sum += v
+	t.n++
+}
+
+// unparsedCapability counts a sensor capability that has an unknown type or
+// a malformed value. Each type is only logged the first time it is seen, so
+// that new capabilities are discoverable without flooding the log on every
+// scrape.
+func (c *Collector) unparsedCapability(ctx context.Context, thermostatID string, sc ecobee.RemoteSensorCapability) {
+	c.unparsedCapabilities.WithLabelValues(sc.Type).Inc()
+	if _, logged := c.loggedCapabilities.LoadOrStore(sc.Type, true); !logged {
+		c.logger.WarnContext(ctx, "unable to parse sensor capability",
+			"thermostat_id", thermostatID, "type", sc.Type, "value", sc.Value)
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import "math"
+
+// dewPoint returns the dew point in degrees Fahrenheit at temperature t in
+// degrees Fahrenheit and relative humidity rh in percent, using the Magnus
+// formula.
+func dewPoint(t, rh float64) float64 {
+	const a, b = 17.62, 243.12
+	c := (t - 32) * 5 / 9
+	g := math.Log(rh/100) + a*c/(b+c)
+	return b*g/(a-g)*9/5 + 32
+}
+
+// heatIndex returns the temperature in degrees Fahrenheit that t in degrees
+// Fahrenheit feels like at relative humidity rh in percent, following the
+// National Weather Service: Steadman's approximation when it is below 80,
+// and the Rothfusz regression with its adjustments above.
+func heatIndex(t, rh float64) float64 {
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (hi+t)/2 < 80 {
+		return hi
+	}
+	hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+		0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+	switch {
+	case rh < 13 && t >= 80 && t <= 112:
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	case rh > 85 && t >= 80 && t <= 87:
+		hi += (rh - 85) / 10 * (87 - t) / 5
+	}
+	return hi
+}
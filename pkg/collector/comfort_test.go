@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		t, rh, want float64
+	}{
+		{70, 100, 70},
+		{70, 50, 50.5},
+		{90, 60, 74.2},
+		{32, 50, 15.4},
+		{80, 40, 53.5},
+	}
+	for _, tt := range tests {
+		if got := dewPoint(tt.t, tt.rh); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("dewPoint(%v, %v) = %.2f, want %v", tt.t, tt.rh, got, tt.want)
+		}
+	}
+}
+
+// The wanted values are those of the National Weather Service's heat index
+// chart, to the degree.
+func TestHeatIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		t, rh, want float64
+	}{
+		{"mild", 70, 50, 69},
+		{"cold", 32, 50, 27},
+		{"below 80", 80, 40, 80},
+		{"hot", 90, 60, 100},
+		{"very hot", 96, 70, 126},
+		{"humid", 86, 90, 105},
+		{"dry", 100, 10, 94},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heatIndex(tt.t, tt.rh); math.Abs(got-tt.want) > 1 {
+				t.Errorf("heatIndex(%v, %v) = %.2f, want %v", tt.t, tt.rh, got, tt.want)
+			}
+		})
+	}
+}
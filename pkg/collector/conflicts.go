@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithEquipmentConflicts exports equipment_conflict for each thermostat,
+// flagging equipment that shouldn't run together, such as cooling and
+// auxiliary heat, once it has for longer than grace. Heat pumps briefly
+// run their compressor in cooling, with auxiliary heat, to defrost, so
+// grace should be longer than a defrost cycle.
+func WithEquipmentConflicts(grace time.Duration) Option {
+	return func(c *Collector) {
+		c.conflicts = &conflicts{grace: grace, since: make(map[string]time.Time)}
+	}
+}
+
+type conflicts struct {
+	grace time.Duration
+
+	mu    sync.Mutex
+	since map[string]time.Time // since when each conflict has been running
+}
+
+// conflict is a combination of equipment that shouldn't run together.
+type conflict struct {
+	name string
+	test func(es ecobee.EquipmentStatus) bool
+}
+
+var equipmentConflicts = [...]conflict{
+	{"cool_and_aux_heat", func(es ecobee.EquipmentStatus) bool {
+		return (es.CompCool1 || es.CompCool2) && (es.AuxHeat1 || es.AuxHeat2 || es.AuxHeat3)
+	}},
+	{"cool_and_heat_pump", func(es ecobee.EquipmentStatus) bool {
+		return (es.CompCool1 || es.CompCool2) && (es.HeatPump || es.HeatPump2 || es.HeatPump3)
+	}},
+	{"humidifier_and_dehumidifier", func(es ecobee.EquipmentStatus) bool {
+		return es.Humidifier && es.Dehumidifier
+	}},
+}
+
+// collectConflicts exports whether each conflict has been running on the
+// thermostat of s for longer than the grace period.
+func (c *Collector) collectConflicts(ch chan<- prometheus.Metric, s ecobee.ThermostatSummary) {
+	cs := c.conflicts
+	now := c.clock.Now()
+	for _, cf := range equipmentConflicts {
+		key := s.Identifier + "/" + cf.name
+		running := cf.test(s.EquipmentStatus)
+		cs.mu.Lock()
+		since, ok := cs.since[key]
+		if running && !ok {
+			since = now
+			cs.since[key] = now
+		} else if !running {
+			delete(cs.since, key)
+		}
+		cs.mu.Unlock()
+		flagged := running && now.Sub(since) > cs.grace
+		ch <- prometheus.MustNewConstMetric(c.equipmentConflict, prometheus.GaugeValue, Bool2Float[flagged], s.Identifier, s.Name, cf.name)
+	}
+}
@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// Definition describes an additional per-thermostat metric whose value is
+// read from a field of the thermostat object returned by the API.
+type Definition struct {
+	// Name is appended to the collector's metric prefix.
+	Name string
+	Help string
+
+	// Type is prometheus.GaugeValue or prometheus.CounterValue.
+	Type prometheus.ValueType
+
+	// Path locates the field within the thermostat object, as a
+	// dot-separated list of JSON keys with optional array indexes, such
+	// as "runtime.desiredHumidity" or "weather.forecasts[0].temperature".
+	// Numbers are exported as is, booleans as 0 or 1, and strings are
+	// parsed as numbers.
+	Path string
+
+	// Scale multiplies the field value. Zero means 1.
+	Scale float64
+}
+
+// Validate reports whether d can be collected by a Collector with the
+// metric prefix, under a valid name no built-in metric has.
+func (d Definition) Validate(prefix string) error {
+	if d.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if !model.IsValidMetricName(model.LabelValue(prefix + "_" + d.Name)) {
+		return fmt.Errorf("metric %s: invalid name", d.Name)
+	}
+	if builtin(prefix)[d.Name] {
+		return fmt.Errorf("metric %s: name of a built-in metric", d.Name)
+	}
+	if d.Type != prometheus.GaugeValue && d.Type != prometheus.CounterValue {
+		return fmt.Errorf("metric %s: type must be gauge or counter", d.Name)
+	}
+	if _, err := parsePath(d.Path); err != nil {
+		return fmt.Errorf("metric %s: %v", d.Name, err)
+	}
+	return nil
+}
+
+// builtin returns the names, without the prefix, of the metrics of a
+// Collector with the metric prefix.
+func builtin(prefix string) map[string]bool {
+	return NewEcobeeCollector(nil, prefix).descs.names
+}
+
+type pathElem struct {
+	key   string
+	index int // -1 if not indexed
+}
+
+var pathElemRE = regexp.MustCompile(`^([A-Za-z0-9_]+)((?:\[[0-9]+\])*)$`)
+
+func parsePath(path string) ([]pathElem, error) {
+	var elems []pathElem
+	for _, part := range strings.Split(path, ".") {
+		m := pathElemRE.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("invalid path element %q", part)
+		}
+		elems = append(elems, pathElem{key: m[1], index: -1})
+		for _, idx := range strings.Split(m[2], "]") {
+			if idx == "" {
+				continue
+			}
+			n, _ := strconv.Atoi(strings.TrimPrefix(idx, "["))
+			elems = append(elems, pathElem{index: n})
+		}
+	}
+	return elems, nil
+}
+
+// lookup walks v, a decoded JSON value, along elems and returns the value
+// at the end as a float.
+func lookup(v interface{}, elems []pathElem) (float64, bool) {
+	for _, e := range elems {
+		if e.index >= 0 {
+			a, ok := v.([]interface{})
+			if !ok || e.index >= len(a) {
+				return 0, false
+			}
+			v = a[e.index]
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if v, ok = m[e.key]; !ok {
+			return 0, false
+		}
+	}
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case bool:
+		return Bool2Float[x], true
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type definedMetric struct {
+	def   Definition
+	desc  *prometheus.Desc
+	path  []pathElem
+	scale float64
+}
+
+// WithDefinitions adds metrics read from arbitrary thermostat fields. The
+// selection sent to the API is widened to include the objects the paths
+// refer to. Definitions that fail Validate or repeat the name of another
+// are ignored.
+func WithDefinitions(defs ...Definition) Option {
+	return func(c *Collector) {
+		for _, def := range defs {
+			if def.Validate(c.descs.prefix) != nil || c.descs.names[def.Name] {
+				continue
+			}
+			path, _ := parsePath(def.Path)
+			scale := def.Scale
+			if scale == 0 {
+				scale = 1
+			}
+			c.defined = append(c.defined, definedMetric{
+				def:   def,
+				desc:  c.descs.new(def.Name, def.Help, []string{"thermostat_id", "thermostat_name"}),
+				path:  path,
+				scale: scale,
+			})
+			includeObject(&c.selection, path[0].key)
+		}
+	}
+}
+
+// includeObject sets the Include flag of sel that requests the thermostat
+// object key, if there is one.
+func includeObject(sel *ecobee.Selection, key string) {
+	if key == "remoteSensors" {
+		key = "sensors"
+	}
+	f := reflect.ValueOf(sel).Elem().FieldByName("Include" + strings.ToUpper(key[:1]) + key[1:])
+	if f.IsValid() && f.Kind() == reflect.Bool {
+		f.SetBool(true)
+	}
+}
+
+func (c *Collector) collectDefined(ctx context.Context, ch chan<- prometheus.Metric, t client.Thermostat) {
+	if len(c.defined) == 0 {
+		return
+	}
+	var v interface{}
+	if err := json.Unmarshal(t.Raw, &v); err != nil {
+		c.error(ctx, StageThermostats, t.Identifier, err)
+		return
+	}
+	for _, dm := range c.defined {
+		if f, ok := lookup(v, dm.path); ok {
+			ch <- prometheus.MustNewConstMetric(dm.desc, dm.def.Type, f*dm.scale, t.Identifier, t.Name)
+		}
+	}
+}
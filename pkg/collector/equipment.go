@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Equipment returns a collector, bound to ctx, of only what the thermostat
+// summary reports: whether each thermostat is connected, the equipment it
+// is running and, with WithEquipmentConflicts, conflicting equipment. The
+// summary is a single API request however many thermostats there are, so
+// this collector can be collected every minute or more often, catching
+// short equipment cycles, while the thermostats are fetched in full less
+// often. Its collections don't call the result handlers.
+func (c *Collector) Equipment(ctx context.Context) prometheus.Collector {
+	return equipmentCollector{c: c, ctx: ctx}
+}
+
+type equipmentCollector struct {
+	c   *Collector
+	ctx context.Context
+}
+
+func (e equipmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	c := e.c
+	if c.exportFetchTime {
+		ch <- c.fetchTime
+	}
+	ch <- c.connected
+	ch <- c.equipmentRunning
+	if c.conflicts != nil {
+		ch <- c.equipmentConflict
+	}
+}
+
+func (e equipmentCollector) Collect(ch chan<- prometheus.Metric) {
+	c, ctx := e.c, withCollectionID(e.ctx, newCollectionID())
+	start := c.clock.Now()
+	defer func() {
+		if c.exportFetchTime {
+			ch <- prometheus.MustNewConstMetric(c.fetchTime, prometheus.GaugeValue, c.clock.Since(start).Seconds())
+		}
+	}()
+
+	ts, err := c.client.GetThermostatSummary(ctx, c.summary)
+	if err != nil {
+		c.error(ctx, StageSummary, "", err)
+		return
+	}
+	ids := make([]string, 0, len(ts))
+	for id := range ts {
+		if c.wanted(ctx, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := ts[id]
+		ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, Bool2Float[s.Connected], id, s.Name)
+		if c.conflicts != nil {
+			c.collectConflicts(ch, s)
+		}
+		if !s.Connected {
+			continue
+		}
+		for _, eq := range equipment(s.EquipmentStatus) {
+			ch <- prometheus.MustNewConstMetric(
+				c.equipmentRunning, prometheus.GaugeValue, Bool2Float[eq.running], id, s.Name, eq.name,
+			)
+		}
+	}
+}
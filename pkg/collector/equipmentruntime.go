@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// WithEquipmentRuntime counts how long each thermostat's equipment runs,
+// as equipment_runtime_seconds_total, from the runtime of each 5-minute
+// interval of its extended runtime, so that duty cycles can be read from
+// the rate of the counters instead of from samples of equipment_running.
+// Each interval is counted once, when it is first collected; intervals
+// that end before the thermostat is first collected, or that drop out of
+// the last three between collections, aren't counted.
+func WithEquipmentRuntime() Option {
+	return func(c *Collector) {
+		c.selection.IncludeExtendedRuntime = true
+		c.equipmentRuntime = &equipmentRuntime{counted: make(map[string]time.Time)}
+	}
+}
+
+// equipmentRuntime holds the end of the last interval counted of each
+// thermostat.
+type equipmentRuntime struct {
+	mu      sync.Mutex
+	counted map[string]time.Time
+}
+
+// collectEquipmentRuntime counts the runtime of the intervals of the
+// extended runtime of t that end after the last one counted.
+func (c *Collector) collectEquipmentRuntime(t client.Thermostat) {
+	er := t.ExtendedRuntime
+	last, err := time.Parse(apiTime, er.LastReadingTimestamp)
+	if err != nil {
+		return
+	}
+	r := c.equipmentRuntime
+	r.mu.Lock()
+	counted, ok := r.counted[t.Identifier]
+	if !ok || last.After(counted) {
+		r.counted[t.Identifier] = last
+	}
+	r.mu.Unlock()
+
+	// the labels are those of equipment_running
+	equipment := []struct {
+		name    string
+		seconds []int
+	}{
+		{"HeatPump", er.HeatPump1},
+		{"HeatPump2", er.HeatPump2},
+		{"CompCool1", er.Cool1},
+		{"CompCool2", er.Cool2},
+		{"AuxHeat1", er.AuxHeat1},
+		{"AuxHeat2", er.AuxHeat2},
+		{"AuxHeat3", er.AuxHeat3},
+		{"Fan", er.Fan},
+		{"Humidifier", er.Humidifier},
+		{"Dehumidifier", er.Dehumidifier},
+		{"Ventilator", er.Ventilator},
+		{"Economizer", er.Economizer},
+	}
+	for _, e := range equipment {
+		if len(e.seconds) == 0 {
+			continue
+		}
+		// start every counter at zero for rate() to see its first increase
+		counter := c.equipmentRuntimeSeconds.with(t.Identifier, t.Name, e.name)
+		if !ok {
+			continue
+		}
+		for i, s := range e.seconds {
+			end := last.Add(-time.Duration(len(e.seconds)-1-i) * extendedInterval)
+			if end.After(counted) && s > 0 {
+				counter.Add(float64(s))
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Stages of a collection at which an Error can occur.
+const (
+	StageThermostats = "thermostats"
+	StageSummary     = "summary"
+	StageSensors     = "sensors"
+	StageGroups      = "groups"
+	StageHierarchy   = "hierarchy"
+	StageWeather     = "weather"
+
+	// StageRuntimeReport is reported when fetching the runtime report of
+	// WithFilterRuntime fails.
+	StageRuntimeReport = "runtime_report"
+
+	// StagePanic is reported when a collection panics, just before the
+	// panic continues.
+	StagePanic = "panic"
+)
+
+// Error describes a failure encountered while collecting metrics.
+type Error struct {
+	// Stage is the part of the collection that failed, one of the
+	// Stage constants.
+	Stage string
+
+	// ThermostatID identifies the thermostat being processed, if any.
+	ThermostatID string
+
+	// CollectionID identifies the collection during which the error
+	// occurred.
+	CollectionID string
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.ThermostatID == "" {
+		return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("%s (thermostat %s): %v", e.Stage, e.ThermostatID, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// failedKey is the context key of whether anything failed in a
+// collection.
+type failedKey struct{}
+
+// withFailed returns a context for a collection along with whether
+// anything failed in it, set by the errors reported within the context.
+func withFailed(ctx context.Context) (context.Context, *atomic.Bool) {
+	failed := new(atomic.Bool)
+	return context.WithValue(ctx, failedKey{}, failed), failed
+}
+
+func (c *Collector) error(ctx context.Context, stage, thermostatID string, err error) {
+	e := &Error{Stage: stage, ThermostatID: thermostatID, CollectionID: CollectionID(ctx), Err: err}
+	c.logger.ErrorContext(ctx, "collection failed", "stage", stage, "thermostat_id", thermostatID, "error", err)
+	c.scrapeErrors.WithLabelValues(stage).Inc()
+	if failed, ok := ctx.Value(failedKey{}).(*atomic.Bool); ok {
+		failed.Store(true)
+	}
+	for _, f := range c.onError {
+		f(e)
+	}
+}
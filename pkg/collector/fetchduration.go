@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// fetchDurations holds how long the last fetch of each thermostat took,
+// so it is still exported when WithChangeDetection skips fetching it.
+type fetchDurations struct {
+	mu   sync.Mutex
+	byID map[string]float64
+}
+
+// measureFetchDuration records that fetching t took d.
+func (c *Collector) measureFetchDuration(t client.Thermostat, d time.Duration) {
+	c.fetchDurations.mu.Lock()
+	c.fetchDurations.byID[t.Identifier] = d.Seconds()
+	c.fetchDurations.mu.Unlock()
+}
+
+// collectFetchDuration exports how long the last fetch of t took.
+func (c *Collector) collectFetchDuration(ch chan<- prometheus.Metric, t client.Thermostat) {
+	c.fetchDurations.mu.Lock()
+	d, ok := c.fetchDurations.byID[t.Identifier]
+	c.fetchDurations.mu.Unlock()
+	if ok {
+		ch <- prometheus.MustNewConstMetric(c.thermostatFetchDuration, prometheus.GaugeValue, d, t.Identifier)
+	}
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// reportDays is the most days the API allows in one runtime report.
+const reportDays = 31
+
+// WithFilterRuntime exports how long the fan of each thermostat has run
+// since its filter was last changed, as set in its filter change reminder,
+// as fan_runtime_since_filter_change_seconds. The runtime comes from the
+// thermostat's runtime report, which is fetched again only once refresh has
+// passed, and then only from the last day fetched on, as earlier days don't
+// change. If fetching it fails, the runtime last fetched is exported.
+func WithFilterRuntime(refresh time.Duration) Option {
+	return func(c *Collector) {
+		c.selection.IncludeNotificationSettings = true
+		c.filterRuntime = &filterRuntime{refresh: refresh, byID: make(map[string]*fanRuntime)}
+	}
+}
+
+// filterRuntime holds the fan runtime of each thermostat since its filter
+// was last changed.
+type filterRuntime struct {
+	refresh time.Duration
+
+	mu   sync.Mutex
+	byID map[string]*fanRuntime
+}
+
+// fanRuntime is the fan runtime of a thermostat since changed, in seconds:
+// done before the day through, which is still to be fetched again, and
+// partial on that day so far.
+type fanRuntime struct {
+	changed, through string
+	done, partial    float64
+	fetched          time.Time
+}
+
+// filterLastChanged returns the date the filter of t was last changed, if
+// it has a filter change reminder.
+func filterLastChanged(t client.Thermostat) (string, bool) {
+	if t.NotificationSettings == nil {
+		return "", false
+	}
+	for _, e := range t.NotificationSettings.Equipment {
+		if e.Type == "hvac" && e.FilterLastChanged != "" {
+			return e.FilterLastChanged, true
+		}
+	}
+	return "", false
+}
+
+// collectFilterRuntime exports the fan runtime of t since its filter was
+// last changed, fetching the days not yet fetched first if it is stale.
+func (c *Collector) collectFilterRuntime(ctx context.Context, ch chan<- prometheus.Metric, t client.Thermostat) {
+	changed, ok := filterLastChanged(t)
+	today, _, _ := strings.Cut(t.ThermostatTime, " ")
+	if !ok || today == "" {
+		return
+	}
+
+	fr := c.filterRuntime
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	r := fr.byID[t.Identifier]
+	if r == nil || r.changed != changed {
+		r = &fanRuntime{changed: changed, through: changed}
+		fr.byID[t.Identifier] = r
+	}
+	if now := c.clock.Now(); r.fetched.IsZero() || now.Sub(r.fetched) >= fr.refresh {
+		done, partial, err := c.fanRuntime(ctx, t.Identifier, r.through, today)
+		if err != nil {
+			c.error(ctx, StageRuntimeReport, t.Identifier, err)
+		} else {
+			r.done += done
+			r.partial = partial
+			r.through = today
+			r.fetched = now
+		}
+	}
+	if !r.fetched.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.fanRuntimeSinceFilterChange, prometheus.CounterValue, r.done+r.partial, t.Identifier, t.Name)
+	}
+}
+
+// fanRuntime fetches the fan runtime of thermostat id from the start of
+// from to the end of today, in as many reports as it takes, returning the
+// seconds before today and on today separately.
+func (c *Collector) fanRuntime(ctx context.Context, id, from, today string) (done, partial float64, err error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return 0, 0, err
+	}
+	for ; !start.After(end); start = start.AddDate(0, 0, reportDays) {
+		last := start.AddDate(0, 0, reportDays-1)
+		if last.After(end) {
+			last = end
+		}
+		reports, err := c.client.GetRuntimeReport(ctx, []string{id}, []string{"fan"}, start.Format("2006-01-02"), last.Format("2006-01-02"))
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, rep := range reports {
+			for _, row := range rep.RowList {
+				fields := strings.Split(row, ",")
+				if len(fields) < 3 || fields[2] == "" {
+					continue
+				}
+				v, err := strconv.ParseFloat(fields[2], 64)
+				if err != nil {
+					continue
+				}
+				if fields[0] == today {
+					partial += v
+				} else {
+					done += v
+				}
+			}
+		}
+	}
+	return done, partial, nil
+}
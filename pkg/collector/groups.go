@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithGroups exports the ecobee group each thermostat is in as
+// thermostat_group_info, for aggregating by group with a join on
+// thermostat_id. Groups rarely change, so they are fetched again only
+// once refresh has passed; if fetching them fails, the groups last fetched
+// are exported.
+func WithGroups(refresh time.Duration) Option {
+	return func(c *Collector) {
+		c.groups = &groups{refresh: refresh}
+	}
+}
+
+// groups holds the most recently fetched group of each thermostat.
+type groups struct {
+	refresh time.Duration
+
+	mu      sync.Mutex
+	fetched time.Time
+	byID    map[string]string
+}
+
+// collectGroups exports the groups of the thermostats in ids, fetching the
+// groups first if they are stale.
+func (c *Collector) collectGroups(ctx context.Context, ch chan<- prometheus.Metric, ids []string, ts map[string]ecobee.ThermostatSummary) {
+	g := c.groups
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now := c.clock.Now(); g.byID == nil || now.Sub(g.fetched) >= g.refresh {
+		gs, err := c.client.GetGroups(ctx)
+		if err != nil {
+			c.error(ctx, StageGroups, "", err)
+		} else {
+			g.byID = make(map[string]string)
+			for _, grp := range gs {
+				for _, id := range grp.Thermostats {
+					g.byID[id] = grp.GroupName
+				}
+			}
+			g.fetched = now
+		}
+	}
+	for _, id := range ids {
+		if name, ok := g.byID[id]; ok {
+			ch <- prometheus.MustNewConstMetric(c.groupInfo, prometheus.GaugeValue, 1, id, ts[id].Name, name)
+		}
+	}
+}
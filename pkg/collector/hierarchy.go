@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// WithHierarchy collects the thermostats at and below the set at path in
+// the management hierarchy of an EMS (ecobee Management System) account,
+// such as an ecobee SmartBuildings deployment, instead of the thermostats
+// registered to the account. The set of each thermostat is exported as
+// thermostat_set_info, and each set gets rollups of the thermostats in it
+// and the sets below it. Like groups, the hierarchy is fetched again only
+// once refresh has passed, and the hierarchy last fetched is used if
+// fetching it fails.
+func WithHierarchy(path string, refresh time.Duration) Option {
+	return func(c *Collector) {
+		c.summary.SelectionType = "managementSet"
+		c.summary.SelectionMatch = path
+		c.hierarchy = &hierarchy{path: path, refresh: refresh}
+	}
+}
+
+// hierarchy holds the most recently fetched management hierarchy.
+type hierarchy struct {
+	path    string
+	refresh time.Duration
+
+	mu      sync.Mutex
+	fetched time.Time
+	sets    []string          // set paths, sorted
+	parents map[string]string // parent path of each set
+	setOf   map[string]string // set path of each thermostat
+	users   map[string]int    // users with privileges on each set
+}
+
+// update replaces the hierarchy with sets and privileges.
+func (h *hierarchy) update(sets []client.ManagementSet, privileges []client.Privilege, now time.Time) {
+	h.parents = map[string]string{h.path: ""}
+	h.setOf = make(map[string]string)
+	var add func([]client.ManagementSet)
+	add = func(sets []client.ManagementSet) {
+		for _, s := range sets {
+			if s.SetPath != h.path && s.ParentPath != s.SetPath {
+				h.parents[s.SetPath] = s.ParentPath
+			}
+			for _, id := range s.Thermostats {
+				h.setOf[id] = s.SetPath
+			}
+			add(s.Children)
+		}
+	}
+	add(sets)
+
+	h.sets = make([]string, 0, len(h.parents))
+	for p := range h.parents {
+		h.sets = append(h.sets, p)
+	}
+	sort.Strings(h.sets)
+
+	seen := make(map[client.Privilege]bool)
+	h.users = make(map[string]int)
+	for _, p := range privileges {
+		if !seen[p] {
+			seen[p] = true
+			h.users[p.SetPath]++
+		}
+	}
+	h.fetched = now
+}
+
+// rollup totals the thermostats in a set and the sets below it.
+type rollup struct {
+	thermostats, connected int
+	running                [15]int
+}
+
+// collectHierarchy exports the sets of the thermostats in ids and the
+// rollups of every set, fetching the hierarchy first if it is stale.
+func (c *Collector) collectHierarchy(ctx context.Context, ch chan<- prometheus.Metric, ids []string, ts map[string]ecobee.ThermostatSummary) {
+	h := c.hierarchy
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now := c.clock.Now(); h.parents == nil || now.Sub(h.fetched) >= h.refresh {
+		sets, err := c.client.GetManagementSets(ctx, h.path)
+		var privileges []client.Privilege
+		if err == nil {
+			privileges, err = c.client.GetManagementPrivileges(ctx, h.path)
+		}
+		if err != nil {
+			c.error(ctx, StageHierarchy, "", err)
+		} else {
+			h.update(sets, privileges, now)
+		}
+	}
+	if h.parents == nil {
+		return
+	}
+
+	rollups := make(map[string]*rollup, len(h.sets))
+	for _, p := range h.sets {
+		rollups[p] = &rollup{}
+	}
+	for _, id := range ids {
+		p, ok := h.setOf[id]
+		if !ok {
+			continue
+		}
+		s := ts[id]
+		ch <- prometheus.MustNewConstMetric(c.setInfo, prometheus.GaugeValue, 1, id, s.Name, p)
+		es := equipment(s.EquipmentStatus)
+		// walk up to the root, bounded in case the API reports a cycle
+		for n := 0; n < len(h.sets) && rollups[p] != nil; n++ {
+			r := rollups[p]
+			r.thermostats++
+			if s.Connected {
+				r.connected++
+			}
+			for i, e := range es {
+				if e.running {
+					r.running[i]++
+				}
+			}
+			p = h.parents[p]
+		}
+	}
+
+	names := equipment(ecobee.EquipmentStatus{})
+	for _, p := range h.sets {
+		r := rollups[p]
+		ch <- prometheus.MustNewConstMetric(c.setThermostats, prometheus.GaugeValue, float64(r.thermostats), p)
+		ch <- prometheus.MustNewConstMetric(c.setConnected, prometheus.GaugeValue, float64(r.connected), p)
+		for i, n := range r.running {
+			ch <- prometheus.MustNewConstMetric(c.setEquipmentRunning, prometheus.GaugeValue, float64(n), p, names[i].name)
+		}
+		ch <- prometheus.MustNewConstMetric(c.setUsers, prometheus.GaugeValue, float64(h.users[p]), p)
+	}
+}
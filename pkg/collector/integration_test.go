@@ -0,0 +1,159 @@
+//go:build integration
+// +build integration
+
+package collector_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+	"github.com/joeshaw/ecobee-exporter/pkg/mockapi"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+	"github.com/joeshaw/ecobee-exporter/pkg/tokenstore"
+)
+
+var fixtures = mockapi.Static{
+	{
+		Thermostat: client.Thermostat{
+			Identifier: "411",
+			Name:       "2F - Hallway",
+			Settings:   client.Settings{HvacMode: "heat"},
+			Runtime: client.Runtime{
+				Connected:         true,
+				ActualTemperature: 701,
+				DesiredHeat:       690,
+				DesiredCool:       780,
+				DesiredFanMode:    "auto",
+			},
+			RemoteSensors: []ecobee.RemoteSensor{
+				{
+					ID: "rs:100", Name: "2F - Bedroom", Type: "ecobee3_remote_sensor", InUse: true,
+					Capability: []ecobee.RemoteSensorCapability{
+						{Type: "temperature", Value: "689"},
+						{Type: "occupancy", Value: "true"},
+					},
+				},
+			},
+		},
+		Equipment: []string{"heatPump", "fan"},
+	},
+}
+
+// newCollector returns a collector talking to a mock API that requires
+// authorization, obtained through the PIN flow.
+func newCollector(t *testing.T) (*collector.Collector, *mockapi.Server) {
+	srv := mockapi.NewServer(fixtures)
+	t.Cleanup(srv.Close)
+	srv.RequireAuth = true
+
+	var prompted string
+	ts := tokenstore.TokenSource("appkey", &tokenstore.Memory{},
+		tokenstore.WithBaseURL(srv.URL),
+		tokenstore.WithPinPrompt(func(pin string) error {
+			prompted = pin
+			return nil
+		}),
+	)
+	c := collector.NewEcobeeCollector(client.New(ts, client.WithBaseURL(srv.URL)), "ecobee")
+	t.Cleanup(func() {
+		if prompted == "" {
+			t.Error("PIN authorization flow was not run")
+		}
+	})
+	return c, srv
+}
+
+func TestCollectEndToEnd(t *testing.T) {
+	c, _ := newCollector(t)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	g := pipeline.New(reg, pipeline.Extract("thermostat_name", regexp.MustCompile(`^(?P<floor>\w+) - .+$`)))
+	expected := `
+# HELP ecobee_actual_temperature thermostat-averaged current temperature
+# TYPE ecobee_actual_temperature gauge
+ecobee_actual_temperature{floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 70.1
+# HELP ecobee_equipment_running current equipment status (0 or 1)
+# TYPE ecobee_equipment_running gauge
+ecobee_equipment_running{equipment="AuxHeat1",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="AuxHeat2",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="AuxHeat3",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="AuxHotWater",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="CompCool1",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="CompCool2",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="CompHotWater",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="Dehumidifier",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="Economizer",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="Fan",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 1
+ecobee_equipment_running{equipment="HeatPump",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 1
+ecobee_equipment_running{equipment="HeatPump2",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="HeatPump3",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="Humidifier",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+ecobee_equipment_running{equipment="Ventilator",floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 0
+# HELP ecobee_occupancy occupancy reported by a sensor (0 or 1)
+# TYPE ecobee_occupancy gauge
+ecobee_occupancy{floor="2F",sensor_id="rs:100",sensor_name="2F - Bedroom",sensor_type="ecobee3_remote_sensor",thermostat_id="411",thermostat_name="2F - Hallway"} 1
+# HELP ecobee_partial_scrape whether some thermostats were skipped or failed to fetch (0 or 1)
+# TYPE ecobee_partial_scrape gauge
+ecobee_partial_scrape 0
+# HELP ecobee_target_temperature_min minimum temperature for thermostat to maintain
+# TYPE ecobee_target_temperature_min gauge
+ecobee_target_temperature_min{floor="2F",thermostat_id="411",thermostat_name="2F - Hallway"} 69
+# HELP ecobee_temperature temperature reported by a sensor in degrees
+# TYPE ecobee_temperature gauge
+ecobee_temperature{floor="2F",sensor_id="rs:100",sensor_name="2F - Bedroom",sensor_type="ecobee3_remote_sensor",thermostat_id="411",thermostat_name="2F - Hallway"} 68.9
+`
+	if err := testutil.GatherAndCompare(g, strings.NewReader(expected),
+		"ecobee_actual_temperature",
+		"ecobee_equipment_running",
+		"ecobee_occupancy",
+		"ecobee_partial_scrape",
+		"ecobee_target_temperature_min",
+		"ecobee_temperature",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectThermostatFailure(t *testing.T) {
+	c, srv := newCollector(t)
+	srv.Fail("/1/thermostat", 500)
+
+	var errs []*collector.Error
+	collector.WithErrorHandler(func(e *collector.Error) { errs = append(errs, e) })(c)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	expected := `
+# HELP ecobee_partial_scrape whether some thermostats were skipped or failed to fetch (0 or 1)
+# TYPE ecobee_partial_scrape gauge
+ecobee_partial_scrape 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "ecobee_partial_scrape", "ecobee_actual_temperature"); err != nil {
+		t.Error(err)
+	}
+	if len(errs) != 1 || errs[0].Stage != collector.StageThermostats || errs[0].ThermostatID != "411" {
+		t.Errorf("unexpected errors reported: %v", errs)
+	}
+}
+
+func TestCollectSummaryFailure(t *testing.T) {
+	c, srv := newCollector(t)
+	srv.Fail("/1/thermostatSummary", 503)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if n, err := testutil.GatherAndCount(reg, "ecobee_temperature", "ecobee_actual_temperature"); err != nil || n != 0 {
+		t.Errorf("got %d thermostat series (err %v), want none", n, err)
+	}
+	if got := srv.Requests("/1/thermostat"); got != 0 {
+		t.Errorf("thermostats fetched %d times after summary failure, want 0", got)
+	}
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// IntervalLabel is the label telling apart the samples of the intervals
+// of the extended runtime, which are otherwise of the same series. It holds
+// the position of the interval, from 0 for the oldest, and must be removed
+// before exposition, as pipeline.Unlabel does, for the samples to land in
+// one series.
+const IntervalLabel = "interval"
+
+// extendedInterval is the length of the intervals of the extended runtime.
+const extendedInterval = 5 * time.Minute
+
+// WithIntervals exports the temperature, humidity and setpoints of the
+// last three 5-minute intervals of each thermostat's extended runtime, as
+// samples timestamped with the end of their interval. This gives 5-minute
+// resolution when scraping as seldom as every 15 minutes. The samples carry
+// IntervalLabel.
+func WithIntervals() Option {
+	return func(c *Collector) {
+		c.selection.IncludeExtendedRuntime = true
+		c.intervals = true
+	}
+}
+
+// collectIntervals exports the intervals of the extended runtime of t, the
+// last of which ends at its last reading.
+func (c *Collector) collectIntervals(ch chan<- prometheus.Metric, t client.Thermostat) {
+	er := t.ExtendedRuntime
+	last, err := time.Parse(apiTime, er.LastReadingTimestamp)
+	if err != nil {
+		return
+	}
+	series := []struct {
+		desc   *prometheus.Desc
+		values []int
+		scale  float64
+	}{
+		{c.intervalTemperature, er.ActualTemperature, 10},
+		{c.intervalHumidity, er.ActualHumidity, 1},
+		{c.intervalTargetMin, er.DesiredHeat, 10},
+		{c.intervalTargetMax, er.DesiredCool, 10},
+	}
+	for _, s := range series {
+		for i, v := range s.values {
+			end := last.Add(-time.Duration(len(s.values)-1-i) * extendedInterval)
+			m := prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, float64(v)/s.scale, t.Identifier, t.Name, strconv.Itoa(i))
+			ch <- prometheus.NewMetricWithTimestamp(end, m)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is reported to the error handlers when Collect is called on a
+// closed collector, which collects nothing. It isn't counted in
+// scrape_errors_total.
+var ErrClosed = errors.New("collector closed")
+
+// lifecycle tracks in-flight collections and shutdown hooks.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+	cancels  map[*context.CancelFunc]struct{}
+	hooks    []func(context.Context) error
+}
+
+// begin registers a collection and returns a context that is canceled when
+// the collector is closed, or false if it already has been.
+func (l *lifecycle) begin(ctx context.Context) (context.Context, func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ctx, func() {}, false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if l.cancels == nil {
+		l.cancels = make(map[*context.CancelFunc]struct{})
+	}
+	l.cancels[&cancel] = struct{}{}
+	l.inflight.Add(1)
+	return ctx, func() {
+		l.mu.Lock()
+		delete(l.cancels, &cancel)
+		l.mu.Unlock()
+		cancel()
+		l.inflight.Done()
+	}, true
+}
+
+// OnClose registers f to be called when the collector is closed, for example
+// to stop a background goroutine or flush a sink. Hooks run in reverse order
+// of registration.
+func (c *Collector) OnClose(f func(ctx context.Context) error) {
+	c.lifecycle.mu.Lock()
+	defer c.lifecycle.mu.Unlock()
+	c.lifecycle.hooks = append(c.lifecycle.hooks, f)
+}
+
+// Close runs the hooks registered with OnClose, then cancels in-flight
+// collections and waits for them to finish, or for ctx to be done. Hooks
+// run while the collector still works, so sinks can flush a final
+// collection. Collecting from a closed collector produces no metrics. Close
+// returns the first error returned by a hook, or ctx's error if it gave up
+// waiting.
+func (c *Collector) Close(ctx context.Context) error {
+	l := &c.lifecycle
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	hooks := l.hooks
+	l.hooks = nil
+	l.mu.Unlock()
+
+	var err error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if herr := hooks[i](ctx); herr != nil && err == nil {
+			err = herr
+		}
+	}
+
+	l.mu.Lock()
+	l.closed = true
+	for cancel := range l.cancels {
+		(*cancel)()
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
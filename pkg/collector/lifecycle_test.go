@@ -0,0 +1,25 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectClosed(t *testing.T) {
+	var errs []*Error
+	c := NewEcobeeCollector(nil, "ecobee", WithErrorHandler(func(e *Error) { errs = append(errs, e) }))
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// with no client, a collection that went ahead would panic
+	drain(c)
+	if len(errs) != 1 || !errors.Is(errs[0].Err, ErrClosed) {
+		t.Errorf("reported %v, want %v", errs, ErrClosed)
+	}
+	if n := testutil.ToFloat64(c.scrapeErrors.WithLabelValues(StageSummary)); n != 0 {
+		t.Errorf("counted %v summary errors, want 0", n)
+	}
+}
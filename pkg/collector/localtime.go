@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// apiTime is the layout of the times reported by the API.
+const apiTime = "2006-01-02 15:04:05"
+
+// Location returns the time zone of t, as the offset of its local time from
+// UTC when it was fetched, rounded to the quarter hour. The API doesn't name
+// the zone, so the offset is assumed not to change, such as for daylight
+// saving time, before the thermostat is fetched again.
+func Location(t client.Thermostat) (*time.Location, bool) {
+	local, err := time.Parse(apiTime, t.ThermostatTime)
+	if err != nil {
+		return nil, false
+	}
+	utc, err := time.Parse(apiTime, t.UtcTime)
+	if err != nil {
+		return nil, false
+	}
+	offset := local.Sub(utc).Round(15 * time.Minute)
+	return time.FixedZone("", int(offset.Seconds())), true
+}
+
+// localTime returns the time t was fetched at, in its time zone.
+func localTime(t client.Thermostat) (time.Time, bool) {
+	loc, ok := Location(t)
+	if !ok {
+		return time.Time{}, false
+	}
+	now, err := time.ParseInLocation(apiTime, t.ThermostatTime, loc)
+	return now, err == nil
+}
+
+// clockSkews holds how far the time reported by the API was ahead of the
+// exporter's clock when each thermostat was last fetched.
+type clockSkews struct {
+	mu   sync.Mutex
+	byID map[string]float64
+}
+
+// measureClockSkew records the skew of the time reported by the API for t,
+// fetched at fetched by the exporter's clock.
+func (c *Collector) measureClockSkew(t client.Thermostat, fetched time.Time) {
+	utc, err := time.Parse(apiTime, t.UtcTime)
+	if err != nil {
+		return
+	}
+	c.clockSkews.mu.Lock()
+	c.clockSkews.byID[t.Identifier] = utc.Sub(fetched).Seconds()
+	c.clockSkews.mu.Unlock()
+}
+
+// collectLocalTime exports the time zone offset of t, the clock skew when
+// it was last fetched and its next program transition.
+func (c *Collector) collectLocalTime(ch chan<- prometheus.Metric, t client.Thermostat) {
+	c.clockSkews.mu.Lock()
+	skew, ok := c.clockSkews.byID[t.Identifier]
+	c.clockSkews.mu.Unlock()
+	if ok {
+		ch <- prometheus.MustNewConstMetric(c.clockSkew, prometheus.GaugeValue, skew, t.Identifier, t.Name)
+	}
+
+	now, ok := localTime(t)
+	if !ok {
+		return
+	}
+	_, offset := now.Zone()
+	ch <- prometheus.MustNewConstMetric(c.utcOffset, prometheus.GaugeValue, float64(offset), t.Identifier, t.Name)
+	if next, climate, ok := nextTransition(t, now); ok {
+		ch <- prometheus.MustNewConstMetric(c.nextTransition, prometheus.GaugeValue, float64(next.Unix()), t.Identifier, t.Name, climate)
+	}
+}
+
+// nextTransition returns when, after now in the thermostat's time zone, the
+// program of t next moves to another comfort setting, and the name of that
+// setting.
+func nextTransition(t client.Thermostat, now time.Time) (time.Time, string, bool) {
+	slot, ok := schedule(t)
+	if !ok {
+		return time.Time{}, "", false
+	}
+
+	y, m, d := now.Date()
+	start := time.Date(y, m, d, now.Hour(), now.Minute()/30*30, 0, 0, now.Location())
+	current := slot(start)
+	for i := 1; i <= 7*48; i++ {
+		at := start.Add(time.Duration(i) * 30 * time.Minute)
+		if ref := slot(at); ref != current {
+			name := ref
+			if cl, ok := climate(t, ref); ok {
+				name = cl.Name
+			}
+			return at, name, true
+		}
+	}
+	return time.Time{}, "", false
+}
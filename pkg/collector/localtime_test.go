@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		name            string
+		thermostat, utc string
+		offset          time.Duration
+		ok              bool
+	}{
+		{"eastern", "2026-10-15 08:00:03", "2026-10-15 12:00:00", -4 * time.Hour, true},
+		{"india", "2026-10-15 17:29:58", "2026-10-15 12:00:00", 5*time.Hour + 30*time.Minute, true},
+		{"utc", "2026-10-15 12:00:00", "2026-10-15 12:00:00", 0, true},
+		{"malformed", "yesterday", "2026-10-15 12:00:00", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, ok := Location(client.Thermostat{ThermostatTime: tt.thermostat, UtcTime: tt.utc})
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if _, offset := time.Date(2026, 10, 15, 12, 0, 0, 0, loc).Zone(); time.Duration(offset)*time.Second != tt.offset {
+				t.Errorf("offset %v, want %v", time.Duration(offset)*time.Second, tt.offset)
+			}
+		})
+	}
+}
+
+// program returns a thermostat whose program is slot for every day of the
+// week, from Monday, and every half hour.
+func program(slot func(day, half int) string) client.Thermostat {
+	var t client.Thermostat
+	for day := 0; day < 7; day++ {
+		halves := make([]string, 48)
+		for half := range halves {
+			halves[half] = slot(day, half)
+		}
+		t.Program.Schedule = append(t.Program.Schedule, halves)
+	}
+	t.Program.Climates = []ecobee.Climate{
+		{Name: "Home", ClimateRef: "home"},
+		{Name: "Away", ClimateRef: "away"},
+		{Name: "Sleep", ClimateRef: "sleep"},
+	}
+	return t
+}
+
+// workday sleeps until 6:00, is home until 8:00, away until 17:00 on
+// weekdays, and home until 22:00.
+func workday(day, half int) string {
+	switch {
+	case half < 12 || half >= 44:
+		return "sleep"
+	case day < 5 && half >= 16 && half < 34:
+		return "away"
+	default:
+		return "home"
+	}
+}
+
+// smart is home in the mornings, and in a comfort setting the thermostat
+// doesn't define in the afternoons and evenings.
+func smart(day, half int) string {
+	if half < 24 {
+		return "home"
+	}
+	return "smart1"
+}
+
+func TestNextTransition(t *testing.T) {
+	eastern := time.FixedZone("", -4*60*60)
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, eastern)
+	}
+	tests := []struct {
+		name    string
+		t       client.Thermostat
+		now     time.Time
+		next    time.Time
+		climate string
+		ok      bool
+	}{
+		// October 14th, 2026 is a Wednesday
+		{"morning", program(workday), at(14, 7, 10), at(14, 8, 0), "Away", true},
+		{"at a transition", program(workday), at(14, 8, 0), at(14, 17, 0), "Home", true},
+		{"overnight", program(workday), at(14, 22, 45), at(15, 6, 0), "Home", true},
+		{"weekend", program(workday), at(17, 10, 0), at(17, 22, 0), "Sleep", true},
+		{"friday night", program(workday), at(16, 17, 15), at(16, 22, 0), "Sleep", true},
+		{
+			name:    "unknown climate",
+			t:       program(smart),
+			now:     at(14, 9, 0),
+			next:    at(14, 12, 0),
+			climate: "smart1",
+			ok:      true,
+		},
+		{"constant", program(func(day, half int) string { return "home" }), at(14, 9, 0), time.Time{}, "", false},
+		{"no program", client.Thermostat{}, at(14, 9, 0), time.Time{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, climate, ok := nextTransition(tt.t, tt.now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if !next.Equal(tt.next) || climate != tt.climate {
+				t.Errorf("next transition to %q at %v, want %q at %v", climate, next, tt.climate, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+type collectionIDKey struct{}
+
+func newCollectionID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withCollectionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, collectionIDKey{}, id)
+}
+
+// CollectionID returns the ID of the collection ctx belongs to, or "" if
+// it doesn't belong to one.
+func CollectionID(ctx context.Context) string {
+	id, _ := ctx.Value(collectionIDKey{}).(string)
+	return id
+}
+
+// LogHandler wraps h so that records logged with the context of a
+// collection, including those of the API requests it makes, carry its ID
+// as the collection_id attribute. This lets the log lines of concurrent
+// scrapes be told apart.
+func LogHandler(h slog.Handler) slog.Handler {
+	return logHandler{h}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (h logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := CollectionID(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("collection_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{h.Handler.WithGroup(name)}
+}
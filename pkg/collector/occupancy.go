@@ -0,0 +1,43 @@
+package collector
+
+import "sync"
+
+// Occupancy transitions, the values of the to label of
+// occupancy_transitions_total.
+const (
+	// TransitionOccupied is a sensor detecting occupancy after none.
+	TransitionOccupied = "occupied"
+
+	// TransitionVacant is a sensor detecting no occupancy after some.
+	TransitionVacant = "vacant"
+)
+
+// occupancies holds whether each sensor was occupied when it was last
+// collected, to count the transitions between collections.
+type occupancies struct {
+	mu       sync.Mutex
+	bySensor map[string]bool
+}
+
+// collectOccupancy counts a transition of the occupancy of the sensor
+// labeled by sFields since it was last collected. Both transitions start
+// at zero the first time a sensor is collected.
+func (c *Collector) collectOccupancy(sFields []string, occupied bool) {
+	key := sFields[0] + "/" + sFields[2]
+	c.occupancies.mu.Lock()
+	prev, ok := c.occupancies.bySensor[key]
+	c.occupancies.bySensor[key] = occupied
+	c.occupancies.mu.Unlock()
+
+	labels := append(sFields[:len(sFields):len(sFields)], TransitionOccupied)
+	toOccupied := c.occupancyTransitions.with(labels...)
+	labels[len(labels)-1] = TransitionVacant
+	toVacant := c.occupancyTransitions.with(labels...)
+	switch {
+	case !ok || prev == occupied:
+	case occupied:
+		toOccupied.Inc()
+	default:
+		toVacant.Inc()
+	}
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+// Option configures optional behavior of the collector.
+type Option func(*Collector)
+
+// WithErrorHandler registers f to be called with every error encountered
+// during collection, in addition to it being logged. f is called
+// synchronously from Collect and must not block. Handlers are called in
+// the order they were registered.
+func WithErrorHandler(f func(*Error)) Option {
+	return func(c *Collector) {
+		c.onError = append(c.onError, f)
+	}
+}
+
+// WithResultHandler registers f to be called at the end of every
+// collection with its outcome. Like error handlers, f is called
+// synchronously and must not block, and handlers are called in the order
+// they were registered.
+func WithResultHandler(f func(Result)) Option {
+	return func(c *Collector) {
+		c.onResult = append(c.onResult, f)
+	}
+}
+
+// WithLogger sets the logger used for collection errors and warnings. It
+// defaults to slog.Default(). Wrap its handler with LogHandler to include
+// collection IDs.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Collector) {
+		c.logger = l
+	}
+}
+
+// WithClock sets the clock used to time fetches. It defaults to
+// clock.Real.
+func WithClock(clk clock.Clock) Option {
+	return func(c *Collector) {
+		c.clock = clk
+	}
+}
+
+// WithThermostatFilter restricts collection to the thermostats for which
+// keep returns true, such as one shard of a fleet split across several
+// exporters. Other thermostats are not fetched and don't make a scrape
+// partial.
+func WithThermostatFilter(keep func(id string) bool) Option {
+	return func(c *Collector) {
+		c.keep = keep
+	}
+}
+
+// WithSensorLimit exports at most n sensors of each thermostat, in the
+// order the API lists them, counting the rest in truncated_sensors_total.
+func WithSensorLimit(n int) Option {
+	return func(c *Collector) {
+		c.maxSensors = n
+	}
+}
+
+// WithInUseAggregates limits the sensor_temperature_mean, _min and _max
+// aggregates of each thermostat to the sensors it currently uses, rather
+// than every sensor reporting a temperature.
+func WithInUseAggregates() Option {
+	return func(c *Collector) {
+		c.inUseOnly = true
+	}
+}
+
+// WithFetchTime exports fetch_time, how long each collection took. It is
+// superseded by the API client's request latencies, which break the time
+// down by endpoint, and kept for dashboards and alerts still using it.
+func WithFetchTime() Option {
+	return func(c *Collector) {
+		c.exportFetchTime = true
+	}
+}
+
+// WithTimeout bounds each call to Collect by d. Scrapes that run out of
+// time export the thermostats fetched so far. Collectors without a timeout
+// are only bounded by the context passed to CollectContext.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Collector) {
+		c.timeout = d
+	}
+}
+
+// Bound returns a prometheus.Collector that collects from c within ctx, for
+// example the context of the HTTP request being served.
+func (c *Collector) Bound(ctx context.Context) prometheus.Collector {
+	return boundCollector{c: c, ctx: ctx}
+}
+
+type boundCollector struct {
+	c   *Collector
+	ctx context.Context
+}
+
+func (b boundCollector) Describe(ch chan<- *prometheus.Desc) {
+	b.c.Describe(ch)
+}
+
+func (b boundCollector) Collect(ch chan<- prometheus.Metric) {
+	b.c.CollectContext(b.ctx, ch)
+}
+
+type thermostatKey struct{}
+
+// ForThermostat returns a copy of ctx that restricts the collections it
+// bounds to the thermostat id, such as to answer a probe of one thermostat
+// without fetching the others. The thermostat summary, which lists every
+// thermostat, is still fetched.
+func ForThermostat(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, thermostatKey{}, id)
+}
+
+// wanted reports whether the thermostat id is collected within ctx.
+func (c *Collector) wanted(ctx context.Context, id string) bool {
+	if only, ok := ctx.Value(thermostatKey{}).(string); ok && id != only {
+		return false
+	}
+	return c.keep == nil || c.keep(id)
+}
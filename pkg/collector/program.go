@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// schedule returns the climate reference the program of t schedules at a
+// time in the thermostat's time zone, if its schedule is well formed: a row
+// for each day from Monday, each with the climate reference of every half
+// hour.
+func schedule(t client.Thermostat) (func(at time.Time) string, bool) {
+	sched := t.Program.Schedule
+	if len(sched) != 7 {
+		return nil, false
+	}
+	for _, day := range sched {
+		if len(day) != 48 {
+			return nil, false
+		}
+	}
+	return func(at time.Time) string {
+		return sched[(int(at.Weekday())+6)%7][at.Hour()*2+at.Minute()/30]
+	}, true
+}
+
+// climate returns the climate of the program of t with reference ref.
+func climate(t client.Thermostat, ref string) (ecobee.Climate, bool) {
+	for _, cl := range t.Program.Climates {
+		if cl.ClimateRef == ref {
+			return cl, true
+		}
+	}
+	return ecobee.Climate{}, false
+}
+
+// collectProgram exports the comfort setting the program of t schedules
+// now and its setpoints, which differ from the thermostat's own while a
+// hold or other event overrides the program.
+func (c *Collector) collectProgram(ch chan<- prometheus.Metric, t client.Thermostat) {
+	now, ok := localTime(t)
+	if !ok {
+		return
+	}
+	slot, ok := schedule(t)
+	if !ok {
+		return
+	}
+	cl, ok := climate(t, slot(now))
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.programClimate, prometheus.GaugeValue, 1, t.Identifier, t.Name, cl.Name)
+	ch <- prometheus.MustNewConstMetric(c.programTargetMin, prometheus.GaugeValue, float64(cl.HeatTemp)/10, t.Identifier, t.Name)
+	ch <- prometheus.MustNewConstMetric(c.programTargetMax, prometheus.GaugeValue, float64(cl.CoolTemp)/10, t.Identifier, t.Name)
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// series is a CounterVec whose first label is the thermostat id, which
+// tracks the label values of its series so that those of thermostats and
+// sensors that are gone, or were renamed, can be deleted rather than
+// exported until the exporter restarts.
+type series struct {
+	*prometheus.CounterVec
+	names []int // indexes of the labels holding names, which may change
+
+	mu    sync.Mutex
+	byKey map[string][]string // label values by the values of the others
+}
+
+func newSeries(vec *prometheus.CounterVec, names ...int) *series {
+	return &series{CounterVec: vec, names: names, byKey: make(map[string][]string)}
+}
+
+// with returns the counter of the series with the label values, deleting
+// the series that had the same values but for the names.
+func (s *series) with(values ...string) prometheus.Counter {
+	other := append([]string(nil), values...)
+	for _, i := range s.names {
+		other[i] = ""
+	}
+	key := strings.Join(other, "\xff")
+	s.mu.Lock()
+	if old, ok := s.byKey[key]; ok && !slices.Equal(old, values) {
+		s.DeleteLabelValues(old...)
+	}
+	s.byKey[key] = append([]string(nil), values...)
+	s.mu.Unlock()
+	return s.WithLabelValues(values...)
+}
+
+// retain deletes the series whose label values keep returns false for.
+func (s *series) retain(keep func(values []string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, values := range s.byKey {
+		if !keep(values) {
+			s.DeleteLabelValues(values...)
+			delete(s.byKey, key)
+		}
+	}
+}
+
+// pruneMap deletes the entries of m whose keys keep returns false for,
+// holding mu.
+func pruneMap[V any](mu *sync.Mutex, m map[string]V, keep func(key string) bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key := range m {
+		if !keep(key) {
+			delete(m, key)
+		}
+	}
+}
+
+// prune forgets the thermostats no longer in the summary: the state kept
+// about them between collections, and the series of their counters.
+func (c *Collector) prune(registered map[string]ecobee.ThermostatSummary) {
+	if c.revisions != nil {
+		c.revisions.prune(registered)
+	}
+	// state is keyed by thermostat id, or by it and a sensor id or the
+	// like after a slash
+	keep := func(key string) bool {
+		id, _, _ := strings.Cut(key, "/")
+		_, ok := registered[id]
+		return ok
+	}
+	pruneMap(&c.setpoints.mu, c.setpoints.byID, keep)
+	pruneMap(&c.clockSkews.mu, c.clockSkews.byID, keep)
+	pruneMap(&c.fetchDurations.mu, c.fetchDurations.byID, keep)
+	pruneMap(&c.occupancies.mu, c.occupancies.bySensor, keep)
+	if c.conflicts != nil {
+		pruneMap(&c.conflicts.mu, c.conflicts.since, keep)
+	}
+	if c.risk != nil {
+		pruneMap(&c.risk.mu, c.risk.damp, keep)
+	}
+	if c.equipmentRuntime != nil {
+		pruneMap(&c.equipmentRuntime.mu, c.equipmentRuntime.counted, keep)
+	}
+	if c.balance != nil {
+		pruneMap(&c.balance.mu, c.balance.byID, keep)
+	}
+	if c.filterRuntime != nil {
+		pruneMap(&c.filterRuntime.mu, c.filterRuntime.byID, keep)
+	}
+	if c.thermal != nil {
+		pruneMap(&c.thermal.mu, c.thermal.byID, keep)
+	}
+
+	keepSeries := func(values []string) bool { return keep(values[0]) }
+	c.setpointChanges.retain(keepSeries)
+	c.occupancyTransitions.retain(keepSeries)
+	c.heatPumpRuntime.retain(keepSeries)
+	c.equipmentRuntimeSeconds.retain(keepSeries)
+}
+
+// pruneSensors forgets the sensors of the thermostat id that aren't in
+// present, such as those removed from it.
+func (c *Collector) pruneSensors(id string, present map[string]bool) {
+	keep := func(key string) bool {
+		tid, sid, _ := strings.Cut(key, "/")
+		return tid != id || present[sid]
+	}
+	pruneMap(&c.occupancies.mu, c.occupancies.bySensor, keep)
+	if c.risk != nil {
+		pruneMap(&c.risk.mu, c.risk.damp, keep)
+	}
+	c.occupancyTransitions.retain(func(values []string) bool {
+		return values[0] != id || present[values[2]]
+	})
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeries(t *testing.T) {
+	newVec := func() *series {
+		return newSeries(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "test_total",
+			Help: "test",
+		}, []string{"thermostat_id", "thermostat_name", "cause"}), 1)
+	}
+	tests := []struct {
+		name       string
+		use        [][]string
+		registered map[string]ecobee.ThermostatSummary // nil to not prune
+		want       int
+	}{
+		{
+			name: "distinct",
+			use:  [][]string{{"1", "Main", "manual"}, {"1", "Main", "hold"}, {"2", "Up", "manual"}},
+			want: 3,
+		},
+		{
+			name: "renamed",
+			use:  [][]string{{"1", "Main", "manual"}, {"1", "Downstairs", "manual"}},
+			want: 1,
+		},
+		{
+			name:       "gone",
+			use:        [][]string{{"1", "Main", "manual"}, {"2", "Up", "manual"}},
+			registered: map[string]ecobee.ThermostatSummary{"2": {}},
+			want:       1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newVec()
+			for _, values := range tt.use {
+				s.with(values...).Inc()
+			}
+			if tt.registered != nil {
+				s.retain(func(values []string) bool {
+					_, ok := tt.registered[values[0]]
+					return ok
+				})
+			}
+			if got := testutil.CollectAndCount(s); got != tt.want {
+				t.Errorf("got %d series, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c, _ := fleet()
+	c.setpoints.byID["1"] = setpoint{}
+	c.setpoints.byID["2"] = setpoint{}
+	c.occupancies.bySensor["1/rs:100"] = true
+	c.occupancies.bySensor["2/rs:100"] = true
+	c.occupancyTransitions.with("1", "Main", "rs:100", "Hall", "ecobee3_remote_sensor", TransitionVacant)
+	c.occupancyTransitions.with("2", "Up", "rs:100", "Bed", "ecobee3_remote_sensor", TransitionVacant)
+	c.occupancyTransitions.with("2", "Up", "rs:101", "Den", "ecobee3_remote_sensor", TransitionVacant)
+
+	c.prune(map[string]ecobee.ThermostatSummary{"2": {}})
+	if _, ok := c.setpoints.byID["1"]; ok {
+		t.Error("setpoints of a thermostat no longer registered kept")
+	}
+	if _, ok := c.occupancies.bySensor["1/rs:100"]; ok {
+		t.Error("occupancy of a thermostat no longer registered kept")
+	}
+	if got := testutil.CollectAndCount(c.occupancyTransitions); got != 2 {
+		t.Errorf("got %d occupancy series, want 2", got)
+	}
+
+	c.pruneSensors("2", map[string]bool{"rs:101": true})
+	if _, ok := c.occupancies.bySensor["2/rs:100"]; ok {
+		t.Error("occupancy of a removed sensor kept")
+	}
+	if got := testutil.CollectAndCount(c.occupancyTransitions); got != 1 {
+		t.Errorf("got %d occupancy series, want 1", got)
+	}
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// WithChangeDetection skips fetching a thermostat when its thermostat and
+// runtime revisions in the summary are the same as when it was last
+// fetched, along with its interval revision with WithIntervals and its
+// alerts revision with WithAlerts, exporting the thermostat from that
+// fetch instead. Skipped fetches are counted in
+// fetches_skipped_total.
+func WithChangeDetection() Option {
+	return func(c *Collector) {
+		c.revisions = &revisions{entries: make(map[string]revisionEntry)}
+	}
+}
+
+// revisions holds the most recent fetch of each thermostat along with the
+// revisions it was fetched at.
+type revisions struct {
+	mu      sync.Mutex
+	entries map[string]revisionEntry
+}
+
+type revisionEntry struct {
+	thermostat, runtime, interval, alerts string
+	t                                     client.Thermostat
+}
+
+// get returns the thermostat summarized by s if it hasn't changed since it
+// was last fetched. The interval revision, which changes as the extended
+// runtime does, only counts if intervals is true, and the alerts revision
+// only if alerts is.
+func (r *revisions) get(s ecobee.ThermostatSummary, intervals, alerts bool) (client.Thermostat, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[s.Identifier]
+	if !ok || e.thermostat != s.ThermostatRevision || e.runtime != s.RuntimeRevision ||
+		(intervals && e.interval != s.IntervalRevision) || (alerts && e.alerts != s.AlertsRevision) {
+		return client.Thermostat{}, false
+	}
+	return e.t, true
+}
+
+// put records t as fetched at the revisions in s.
+func (r *revisions) put(s ecobee.ThermostatSummary, t client.Thermostat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[t.Identifier] = revisionEntry{
+		thermostat: s.ThermostatRevision,
+		runtime:    s.RuntimeRevision,
+		interval:   s.IntervalRevision,
+		alerts:     s.AlertsRevision,
+		t:          t,
+	}
+}
+
+// prune forgets thermostats no longer in the summary.
+func (r *revisions) prune(registered map[string]ecobee.ThermostatSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.entries {
+		if _, ok := registered[id]; !ok {
+			delete(r.entries, id)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+func TestRevisions(t *testing.T) {
+	fetched := ecobee.ThermostatSummary{
+		Identifier:         "1",
+		ThermostatRevision: "t1",
+		RuntimeRevision:    "r1",
+		IntervalRevision:   "i1",
+		AlertsRevision:     "a1",
+	}
+	changed := func(f func(s *ecobee.ThermostatSummary)) ecobee.ThermostatSummary {
+		s := fetched
+		f(&s)
+		return s
+	}
+	tests := []struct {
+		name              string
+		s                 ecobee.ThermostatSummary
+		intervals, alerts bool
+		want              bool
+	}{
+		{"unchanged", fetched, true, true, true},
+		{"other thermostat", changed(func(s *ecobee.ThermostatSummary) { s.Identifier = "2" }), false, false, false},
+		{"thermostat", changed(func(s *ecobee.ThermostatSummary) { s.ThermostatRevision = "t2" }), false, false, false},
+		{"runtime", changed(func(s *ecobee.ThermostatSummary) { s.RuntimeRevision = "r2" }), false, false, false},
+		{"interval", changed(func(s *ecobee.ThermostatSummary) { s.IntervalRevision = "i2" }), true, false, false},
+		{"interval ignored", changed(func(s *ecobee.ThermostatSummary) { s.IntervalRevision = "i2" }), false, true, true},
+		{"alerts", changed(func(s *ecobee.ThermostatSummary) { s.AlertsRevision = "a2" }), false, true, false},
+		{"alerts ignored", changed(func(s *ecobee.ThermostatSummary) { s.AlertsRevision = "a2" }), true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &revisions{entries: make(map[string]revisionEntry)}
+			r.put(fetched, client.Thermostat{Identifier: "1", Name: "Main"})
+			th, ok := r.get(tt.s, tt.intervals, tt.alerts)
+			if ok != tt.want {
+				t.Fatalf("get = %t, want %t", ok, tt.want)
+			}
+			if ok && th.Name != "Main" {
+				t.Errorf("got thermostat %q, want Main", th.Name)
+			}
+		})
+	}
+}
+
+func TestRevisionsPrune(t *testing.T) {
+	r := &revisions{entries: make(map[string]revisionEntry)}
+	for _, id := range []string{"1", "2"} {
+		s := ecobee.ThermostatSummary{Identifier: id}
+		r.put(s, client.Thermostat{Identifier: id})
+	}
+	r.prune(map[string]ecobee.ThermostatSummary{"2": {}})
+	if _, ok := r.get(ecobee.ThermostatSummary{Identifier: "1"}, false, false); ok {
+		t.Error("thermostat no longer registered kept")
+	}
+	if _, ok := r.get(ecobee.ThermostatSummary{Identifier: "2"}, false, false); !ok {
+		t.Error("registered thermostat forgotten")
+	}
+}
+
+func TestChangeDetection(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		skipped float64 // by the second collection
+	}{
+		{"off", nil, 0},
+		{"on", []Option{WithChangeDetection()}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := fleet(tt.opts...)
+			drain(c)
+			if got := testutil.ToFloat64(c.skippedFetches); got != 0 {
+				t.Fatalf("skipped %v fetches on the first collection, want 0", got)
+			}
+			drain(c)
+			if got := testutil.ToFloat64(c.skippedFetches); got != tt.skipped {
+				t.Errorf("skipped %v fetches on the second collection, want %v", got, tt.skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Risk configures the mold and frost risk indicators of WithRisk.
+// Temperatures are in degrees Fahrenheit.
+type Risk struct {
+	// A sensor is at risk of mold once its humidity has been at least
+	// MoldHumidity percent, at a temperature of at most MoldTemperature,
+	// for MoldDuration.
+	MoldHumidity    float64
+	MoldTemperature float64
+	MoldDuration    time.Duration
+
+	// A sensor is at risk of frost, such as of pipes freezing, while its
+	// temperature is at most FrostTemperature.
+	FrostTemperature float64
+}
+
+// WithRisk exports mold_risk for sensors that report humidity and
+// frost_risk for sensors that report temperature, flagging the conditions
+// in r for alerting.
+func WithRisk(r Risk) Option {
+	return func(c *Collector) {
+		c.risk = &risk{Risk: r, damp: make(map[string]time.Time)}
+	}
+}
+
+type risk struct {
+	Risk
+
+	mu   sync.Mutex
+	damp map[string]time.Time // since when each damp sensor has been so
+}
+
+// collectRisk exports the risk indicators of the sensor labeled by sFields,
+// given its temperature and, if it reports one, its humidity.
+func (c *Collector) collectRisk(ch chan<- prometheus.Metric, sFields []string, temp float64, rh float64, hasRH bool) {
+	r := c.risk
+	ch <- prometheus.MustNewConstMetric(c.frostRisk, prometheus.GaugeValue, Bool2Float[temp <= r.FrostTemperature], sFields...)
+	if !hasRH {
+		return
+	}
+	key := sFields[0] + "/" + sFields[2]
+	damp := rh >= r.MoldHumidity && temp <= r.MoldTemperature
+	now := c.clock.Now()
+	r.mu.Lock()
+	since, ok := r.damp[key]
+	if damp && !ok {
+		since = now
+		r.damp[key] = now
+	} else if !damp {
+		delete(r.damp, key)
+	}
+	r.mu.Unlock()
+	atRisk := damp && now.Sub(since) >= r.MoldDuration
+	ch <- prometheus.MustNewConstMetric(c.moldRisk, prometheus.GaugeValue, Bool2Float[atRisk], sFields...)
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// Causes of a setpoint change, the values of the cause label of
+// setpoint_changes_total.
+const (
+	// CauseManual is someone setting a temperature, at the thermostat or
+	// in the app, which holds it.
+	CauseManual = "manual"
+
+	// CauseHold is a hold of a comfort setting, such as Away, or another
+	// event overriding the program, such as a vacation or a utility's
+	// demand response event.
+	CauseHold = "hold"
+
+	// CauseSchedule is the program moving to its next comfort setting, or
+	// resuming once a hold ends.
+	CauseSchedule = "schedule"
+)
+
+// setpoints holds the setpoints of each thermostat when it was last
+// collected, to count the changes between collections.
+type setpoints struct {
+	mu   sync.Mutex
+	byID map[string]setpoint
+}
+
+type setpoint struct {
+	rev        string
+	heat, cool int
+}
+
+// cause returns why a thermostat with events has the setpoints it has:
+// the first running event, which overrides the program, or the program
+// itself.
+func cause(events []ecobee.Event) string {
+	for _, e := range events {
+		if !e.Running {
+			continue
+		}
+		if e.Type == "hold" && e.HoldClimateRef == "" {
+			return CauseManual
+		}
+		return CauseHold
+	}
+	return CauseSchedule
+}
+
+// collectSetpointChange counts a change of the setpoints of t since it was
+// last collected. Thermostats collected from data no newer than before,
+// such as from a snapshot, are not compared.
+func (c *Collector) collectSetpointChange(t client.Thermostat) {
+	cur := setpoint{rev: t.Runtime.RuntimeRev, heat: t.Runtime.DesiredHeat, cool: t.Runtime.DesiredCool}
+	c.setpoints.mu.Lock()
+	defer c.setpoints.mu.Unlock()
+	prev, ok := c.setpoints.byID[t.Identifier]
+	if ok && cur.rev != "" && cur.rev <= prev.rev {
+		return
+	}
+	c.setpoints.byID[t.Identifier] = cur
+	if ok && (cur.heat != prev.heat || cur.cool != prev.cool) {
+		c.setpointChanges.with(t.Identifier, t.Name, cause(t.Events)).Inc()
+	}
+}
@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// WithSnapshot keeps the last successful fetch of each thermostat in the
+// file at path, so that thermostats that fail to fetch or are skipped,
+// including every thermostat when the first collection after a restart
+// fails, are exported from it instead of disappearing. The cache_age_seconds
+// metric reports how old each thermostat's data is. Thermostats not fetched
+// for maxAge, if it is positive, and thermostats no longer registered to the
+// account are dropped from the snapshot, so their series expire.
+func WithSnapshot(path string, maxAge time.Duration) Option {
+	return func(c *Collector) {
+		c.snapshot = &snapshot{path: path, maxAge: maxAge}
+	}
+}
+
+// snapshot is the last successful fetch of each thermostat, persisted to
+// disk.
+type snapshot struct {
+	path   string
+	maxAge time.Duration
+	once   sync.Once
+
+	mu      sync.Mutex
+	entries map[string]snapshotEntry
+}
+
+type snapshotEntry struct {
+	Fetched         time.Time              `json:"fetched"`
+	EquipmentStatus ecobee.EquipmentStatus `json:"equipmentStatus"`
+
+	// Thermostat is the thermostat object as sent by the API, so that
+	// additional metrics can be read from it as well.
+	Thermostat json.RawMessage `json:"thermostat"`
+}
+
+// load reads the snapshot file the first time it is called. A missing file
+// is not an error.
+func (s *snapshot) load(ctx context.Context, logger *slog.Logger) {
+	s.once.Do(func() {
+		s.entries = make(map[string]snapshotEntry)
+		b, err := os.ReadFile(s.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err == nil {
+			err = json.Unmarshal(b, &s.entries)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "unable to read snapshot, starting without one", "path", s.path, "error", err)
+		}
+	})
+}
+
+// put records a thermostat fetched at the given time.
+func (s *snapshot) put(t client.Thermostat, es ecobee.EquipmentStatus, fetched time.Time) {
+	raw := t.Raw
+	if raw == nil {
+		raw, _ = json.Marshal(t)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[t.Identifier] = snapshotEntry{Fetched: fetched, EquipmentStatus: es, Thermostat: raw}
+}
+
+// prune drops thermostats fetched more than maxAge before now and, if
+// registered is not nil, thermostats not in it.
+func (s *snapshot) prune(now time.Time, registered map[string]ecobee.ThermostatSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.entries {
+		if _, ok := registered[id]; registered != nil && !ok {
+			delete(s.entries, id)
+		} else if s.maxAge > 0 && now.Sub(e.Fetched) > s.maxAge {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// get returns the thermostats with the given IDs, or all of them if ids is
+// nil, ordered by ID.
+func (s *snapshot) get(ids []string) (map[string]snapshotEntry, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ids == nil {
+		for id := range s.entries {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+	found := make(map[string]snapshotEntry, len(ids))
+	var order []string
+	for _, id := range ids {
+		if e, ok := s.entries[id]; ok {
+			found[id] = e
+			order = append(order, id)
+		}
+	}
+	return found, order
+}
+
+// save replaces the snapshot file atomically.
+func (s *snapshot) save() error {
+	s.mu.Lock()
+	b, err := json.Marshal(s.entries)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// collectSnapshot exports the snapshotted thermostats with the given IDs, or
+// all of them if ids is nil, in place of a live fetch, and returns the IDs
+// it exported. The equipment status in summaries, if present, replaces the
+// snapshotted one.
+func (c *Collector) collectSnapshot(ctx context.Context, ch chan<- prometheus.Metric, ids []string, summaries map[string]ecobee.ThermostatSummary) map[string]bool {
+	c.snapshot.prune(c.clock.Now(), nil)
+	entries, order := c.snapshot.get(ids)
+	exported := make(map[string]bool, len(order))
+	for _, id := range order {
+		if !c.wanted(ctx, id) {
+			continue
+		}
+		e := entries[id]
+		var t client.Thermostat
+		if err := json.Unmarshal(e.Thermostat, &t); err != nil {
+			c.logger.WarnContext(ctx, "unable to decode snapshotted thermostat", "thermostat_id", id, "error", err)
+			continue
+		}
+		es := e.EquipmentStatus
+		if s, ok := summaries[id]; ok {
+			es = s.EquipmentStatus
+		}
+		c.collectThermostat(ctx, ch, t, es)
+		ch <- prometheus.MustNewConstMetric(
+			c.cacheAge, prometheus.GaugeValue, c.clock.Since(e.Fetched).Seconds(), t.Identifier, t.Name,
+		)
+		exported[id] = true
+	}
+	return exported
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/thermal"
+)
+
+// WithThermalModel fits a thermal model of the space each thermostat
+// controls from its indoor and outdoor temperatures while its heating and
+// cooling are idle, and exports the fitted heat loss coefficient and time
+// constant. Observations are weighed by their age over window. Models are
+// kept in memory, so they start over when the exporter restarts.
+func WithThermalModel(window time.Duration) Option {
+	return func(c *Collector) {
+		c.thermal = &thermalModels{window: window, byID: make(map[string]*thermal.Model)}
+	}
+}
+
+type thermalModels struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	byID map[string]*thermal.Model
+}
+
+// idle reports whether no heating or cooling equipment is running.
+func idle(es ecobee.EquipmentStatus) bool {
+	return !(es.HeatPump || es.HeatPump2 || es.HeatPump3 ||
+		es.CompCool1 || es.CompCool2 ||
+		es.AuxHeat1 || es.AuxHeat2 || es.AuxHeat3)
+}
+
+// collectThermal adds the indoor temperature of t and the outdoor
+// temperature, as of its runtime revision, to its model and exports the
+// model once it can be estimated.
+func (c *Collector) collectThermal(ch chan<- prometheus.Metric, t client.Thermostat, es ecobee.EquipmentStatus, outdoor float64) {
+	at, err := time.Parse("060102150405", t.Runtime.RuntimeRev)
+	if err != nil {
+		return
+	}
+	indoor := float64(t.Runtime.ActualTemperature) / 10
+
+	tm := c.thermal
+	tm.mu.Lock()
+	m, ok := tm.byID[t.Identifier]
+	if !ok {
+		m = thermal.NewModel(tm.window)
+		tm.byID[t.Identifier] = m
+	}
+	m.Observe(at, indoor, outdoor, idle(es))
+	e, ok := m.Estimate()
+	tm.mu.Unlock()
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.heatLoss, prometheus.GaugeValue, e.HeatLoss, t.Identifier, t.Name)
+	ch <- prometheus.MustNewConstMetric(c.timeConstant, prometheus.GaugeValue, e.TimeConstant.Seconds(), t.Identifier, t.Name)
+	ch <- prometheus.MustNewConstMetric(c.thermalSamples, prometheus.GaugeValue, e.Samples, t.Identifier, t.Name)
+}
@@ -0,0 +1,40 @@
+package collector
+
+// TemperatureMetrics are the names, without the prefix, of the metrics in
+// degrees Fahrenheit, including the zone temperatures of pipeline.Zones.
+var TemperatureMetrics = []string{
+	"actual_temperature",
+	"raw_temperature",
+	"target_temperature_min",
+	"target_temperature_max",
+	"heat_range_high",
+	"heat_range_low",
+	"cool_range_high",
+	"cool_range_low",
+	"program_target_temperature_min",
+	"program_target_temperature_max",
+	"interval_temperature",
+	"interval_target_temperature_min",
+	"interval_target_temperature_max",
+	"temperature",
+	"dew_point",
+	"heat_index",
+	"thermostat_dew_point",
+	"thermostat_heat_index",
+	"sensor_temperature_mean",
+	"sensor_temperature_min",
+	"sensor_temperature_max",
+	"temperature_alert_low",
+	"temperature_alert_high",
+	"outdoor_temperature",
+	"forecast_temperature_high",
+	"forecast_temperature_low",
+	"zone_temperature",
+}
+
+// TemperatureDifferenceMetrics are the names, without the prefix, of the
+// metrics of differences between temperatures, in degrees Fahrenheit, which
+// convert to other units without an offset.
+var TemperatureDifferenceMetrics = []string{
+	"heat_cool_min_delta",
+}
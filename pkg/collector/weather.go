@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/weather"
+)
+
+// ecobeeWeather is the source label of conditions from the weather ecobee
+// reports with a thermostat.
+const ecobeeWeather = "ecobee"
+
+// missingTemperature is the temperature ecobee reports when it has none.
+const missingTemperature = -5002
+
+// conversions from the units of ecobee's weather
+const (
+	pascalsPerMillibar    = 100
+	metersPerSecondPerMPH = 0.44704
+)
+
+// WithWeatherFallback exports the outdoor conditions of the first of srcs
+// to provide them, in order, for thermostats whose ecobee weather is
+// missing, or older than maxAge. The sources are fetched again only once
+// refresh has passed; if fetching all of them fails, the conditions last
+// fetched are used.
+func WithWeatherFallback(maxAge, refresh time.Duration, srcs ...weather.Source) Option {
+	return func(c *Collector) {
+		if len(srcs) == 0 {
+			return
+		}
+		c.weather = &weatherFallback{srcs: srcs, maxAge: maxAge, refresh: refresh}
+	}
+}
+
+// weatherFallback holds the most recently fetched conditions of a list of
+// weather.Sources.
+type weatherFallback struct {
+	srcs    []weather.Source
+	maxAge  time.Duration
+	refresh time.Duration
+
+	mu      sync.Mutex
+	fetched time.Time
+	current weather.Conditions
+	source  string // name of the source of current
+	tried   string // collection that last tried fetching, to try once each
+}
+
+// ecobeeConditions returns the current conditions of the weather ecobee
+// reports with t.
+func ecobeeConditions(t client.Thermostat) (weather.Conditions, bool) {
+	if len(t.Weather.Forecasts) == 0 || t.Weather.Forecasts[0].Temperature == missingTemperature {
+		return weather.Conditions{}, false
+	}
+	ts, err := time.Parse(apiTime, t.Weather.Timestamp)
+	if err != nil {
+		return weather.Conditions{}, false
+	}
+	f := t.Weather.Forecasts[0]
+	return weather.Conditions{
+		Time:        ts,
+		Temperature: float64(f.Temperature) / 10,
+		Humidity:    float64(f.RelativeHumidity),
+		HasHumidity: f.RelativeHumidity > 0,
+	}, true
+}
+
+// outdoor returns the outdoor conditions of t and the source they are
+// from: ecobee's weather, unless it is missing or stale and there is a
+// fallback.
+func (c *Collector) outdoor(ctx context.Context, t client.Thermostat) (weather.Conditions, string, bool) {
+	cond, ok := ecobeeConditions(t)
+	w := c.weather
+	if w == nil || (ok && c.clock.Since(cond.Time) <= w.maxAge) {
+		return cond, ecobeeWeather, ok
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now, id := c.clock.Now(), CollectionID(ctx)
+	if (w.fetched.IsZero() || now.Sub(w.fetched) >= w.refresh) && w.tried != id {
+		w.tried = id
+		var errs []error
+		for _, src := range w.srcs {
+			cur, err := src.Current(ctx)
+			if err == nil {
+				w.current, w.source, w.fetched = cur, src.Name(), now
+				break
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == len(w.srcs) {
+			c.error(ctx, StageWeather, "", errors.Join(errs...))
+		}
+	}
+	if w.fetched.IsZero() {
+		// nothing better than stale ecobee weather, if any
+		return cond, ecobeeWeather, ok
+	}
+	return w.current, w.source, true
+}
+
+// collectOutdoor exports the outdoor conditions of t, returning the
+// temperature.
+func (c *Collector) collectOutdoor(ctx context.Context, ch chan<- prometheus.Metric, t client.Thermostat) (float64, bool) {
+	cond, source, ok := c.outdoor(ctx, t)
+	if !ok {
+		return 0, false
+	}
+	ch <- prometheus.MustNewConstMetric(c.outdoorTemperature, prometheus.GaugeValue, cond.Temperature, t.Identifier, t.Name, source)
+	if cond.HasHumidity {
+		ch <- prometheus.MustNewConstMetric(c.outdoorHumidity, prometheus.GaugeValue, cond.Humidity, t.Identifier, t.Name, source)
+	}
+	return cond.Temperature, true
+}
+
+// collectForecast exports the pressure and wind speed of the current
+// conditions of the weather ecobee reports with t, which the fallback
+// sources don't provide, and the forecast high and low of the next day.
+func (c *Collector) collectForecast(ch chan<- prometheus.Metric, t client.Thermostat) {
+	fs := t.Weather.Forecasts
+	if len(fs) > 0 && fs[0].Temperature != missingTemperature {
+		// pressure is in millibars and wind speed in miles per hour
+		if fs[0].Pressure > 0 {
+			ch <- prometheus.MustNewConstMetric(c.outdoorPressure, prometheus.GaugeValue, float64(fs[0].Pressure)*pascalsPerMillibar, t.Identifier, t.Name)
+		}
+		if fs[0].WindSpeed >= 0 {
+			ch <- prometheus.MustNewConstMetric(c.outdoorWindSpeed, prometheus.GaugeValue, float64(fs[0].WindSpeed)*metersPerSecondPerMPH, t.Identifier, t.Name)
+		}
+	}
+	// the first forecast is of today, the second of the next day
+	if len(fs) > 1 {
+		if f := fs[1]; f.TempHigh != missingTemperature && f.TempLow != missingTemperature {
+			ch <- prometheus.MustNewConstMetric(c.forecastTemperatureHigh, prometheus.GaugeValue, float64(f.TempHigh)/10, t.Identifier, t.Name)
+			ch <- prometheus.MustNewConstMetric(c.forecastTemperatureLow, prometheus.GaugeValue, float64(f.TempLow)/10, t.Identifier, t.Name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+	"github.com/joeshaw/ecobee-exporter/pkg/weather"
+)
+
+// source is a weather.Source of a constant temperature, or one that fails.
+type source struct {
+	name        string
+	temperature float64
+	fail        bool
+}
+
+func (s source) Name() string {
+	return s.name
+}
+
+func (s source) Current(context.Context) (weather.Conditions, error) {
+	if s.fail {
+		return weather.Conditions{}, errors.New(s.name + " is down")
+	}
+	return weather.Conditions{Temperature: s.temperature}, nil
+}
+
+func TestWeatherFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		srcs        []weather.Source
+		source      string // empty if none has conditions
+		temperature float64
+		errors      int
+	}{
+		{
+			name:        "first",
+			srcs:        []weather.Source{source{name: "nws", temperature: 50}, source{name: "open-meteo", temperature: 51}},
+			source:      "nws",
+			temperature: 50,
+		},
+		{
+			name:        "next",
+			srcs:        []weather.Source{source{name: "nws", fail: true}, source{name: "open-meteo", temperature: 51}},
+			source:      "open-meteo",
+			temperature: 51,
+		},
+		{
+			name:   "none",
+			srcs:   []weather.Source{source{name: "nws", fail: true}, source{name: "open-meteo", fail: true}},
+			errors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []*Error
+			c := NewEcobeeCollector(nil, "ecobee",
+				WithClock(clock.NewFake(time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))),
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				WithErrorHandler(func(e *Error) { errs = append(errs, e) }),
+				WithWeatherFallback(3*time.Hour, 15*time.Minute, tt.srcs...),
+			)
+			// the thermostat has no ecobee weather
+			ctx := withCollectionID(context.Background(), newCollectionID())
+			cond, source, ok := c.outdoor(ctx, client.Thermostat{Identifier: "1"})
+			if !ok {
+				source = ""
+			}
+			if source != tt.source || cond.Temperature != tt.temperature {
+				t.Errorf("got %v from %q, want %v from %q", cond.Temperature, source, tt.temperature, tt.source)
+			}
+			if len(errs) != tt.errors {
+				t.Errorf("got %d errors, want %d", len(errs), tt.errors)
+			}
+		})
+	}
+}
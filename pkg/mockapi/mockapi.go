@@ -0,0 +1,462 @@
+// Package mockapi implements enough of the ecobee API to exercise the
+// exporter without ecobee: the thermostat, thermostat summary, runtime
+// report, group and management hierarchy endpoints, plus the PIN
+// authorization and token endpoints.
+package mockapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// Fixture is a thermostat served by the mock API.
+type Fixture struct {
+	Thermostat client.Thermostat
+
+	// Equipment lists the equipment reported as running in the thermostat
+	// summary, using API names such as "heatPump" or "fan".
+	Equipment []string
+
+	// Group is the name of the group the thermostat is in, if any.
+	Group string
+
+	// Set is the path of the management set the thermostat is in, such as
+	// "/Building 1/Floor 2", for thermostats of an EMS account.
+	Set string
+
+	// History returns the equipment that ran during the five-minute
+	// interval starting at t, in the thermostat's local time, for the
+	// runtime report, and false for intervals yet to come. Each equipment
+	// named by a requested column ran for the whole interval. The runtime
+	// report is empty without a History.
+	History func(t time.Time) (equipment []string, ok bool)
+
+	// Readings returns the values of the runtime report columns other than
+	// equipment, such as "zoneAveTemp", for the five-minute interval
+	// starting at t, in the thermostat's local time. Columns it has no
+	// value for are reported as 0.
+	Readings func(t time.Time) map[string]float64
+}
+
+// reportEquipment maps the runtime report columns of equipment whose
+// names differ from those of the thermostat summary.
+var reportEquipment = map[string]string{"compHeat1": "heatPump", "compHeat2": "heatPump2"}
+
+// Fixtures supplies the thermostats served by the mock API. It is consulted
+// on every request, so fixtures may change over time.
+type Fixtures interface {
+	Fixtures() []Fixture
+}
+
+// Static is a fixed set of Fixtures.
+type Static []Fixture
+
+// Fixtures implements Fixtures.
+func (s Static) Fixtures() []Fixture {
+	return s
+}
+
+// Handler serves the mock API.
+type Handler struct {
+	fixtures Fixtures
+
+	// RequireAuth makes the thermostat endpoints reject requests without
+	// an access token issued by the token endpoint.
+	RequireAuth bool
+
+	// Privileges are served by the management hierarchy user endpoint.
+	Privileges []client.Privilege
+
+	mu       sync.Mutex
+	failures map[string]int
+	tokens   map[string]bool
+	pins     int
+	requests map[string]int
+}
+
+// NewHandler returns a Handler serving f.
+func NewHandler(f Fixtures) *Handler {
+	return &Handler{
+		fixtures: f,
+		failures: make(map[string]int),
+		tokens:   make(map[string]bool),
+		requests: make(map[string]int),
+	}
+}
+
+// Fail makes requests to path respond with the HTTP status code until Fail
+// is called again with a code of 0.
+func (h *Handler) Fail(path string, code int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if code == 0 {
+		delete(h.failures, path)
+		return
+	}
+	h.failures[path] = code
+}
+
+// Requests returns the number of requests received for path.
+func (h *Handler) Requests(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[path]
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests[r.URL.Path]++
+	code := h.failures[r.URL.Path]
+	h.mu.Unlock()
+	if code != 0 {
+		w.WriteHeader(code)
+		writeJSON(w, map[string]interface{}{"status": ecobee.Status{Code: 3, Message: "Processing error."}})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/authorize":
+		h.authorize(w, r)
+	case "/token":
+		h.token(w, r)
+	case "/1/thermostat":
+		if h.authorized(w, r) {
+			h.thermostat(w, r)
+		}
+	case "/1/thermostatSummary":
+		if h.authorized(w, r) {
+			h.thermostatSummary(w, r)
+		}
+	case "/1/runtimeReport":
+		if h.authorized(w, r) {
+			h.runtimeReport(w, r)
+		}
+	case "/1/group":
+		if h.authorized(w, r) {
+			h.groups(w, r)
+		}
+	case "/1/hierarchy/set":
+		if h.authorized(w, r) {
+			h.sets(w, r)
+		}
+	case "/1/hierarchy/user":
+		if h.authorized(w, r) {
+			writeJSON(w, map[string]interface{}{
+				"privileges": h.Privileges,
+				"status":     ecobee.Status{},
+			})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.pins++
+	n := h.pins
+	h.mu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"ecobeePin":  fmt.Sprintf("pin%d", n),
+		"code":       fmt.Sprintf("code%d", n),
+		"scope":      r.URL.Query().Get("scope"),
+		"expires_in": 900,
+		"interval":   30,
+	})
+}
+
+func (h *Handler) token(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	q := r.URL.Query()
+	switch q.Get("grant_type") {
+	case "ecobeePin", "refresh_token":
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	n := len(h.tokens) + 1
+	access := fmt.Sprintf("access%d", n)
+	h.tokens[access] = true
+	writeJSON(w, map[string]interface{}{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"refresh_token": fmt.Sprintf("refresh%d", n),
+		"expires_in":    3599,
+		"scope":         "smartRead",
+	})
+}
+
+func (h *Handler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if !h.RequireAuth {
+		return true
+	}
+	h.mu.Lock()
+	ok := h.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	h.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, map[string]interface{}{"status": ecobee.Status{Code: 14, Message: "Authentication token has expired. Refresh your tokens."}})
+	}
+	return ok
+}
+
+func selection(r *http.Request) ecobee.Selection {
+	var req struct {
+		Selection ecobee.Selection `json:"selection"`
+	}
+	json.Unmarshal([]byte(r.URL.Query().Get("json")), &req)
+	return req.Selection
+}
+
+func selected(sel ecobee.Selection, f Fixture) bool {
+	switch sel.SelectionType {
+	case "thermostats":
+		for _, m := range strings.Split(sel.SelectionMatch, ",") {
+			if m == f.Thermostat.Identifier {
+				return true
+			}
+		}
+		return false
+	case "managementSet":
+		return f.Set != "" && within(f.Set, sel.SelectionMatch)
+	}
+	return true
+}
+
+// within reports whether the set at path is the set at root or below it.
+func within(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
+
+func (h *Handler) thermostat(w http.ResponseWriter, r *http.Request) {
+	sel := selection(r)
+	list := []client.Thermostat{}
+	for _, f := range h.fixtures.Fixtures() {
+		if selected(sel, f) {
+			list = append(list, f.Thermostat)
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"page":           map[string]int{"page": 1, "totalPages": 1, "pageSize": len(list), "total": len(list)},
+		"thermostatList": list,
+		"status":         ecobee.Status{},
+	})
+}
+
+func (h *Handler) thermostatSummary(w http.ResponseWriter, r *http.Request) {
+	sel := selection(r)
+	revisions, statuses := []string{}, []string{}
+	for _, f := range h.fixtures.Fixtures() {
+		t := f.Thermostat
+		if !selected(sel, f) {
+			continue
+		}
+		revisions = append(revisions, strings.Join([]string{
+			t.Identifier, t.Name, fmt.Sprint(t.Runtime.Connected),
+			t.ThermostatRev, t.ThermostatRev, t.Runtime.RuntimeRev, t.Runtime.RuntimeRev,
+		}, ":"))
+		statuses = append(statuses, t.Identifier+":"+strings.Join(f.Equipment, ","))
+	}
+	resp := map[string]interface{}{
+		"revisionList":    revisions,
+		"thermostatCount": len(revisions),
+		"status":          ecobee.Status{},
+	}
+	if sel.IncludeEquipmentStatus {
+		resp["statusList"] = statuses
+	}
+	writeJSON(w, resp)
+}
+
+func (h *Handler) runtimeReport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Selection ecobee.Selection `json:"selection"`
+		StartDate string           `json:"startDate"`
+		EndDate   string           `json:"endDate"`
+		Columns   string           `json:"columns"`
+	}
+	json.Unmarshal([]byte(r.URL.Query().Get("json")), &req)
+	start, err1 := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	end, err2 := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]interface{}{"status": ecobee.Status{Code: 4, Message: "Serialization error. Malformed json."}})
+		return
+	}
+	columns := strings.Split(req.Columns, ",")
+
+	reports := []client.RuntimeReport{}
+	for _, f := range h.fixtures.Fixtures() {
+		if !selected(req.Selection, f) {
+			continue
+		}
+		rep := client.RuntimeReport{ThermostatIdentifier: f.Thermostat.Identifier, RowList: []string{}}
+		for t := start; t.Before(end.AddDate(0, 0, 1)); t = t.Add(5 * time.Minute) {
+			row := t.Format("2006-01-02,15:04:05")
+			var equipment []string
+			var readings map[string]float64
+			ok := false
+			if f.History != nil {
+				equipment, ok = f.History(t)
+			}
+			if ok && f.Readings != nil {
+				readings = f.Readings(t)
+			}
+			for _, c := range columns {
+				row += ","
+				if !ok {
+					continue
+				}
+				if v, ok := readings[c]; ok {
+					row += strconv.FormatFloat(v, 'f', 1, 64)
+					continue
+				}
+				name, v := c, 0
+				if n, ok := reportEquipment[c]; ok {
+					name = n
+				}
+				for _, e := range equipment {
+					if e == name {
+						v = 300
+					}
+				}
+				row += fmt.Sprint(v)
+			}
+			rep.RowList = append(rep.RowList, row)
+		}
+		rep.RowCount = len(rep.RowList)
+		reports = append(reports, rep)
+	}
+	writeJSON(w, map[string]interface{}{
+		"startDate":  req.StartDate,
+		"endDate":    req.EndDate,
+		"columns":    req.Columns,
+		"reportList": reports,
+		"status":     ecobee.Status{},
+	})
+}
+
+func (h *Handler) groups(w http.ResponseWriter, r *http.Request) {
+	groups := []client.Group{}
+	index := make(map[string]int)
+	for _, f := range h.fixtures.Fixtures() {
+		if f.Group == "" {
+			continue
+		}
+		i, ok := index[f.Group]
+		if !ok {
+			i = len(groups)
+			index[f.Group] = i
+			groups = append(groups, client.Group{GroupRef: fmt.Sprintf("%x", i+1), GroupName: f.Group})
+		}
+		groups[i].Thermostats = append(groups[i].Thermostats, f.Thermostat.Identifier)
+	}
+	writeJSON(w, map[string]interface{}{
+		"groups": groups,
+		"status": ecobee.Status{},
+	})
+}
+
+// sets serves the management sets at and below the requested path, built
+// from the paths of the fixtures.
+func (h *Handler) sets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SetPath string `json:"setPath"`
+	}
+	json.Unmarshal([]byte(r.URL.Query().Get("json")), &req)
+	if req.SetPath == "" {
+		req.SetPath = "/"
+	}
+
+	byPath := make(map[string]*client.ManagementSet)
+	var paths []string
+	var set func(path string) *client.ManagementSet
+	set = func(path string) *client.ManagementSet {
+		if s, ok := byPath[path]; ok {
+			return s
+		}
+		parent := ""
+		if path != "/" {
+			parent = path[:strings.LastIndex(path, "/")]
+			if parent == "" {
+				parent = "/"
+			}
+			set(parent)
+		}
+		s := &client.ManagementSet{SetName: path[strings.LastIndex(path, "/")+1:], SetPath: path, ParentPath: parent}
+		byPath[path] = s
+		paths = append(paths, path)
+		return s
+	}
+	for _, f := range h.fixtures.Fixtures() {
+		if f.Set != "" && within(f.Set, req.SetPath) {
+			s := set(f.Set)
+			s.Thermostats = append(s.Thermostats, f.Thermostat.Identifier)
+		}
+	}
+
+	// nest each set in its parent, deepest first so that children are
+	// complete when copied
+	sort.Slice(paths, func(i, j int) bool { return strings.Count(paths[i], "/") > strings.Count(paths[j], "/") })
+	sets := []client.ManagementSet{}
+	for _, p := range paths {
+		s := byPath[p]
+		if s.SetPath == req.SetPath || !within(s.SetPath, req.SetPath) {
+			continue
+		}
+		if s.ParentPath == req.SetPath {
+			sets = append(sets, *s)
+		} else {
+			parent := byPath[s.ParentPath]
+			parent.Children = append(parent.Children, *s)
+		}
+	}
+	if root, ok := byPath[req.SetPath]; ok && len(root.Thermostats) > 0 {
+		sets = append(sets, client.ManagementSet{SetName: root.SetName, SetPath: root.SetPath, ParentPath: root.ParentPath, Thermostats: root.Thermostats})
+	}
+	writeJSON(w, map[string]interface{}{
+		"sets":   sets,
+		"status": ecobee.Status{},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Server is a mock API listening on a local port.
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+// NewServer starts a Server serving f. Callers should Close it when done.
+func NewServer(f Fixtures) *Server {
+	h := NewHandler(f)
+	return &Server{Server: httptest.NewServer(h), Handler: h}
+}
+
+// Transport returns an http.RoundTripper that answers requests with h
+// in-process, without a network listener.
+func Transport(h http.Handler) http.RoundTripper {
+	return client.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result(), nil
+	})
+}
@@ -0,0 +1,309 @@
+// Package pipeline mutates, drops or adds metrics between collection and
+// exposition.
+package pipeline
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Transformer rewrites a set of gathered metric families. It may modify the
+// families in place and returns the families to pass on to the next step.
+type Transformer interface {
+	Transform(mfs []*dto.MetricFamily) []*dto.MetricFamily
+}
+
+// TransformerFunc adapts an ordinary function to Transformer.
+type TransformerFunc func([]*dto.MetricFamily) []*dto.MetricFamily
+
+// Transform calls f(mfs).
+func (f TransformerFunc) Transform(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	return f(mfs)
+}
+
+// Gatherer applies a sequence of transformers to the output of another
+// prometheus.Gatherer.
+type Gatherer struct {
+	g  prometheus.Gatherer
+	ts []Transformer
+}
+
+// New returns a Gatherer that applies ts, in order, to the metrics gathered
+// by g.
+func New(g prometheus.Gatherer, ts ...Transformer) *Gatherer {
+	return &Gatherer{g: g, ts: ts}
+}
+
+// Gather implements prometheus.Gatherer.
+func (p *Gatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := p.g.Gather()
+	for _, t := range p.ts {
+		mfs = t.Transform(mfs)
+	}
+	return mfs, err
+}
+
+// Drop removes the metric families whose names match re.
+func Drop(re *regexp.Regexp) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		kept := mfs[:0]
+		for _, mf := range mfs {
+			if !re.MatchString(mf.GetName()) {
+				kept = append(kept, mf)
+			}
+		}
+		return kept
+	})
+}
+
+// Scale replaces each gauge, counter and untyped value v in the families
+// matching re with v*factor + offset, for example to convert units.
+func Scale(re *regexp.Regexp, factor, offset float64) Transformer {
+	return mapValues(re, func(v float64) float64 {
+		return v*factor + offset
+	})
+}
+
+// Round rounds each gauge, counter and untyped value in the families
+// matching re to the given number of decimal places.
+func Round(re *regexp.Regexp, precision int) Transformer {
+	p := math.Pow(10, float64(precision))
+	return mapValues(re, func(v float64) float64 {
+		return math.Round(v*p) / p
+	})
+}
+
+func mapValues(re *regexp.Regexp, f func(float64) float64) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, mf := range mfs {
+			if !re.MatchString(mf.GetName()) {
+				continue
+			}
+			for _, m := range mf.Metric {
+				switch {
+				case m.Gauge != nil:
+					m.Gauge.Value = proto.Float64(f(m.Gauge.GetValue()))
+				case m.Counter != nil:
+					m.Counter.Value = proto.Float64(f(m.Counter.GetValue()))
+				case m.Untyped != nil:
+					m.Untyped.Value = proto.Float64(f(m.Untyped.GetValue()))
+				}
+			}
+		}
+		return mfs
+	})
+}
+
+// Labels adds labels to every metric in the families matching re,
+// replacing existing labels with the same name.
+func Labels(re *regexp.Regexp, labels map[string]string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, mf := range mfs {
+			if !re.MatchString(mf.GetName()) {
+				continue
+			}
+			for _, m := range mf.Metric {
+				for name, value := range labels {
+					setLabel(m, name, value)
+				}
+			}
+		}
+		return mfs
+	})
+}
+
+// Extract matches re against the value of the source label of every metric
+// and, when it matches, adds a label for each named group of re. Metrics
+// without the source label, or whose value doesn't match, are left alone.
+func Extract(source string, re *regexp.Regexp) Transformer {
+	names := re.SubexpNames()
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				var value string
+				var found bool
+				for _, lp := range m.Label {
+					if lp.GetName() == source {
+						value, found = lp.GetValue(), true
+						break
+					}
+				}
+				if !found {
+					continue
+				}
+				match := re.FindStringSubmatch(value)
+				for i := 1; i < len(match); i++ {
+					if names[i] != "" {
+						setLabel(m, names[i], match[i])
+					}
+				}
+			}
+		}
+		return mfs
+	})
+}
+
+// Alias replaces the value of the target label of each metric with an
+// alias looked up by the values of the key labels, joined with "/". For
+// example, with keys thermostat_id and sensor_id, "511863000001/rs:100"
+// aliases sensor rs:100 of thermostat 511863000001. A key label the metric
+// lacks counts as empty. Metrics without the target label or an alias are
+// left alone.
+func Alias(target string, keys []string, aliases map[string]string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		values := make([]string, len(keys))
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				var t *dto.LabelPair
+				for i := range values {
+					values[i] = ""
+				}
+				for _, lp := range m.Label {
+					if lp.GetName() == target {
+						t = lp
+					}
+					for i, k := range keys {
+						if lp.GetName() == k {
+							values[i] = lp.GetValue()
+						}
+					}
+				}
+				if t == nil {
+					continue
+				}
+				if alias, ok := aliases[strings.Join(values, "/")]; ok {
+					t.Value = proto.String(alias)
+				}
+			}
+		}
+		return mfs
+	})
+}
+
+// setLabel sets label name to value on m, keeping its labels sorted.
+func setLabel(m *dto.Metric, name, value string) {
+	for _, lp := range m.Label {
+		if lp.GetName() == name {
+			lp.Value = proto.String(value)
+			return
+		}
+	}
+	m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	sort.Slice(m.Label, func(i, j int) bool {
+		return m.Label[i].GetName() < m.Label[j].GetName()
+	})
+}
+
+// Limit keeps at most max series, dropping the metrics that would exceed it
+// and any families left empty. Each bucket and quantile of a histogram or
+// summary, and its sum and count, is a series. If any are dropped,
+// truncated is called with how many.
+func Limit(max int, truncated func(dropped int)) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		total, dropped := 0, 0
+		kept := mfs[:0]
+		for _, mf := range mfs {
+			ms := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				n := series(m)
+				if total+n > max {
+					dropped += n
+					continue
+				}
+				total += n
+				ms = append(ms, m)
+			}
+			mf.Metric = ms
+			if len(ms) > 0 {
+				kept = append(kept, mf)
+			}
+		}
+		if dropped > 0 && truncated != nil {
+			truncated(dropped)
+		}
+		return kept
+	})
+}
+
+// series returns the number of series m is exposed as.
+func series(m *dto.Metric) int {
+	switch {
+	case m.Histogram != nil:
+		// the buckets, +Inf, sum and count
+		return len(m.Histogram.Bucket) + 3
+	case m.Summary != nil:
+		return len(m.Summary.Quantile) + 2
+	}
+	return 1
+}
+
+// Unlabel removes the label name from every metric that has it, merging
+// the metrics that differ only by it into one series with several samples.
+// This exposes samples that a registry would reject as duplicates, such as
+// several timestamped samples of the same series; the metrics of each
+// series are ordered by timestamp, as Prometheus expects them.
+func Unlabel(name string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, mf := range mfs {
+			merged := false
+			for _, m := range mf.Metric {
+				for i, lp := range m.Label {
+					if lp.GetName() == name {
+						m.Label = append(m.Label[:i], m.Label[i+1:]...)
+						merged = true
+						break
+					}
+				}
+			}
+			if !merged {
+				continue
+			}
+			keys := make(map[*dto.Metric]string, len(mf.Metric))
+			for _, m := range mf.Metric {
+				var b strings.Builder
+				for _, lp := range m.Label {
+					b.WriteString(lp.GetName() + "\xff" + lp.GetValue() + "\xff")
+				}
+				keys[m] = b.String()
+			}
+			sort.SliceStable(mf.Metric, func(i, j int) bool {
+				a, b := mf.Metric[i], mf.Metric[j]
+				if keys[a] != keys[b] {
+					return keys[a] < keys[b]
+				}
+				return a.GetTimestampMs() < b.GetTimestampMs()
+			})
+		}
+		return mfs
+	})
+}
+
+// Only keeps the metrics whose label name has the given value, dropping
+// the others and any families left empty.
+func Only(name, value string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		kept := mfs[:0]
+		for _, mf := range mfs {
+			ms := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				for _, lp := range m.Label {
+					if lp.GetName() == name && lp.GetValue() == value {
+						ms = append(ms, m)
+						break
+					}
+				}
+			}
+			mf.Metric = ms
+			if len(ms) > 0 {
+				kept = append(kept, mf)
+			}
+		}
+		return kept
+	})
+}
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metric returns a metric of value v with labels given as name and value
+// pairs, in order.
+func metric(v float64, labels ...string) *dto.Metric {
+	m := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(v)}}
+	for i := 0; i < len(labels); i += 2 {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(labels[i]), Value: proto.String(labels[i+1])})
+	}
+	return m
+}
+
+func gauges(name string, ms ...*dto.Metric) *dto.MetricFamily {
+	return &dto.MetricFamily{Name: proto.String(name), Help: proto.String(name), Type: dto.MetricType_GAUGE.Enum(), Metric: ms}
+}
+
+// fixture returns the families of a thermostat with a remote sensor.
+func fixture() []*dto.MetricFamily {
+	runtime := &dto.Metric{
+		Label:   []*dto.LabelPair{{Name: proto.String("thermostat_id"), Value: proto.String("1")}},
+		Counter: &dto.Counter{Value: proto.Float64(300)},
+	}
+	return []*dto.MetricFamily{
+		gauges("ecobee_humidity",
+			metric(40, "sensor_id", "ei:0", "sensor_name", "Main", "thermostat_id", "1"),
+		),
+		gauges("ecobee_occupancy",
+			metric(0, "sensor_id", "ei:0", "sensor_name", "Main", "thermostat_id", "1"),
+			metric(1, "sensor_id", "rs:100", "sensor_name", "Hall", "thermostat_id", "1"),
+		),
+		{Name: proto.String("ecobee_runtime_seconds_total"), Type: dto.MetricType_COUNTER.Enum(), Metric: []*dto.Metric{runtime}},
+		gauges("ecobee_temperature",
+			metric(71.25, "sensor_id", "ei:0", "sensor_name", "Main", "thermostat_id", "1"),
+			metric(70.5, "sensor_id", "rs:100", "sensor_name", "Hall", "thermostat_id", "1"),
+		),
+	}
+}
+
+// render returns a line for each metric of mfs, in order, in the text
+// format without help or types.
+func render(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			var labels []string
+			for _, lp := range m.Label {
+				labels = append(labels, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+			}
+			v := m.GetGauge().GetValue()
+			if m.Counter != nil {
+				v = m.GetCounter().GetValue()
+			}
+			line := fmt.Sprintf("%s{%s} %g", mf.GetName(), strings.Join(labels, ","), v)
+			if m.TimestampMs != nil {
+				line += fmt.Sprintf(" %d", m.GetTimestampMs())
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestTransformers(t *testing.T) {
+	temperature := regexp.MustCompile(`^ecobee_temperature$`)
+	tests := []struct {
+		name string
+		t    Transformer
+		want []string
+	}{
+		{
+			name: "drop",
+			t:    Drop(regexp.MustCompile(`^ecobee_(humidity|occupancy|runtime_.*)$`)),
+			want: []string{
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 71.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "scale",
+			t:    Scale(regexp.MustCompile(`^ecobee_(temperature|runtime_seconds_total)$`), 2, -100),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`ecobee_runtime_seconds_total{thermostat_id="1"} 500`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 42.5`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 41`,
+			},
+		},
+		{
+			name: "round",
+			t:    chain(Only("sensor_name", "Main"), Round(temperature, 0)),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 71`,
+			},
+		},
+		{
+			name: "labels",
+			t:    Labels(temperature, map[string]string{"home": "cabin", "thermostat_id": "2"}),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`ecobee_runtime_seconds_total{thermostat_id="1"} 300`,
+				`ecobee_temperature{home="cabin",sensor_id="ei:0",sensor_name="Main",thermostat_id="2"} 71.25`,
+				`ecobee_temperature{home="cabin",sensor_id="rs:100",sensor_name="Hall",thermostat_id="2"} 70.5`,
+			},
+		},
+		{
+			name: "extract",
+			t:    Extract("sensor_id", regexp.MustCompile(`^(?P<sensor_type>rs|ei):`)),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",sensor_type="ei",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",sensor_type="ei",thermostat_id="1"} 0`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",sensor_type="rs",thermostat_id="1"} 1`,
+				`ecobee_runtime_seconds_total{thermostat_id="1"} 300`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",sensor_type="ei",thermostat_id="1"} 71.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",sensor_type="rs",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "alias",
+			t:    Alias("sensor_name", []string{"thermostat_id", "sensor_id"}, map[string]string{"1/rs:100": "Hallway", "2/rs:100": "Attic"}),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hallway",thermostat_id="1"} 1`,
+				`ecobee_runtime_seconds_total{thermostat_id="1"} 300`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 71.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hallway",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "only",
+			t:    Only("sensor_id", "rs:100"),
+			want: []string{
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "limit",
+			t:    Limit(2, nil),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+			},
+		},
+		{
+			name: "prefix",
+			t:    Prefix("ecobee", "home", ""),
+			want: []string{
+				`home_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 40`,
+				`home_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 0`,
+				`home_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`home_runtime_seconds_total{thermostat_id="1"} 300`,
+				`home_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1"} 71.25`,
+				`home_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "prefix also",
+			t:    chain(Only("sensor_id", "rs:100"), Prefix("ecobee", "home", "ecobee")),
+			want: []string{
+				`home_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`home_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "suffix",
+			t:    chain(Only("sensor_id", "rs:100"), Suffix(temperature, "_fahrenheit")),
+			want: []string{
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 1`,
+				`ecobee_temperature_fahrenheit{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1"} 70.5`,
+			},
+		},
+		{
+			name: "zones",
+			t:    Zones("ecobee", map[string]string{"1/ei:0": "downstairs", "rs:100": "downstairs"}),
+			want: []string{
+				`ecobee_humidity{sensor_id="ei:0",sensor_name="Main",thermostat_id="1",zone="downstairs"} 40`,
+				`ecobee_occupancy{sensor_id="ei:0",sensor_name="Main",thermostat_id="1",zone="downstairs"} 0`,
+				`ecobee_occupancy{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1",zone="downstairs"} 1`,
+				`ecobee_runtime_seconds_total{thermostat_id="1"} 300`,
+				`ecobee_temperature{sensor_id="ei:0",sensor_name="Main",thermostat_id="1",zone="downstairs"} 71.25`,
+				`ecobee_temperature{sensor_id="rs:100",sensor_name="Hall",thermostat_id="1",zone="downstairs"} 70.5`,
+				`ecobee_zone_humidity{zone="downstairs"} 40`,
+				`ecobee_zone_occupancy{zone="downstairs"} 1`,
+				`ecobee_zone_temperature{zone="downstairs"} 70.875`,
+			},
+		},
+		{
+			name: "zones of another thermostat",
+			t:    Zones("ecobee", map[string]string{"2/ei:0": "upstairs"}),
+			want: render(fixture()),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(tt.t.Transform(fixture())); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+		})
+	}
+}
+
+// chain returns a transformer applying ts in order.
+func chain(ts ...Transformer) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, t := range ts {
+			mfs = t.Transform(mfs)
+		}
+		return mfs
+	})
+}
+
+func TestLimitTruncated(t *testing.T) {
+	var dropped int
+	Limit(3, func(n int) { dropped = n }).Transform(fixture())
+	if dropped != 3 {
+		t.Errorf("dropped %d series, want 3", dropped)
+	}
+}
+
+func TestUnlabel(t *testing.T) {
+	at := func(m *dto.Metric, ms int64) *dto.Metric {
+		m.TimestampMs = proto.Int64(ms)
+		return m
+	}
+	mfs := []*dto.MetricFamily{gauges("ecobee_temperature",
+		at(metric(71, "interval", "2", "thermostat_id", "1"), 2000),
+		at(metric(72, "interval", "1", "thermostat_id", "2"), 1000),
+		at(metric(70, "interval", "1", "thermostat_id", "1"), 1000),
+	)}
+	want := []string{
+		`ecobee_temperature{thermostat_id="1"} 70 1000`,
+		`ecobee_temperature{thermostat_id="1"} 71 2000`,
+		`ecobee_temperature{thermostat_id="2"} 72 1000`,
+	}
+	if got := render(Unlabel("interval").Transform(mfs)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Prefix renames the metric families whose names start with from and an
+// underscore to start with to instead. If also is not empty, each of them
+// is exposed under that prefix too, with its help noting the new name, so
+// that dashboards and recording rules can move from one name to the other
+// without a gap.
+func Prefix(from, to, also string) Transformer {
+	from += "_"
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		var copies []*dto.MetricFamily
+		for _, mf := range mfs {
+			suffix, ok := strings.CutPrefix(mf.GetName(), from)
+			if !ok {
+				continue
+			}
+			name := to + "_" + suffix
+			if also != "" && also != to {
+				old := proto.Clone(mf).(*dto.MetricFamily)
+				old.Name = proto.String(also + "_" + suffix)
+				old.Help = proto.String(mf.GetHelp() + " (deprecated: renamed to " + name + ")")
+				copies = append(copies, old)
+			}
+			mf.Name = proto.String(name)
+		}
+		return append(mfs, copies...)
+	})
+}
+
+// Suffix appends suffix to the names of the metric families matching re,
+// for example to give them a unit.
+func Suffix(re *regexp.Regexp, suffix string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		for _, mf := range mfs {
+			if re.MatchString(mf.GetName()) {
+				mf.Name = proto.String(mf.GetName() + suffix)
+			}
+		}
+		return mfs
+	})
+}
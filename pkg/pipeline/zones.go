@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Zones groups sensors into zones, such as the floors of a house. zones
+// maps sensor keys to zone names, where a key is a sensor identifier,
+// optionally prefixed with a thermostat identifier and a slash to pick the
+// sensor of one thermostat, as for Alias. Every metric of a sensor in a
+// zone gets a zone label, and each zone gets the mean temperature and
+// humidity of its sensors, and whether any of them detects occupancy, as
+// <prefix>_zone_temperature, <prefix>_zone_humidity and
+// <prefix>_zone_occupancy.
+func Zones(prefix string, zones map[string]string) Transformer {
+	return TransformerFunc(func(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+		temperature, humidity := make(means), make(means)
+		occupancy := make(map[string]float64)
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				var thermostat, sensor string
+				for _, lp := range m.Label {
+					switch lp.GetName() {
+					case "thermostat_id":
+						thermostat = lp.GetValue()
+					case "sensor_id":
+						sensor = lp.GetValue()
+					}
+				}
+				if sensor == "" {
+					continue
+				}
+				zone, ok := zones[thermostat+"/"+sensor]
+				if !ok {
+					if zone, ok = zones[sensor]; !ok {
+						continue
+					}
+				}
+				setLabel(m, "zone", zone)
+				switch mf.GetName() {
+				case prefix + "_temperature":
+					temperature.add(zone, m.GetGauge().GetValue())
+				case prefix + "_humidity":
+					humidity.add(zone, m.GetGauge().GetValue())
+				case prefix + "_occupancy":
+					v := m.GetGauge().GetValue()
+					if cur, ok := occupancy[zone]; !ok || v > cur {
+						occupancy[zone] = v
+					}
+				}
+			}
+		}
+
+		mfs = appendZoneFamily(mfs, prefix+"_zone_temperature", "mean temperature reported by the sensors of a zone in degrees", temperature.values())
+		mfs = appendZoneFamily(mfs, prefix+"_zone_humidity", "mean humidity reported by the sensors of a zone in percent", humidity.values())
+		mfs = appendZoneFamily(mfs, prefix+"_zone_occupancy", "whether any sensor of a zone reports occupancy (0 or 1)", occupancy)
+		sort.Slice(mfs, func(i, j int) bool {
+			return mfs[i].GetName() < mfs[j].GetName()
+		})
+		return mfs
+	})
+}
+
+// means accumulates the mean value of each zone.
+type means map[string]struct {
+	sum float64
+	n   int
+}
+
+func (ms means) add(zone string, v float64) {
+	m := ms[zone]
+	m.sum += v
+	m.n++
+	ms[zone] = m
+}
+
+func (ms means) values() map[string]float64 {
+	vs := make(map[string]float64, len(ms))
+	for zone, m := range ms {
+		vs[zone] = m.sum / float64(m.n)
+	}
+	return vs
+}
+
+// appendZoneFamily appends a gauge family with a metric for each zone in
+// values, unless values is empty.
+func appendZoneFamily(mfs []*dto.MetricFamily, name, help string, values map[string]float64) []*dto.MetricFamily {
+	if len(values) == 0 {
+		return mfs
+	}
+	mf := &dto.MetricFamily{
+		Name: proto.String(name),
+		Help: proto.String(help),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for zone, v := range values {
+		mf.Metric = append(mf.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{{Name: proto.String("zone"), Value: proto.String(zone)}},
+			Gauge: &dto.Gauge{Value: proto.Float64(v)},
+		})
+	}
+	sort.Slice(mf.Metric, func(i, j int) bool {
+		return mf.Metric[i].Label[0].GetValue() < mf.Metric[j].Label[0].GetValue()
+	})
+	return append(mfs, mf)
+}
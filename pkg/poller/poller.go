@@ -0,0 +1,230 @@
+// Package poller collects metrics in the background on a schedule, so that
+// scrapes are answered from the latest poll instead of calling the API.
+package poller
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+// Schedule decides when polls happen.
+type Schedule struct {
+	// Interval is the time between polls.
+	Interval time.Duration
+
+	// Jitter delays each poll by a random duration up to Jitter, so that
+	// several exporters sharing an API key, or restarted together, don't
+	// poll in lockstep.
+	Jitter time.Duration
+
+	// Align schedules polls at multiples of Interval since the Unix
+	// epoch, plus jitter, rather than Interval after the previous poll,
+	// so samples land near the same boundaries across restarts.
+	Align bool
+
+	// BusyInterval, if positive, replaces Interval while Busy returns
+	// true, for example to poll more often while equipment is running.
+	BusyInterval time.Duration
+	Busy         func() bool
+}
+
+// Next returns the time of the poll following one at now.
+func (s Schedule) Next(now time.Time) time.Time {
+	interval := s.Interval
+	if s.BusyInterval > 0 && s.Busy != nil && s.Busy() {
+		interval = s.BusyInterval
+	}
+	next := now.Add(interval)
+	if s.Align {
+		next = now.Truncate(interval).Add(interval)
+	}
+	if s.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.Jitter))))
+	}
+	return next
+}
+
+// inactiveRetry is how often an inactive poller checks whether it has
+// become active.
+const inactiveRetry = time.Second
+
+// Poller is a prometheus.Collector that replays the metrics of the latest
+// poll of another collector.
+type Poller struct {
+	c          prometheus.Collector
+	clock      clock.Clock
+	active     func() bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+	polled     chan struct{}
+	reschedule chan struct{}
+	onPoll     []func(*Poller)
+
+	mu       sync.Mutex
+	s        Schedule
+	latest   []prometheus.Metric
+	polledAt time.Time
+}
+
+// Option configures optional behavior of the poller.
+type Option func(*Poller)
+
+// WithClock sets the clock used to schedule polls and time their age. It
+// defaults to clock.Real.
+func WithClock(clk clock.Clock) Option {
+	return func(p *Poller) {
+		p.clock = clk
+	}
+}
+
+// WithPollHandler calls f with the poller after each poll, once Collect
+// serves the poll's metrics.
+func WithPollHandler(f func(*Poller)) Option {
+	return func(p *Poller) {
+		p.onPoll = append(p.onPoll, f)
+	}
+}
+
+// Start polls c immediately, then on schedule s until the returned Poller
+// is closed. s.Interval must be positive. If active is not nil, polls are
+// skipped while it returns false, such as on a standby replica.
+func Start(c prometheus.Collector, s Schedule, active func() bool, opts ...Option) *Poller {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Poller{
+		c:          c,
+		s:          s,
+		clock:      clock.Real,
+		active:     active,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		polled:     make(chan struct{}),
+		reschedule: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	go func() {
+		defer close(p.done)
+		first := true
+		for {
+			wait := inactiveRetry
+			var last time.Time
+			if p.active == nil || p.active() {
+				p.poll()
+				for _, f := range p.onPoll {
+					f(p)
+				}
+				last = p.clock.Now()
+				wait = p.schedule().Next(last).Sub(last)
+			}
+			if first {
+				close(p.polled)
+				first = false
+			}
+		sleep:
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-p.clock.After(wait):
+					break sleep
+				case <-p.reschedule:
+					if !last.IsZero() {
+						wait = p.schedule().Next(last).Sub(p.clock.Now())
+					}
+				}
+			}
+		}
+	}()
+	return p
+}
+
+// SetSchedule replaces the schedule of the poller, such as when the
+// configuration is reloaded. The next poll is rescheduled from the latest
+// one. s.Interval must be positive.
+func (p *Poller) SetSchedule(s Schedule) {
+	p.mu.Lock()
+	p.s = s
+	p.mu.Unlock()
+	select {
+	case p.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Poller) schedule() Schedule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.s
+}
+
+// Polled returns a channel that is closed once the first poll has
+// finished, or been skipped because the poller is inactive.
+func (p *Poller) Polled() <-chan struct{} {
+	return p.polled
+}
+
+// Close stops polling, waiting for a poll in progress to finish or for ctx
+// to be done.
+func (p *Poller) Close(ctx context.Context) error {
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Poller) poll() {
+	ch := make(chan prometheus.Metric)
+	var ms []prometheus.Metric
+	done := make(chan struct{})
+	go func() {
+		for m := range ch {
+			ms = append(ms, m)
+		}
+		close(done)
+	}()
+	p.c.Collect(ch)
+	close(ch)
+	<-done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latest = ms
+	p.polledAt = p.clock.Now()
+}
+
+// Age returns how long ago the latest poll finished, and false before the
+// first poll has.
+func (p *Poller) Age() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.polledAt.IsZero() {
+		return 0, false
+	}
+	return p.clock.Since(p.polledAt), true
+}
+
+// Describe implements prometheus.Collector.
+func (p *Poller) Describe(ch chan<- *prometheus.Desc) {
+	p.c.Describe(ch)
+}
+
+// Collect sends the metrics of the latest poll, or nothing before the
+// first poll has finished.
+func (p *Poller) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	latest := p.latest
+	p.mu.Unlock()
+	for _, m := range latest {
+		ch <- m
+	}
+}
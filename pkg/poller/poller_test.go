@@ -0,0 +1,206 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/clock"
+)
+
+var start = time.Date(2026, 10, 15, 12, 0, 30, 0, time.UTC)
+
+func TestScheduleNext(t *testing.T) {
+	busy := func() bool { return true }
+	idle := func() bool { return false }
+	tests := []struct {
+		name     string
+		s        Schedule
+		min, max time.Time
+	}{
+		{
+			name: "interval",
+			s:    Schedule{Interval: time.Minute},
+			min:  start.Add(time.Minute),
+			max:  start.Add(time.Minute),
+		},
+		{
+			name: "jitter",
+			s:    Schedule{Interval: time.Minute, Jitter: 10 * time.Second},
+			min:  start.Add(time.Minute),
+			max:  start.Add(time.Minute + 10*time.Second - 1),
+		},
+		{
+			name: "align",
+			s:    Schedule{Interval: time.Minute, Align: true},
+			min:  start.Truncate(time.Minute).Add(time.Minute),
+			max:  start.Truncate(time.Minute).Add(time.Minute),
+		},
+		{
+			name: "align with jitter",
+			s:    Schedule{Interval: time.Minute, Align: true, Jitter: 10 * time.Second},
+			min:  start.Truncate(time.Minute).Add(time.Minute),
+			max:  start.Truncate(time.Minute).Add(time.Minute + 10*time.Second - 1),
+		},
+		{
+			name: "busy",
+			s:    Schedule{Interval: time.Minute, BusyInterval: 10 * time.Second, Busy: busy},
+			min:  start.Add(10 * time.Second),
+			max:  start.Add(10 * time.Second),
+		},
+		{
+			name: "idle",
+			s:    Schedule{Interval: time.Minute, BusyInterval: 10 * time.Second, Busy: idle},
+			min:  start.Add(time.Minute),
+			max:  start.Add(time.Minute),
+		},
+		{
+			name: "busy without a busy interval",
+			s:    Schedule{Interval: time.Minute, Busy: busy},
+			min:  start.Add(time.Minute),
+			max:  start.Add(time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if next := tt.s.Next(start); next.Before(tt.min) || next.After(tt.max) {
+					t.Fatalf("Next = %v, want between %v and %v", next, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// counter is a collector that signals each collection on polls.
+type counter struct {
+	polls chan struct{}
+}
+
+func (c *counter) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *counter) Collect(ch chan<- prometheus.Metric) {
+	c.polls <- struct{}{}
+}
+
+// expectPoll fails the test unless c is polled soon.
+func expectPoll(t *testing.T, c *counter) {
+	t.Helper()
+	select {
+	case <-c.polls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no poll")
+	}
+}
+
+// expectNoPoll fails the test if c has been polled.
+func expectNoPoll(t *testing.T, c *counter) {
+	t.Helper()
+	select {
+	case <-c.polls:
+		t.Fatal("unexpected poll")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestPoller(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     Schedule
+		waits []time.Duration // between the polls after the first
+	}{
+		{
+			name:  "interval",
+			s:     Schedule{Interval: time.Minute},
+			waits: []time.Duration{time.Minute, time.Minute},
+		},
+		{
+			name:  "align",
+			s:     Schedule{Interval: time.Minute, Align: true},
+			waits: []time.Duration{30 * time.Second, time.Minute},
+		},
+		{
+			name:  "busy",
+			s:     Schedule{Interval: time.Minute, BusyInterval: 10 * time.Second, Busy: func() bool { return true }},
+			waits: []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			c := &counter{polls: make(chan struct{}, 1)}
+			p := Start(c, tt.s, nil, WithClock(clk))
+			defer p.Close(context.Background())
+
+			expectPoll(t, c)
+			<-p.Polled()
+			for _, wait := range tt.waits {
+				clk.BlockUntil(1)
+				clk.Advance(wait - time.Second)
+				expectNoPoll(t, c)
+				clk.Advance(time.Second)
+				expectPoll(t, c)
+			}
+		})
+	}
+}
+
+func TestPollerAge(t *testing.T) {
+	clk := clock.NewFake(start)
+	c := &counter{polls: make(chan struct{}, 1)}
+	p := Start(c, Schedule{Interval: time.Minute}, nil, WithClock(clk))
+	defer p.Close(context.Background())
+
+	expectPoll(t, c)
+	<-p.Polled()
+	clk.BlockUntil(1)
+	clk.Advance(20 * time.Second)
+	if age, ok := p.Age(); !ok || age != 20*time.Second {
+		t.Errorf("Age = %v, %t, want 20s, true", age, ok)
+	}
+}
+
+func TestPollerInactive(t *testing.T) {
+	clk := clock.NewFake(start)
+	c := &counter{polls: make(chan struct{}, 1)}
+	active := make(chan bool, 1)
+	active <- false
+	isActive := func() bool {
+		a := <-active
+		active <- a
+		return a
+	}
+	p := Start(c, Schedule{Interval: time.Minute}, isActive, WithClock(clk))
+	defer p.Close(context.Background())
+
+	<-p.Polled()
+	if _, ok := p.Age(); ok {
+		t.Error("inactive poller has an age")
+	}
+	clk.BlockUntil(1)
+	<-active
+	active <- true
+	clk.Advance(inactiveRetry)
+	expectPoll(t, c)
+}
+
+func TestPollerSetSchedule(t *testing.T) {
+	clk := clock.NewFake(start)
+	c := &counter{polls: make(chan struct{}, 1)}
+	p := Start(c, Schedule{Interval: time.Hour}, nil, WithClock(clk))
+	defer p.Close(context.Background())
+
+	expectPoll(t, c)
+	<-p.Polled()
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	p.SetSchedule(Schedule{Interval: 2 * time.Minute})
+	// the old wait stays pending, so wait for the new one too
+	clk.BlockUntil(2)
+	clk.Advance(time.Minute - time.Second)
+	expectNoPoll(t, c)
+	clk.Advance(time.Second)
+	expectPoll(t, c)
+}
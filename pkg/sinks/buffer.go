@@ -0,0 +1,180 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Buffer is a Sink that keeps the metrics another Sink fails to accept in
+// a file, and writes them to it again, oldest first, once it recovers, so
+// that an outage of a push target doesn't lose history. Buffered metrics
+// keep the time they were gathered at, so the wrapped Sink should honor
+// metric timestamps, as Influx does.
+type Buffer struct {
+	sink Sink
+	path string
+	max  int64
+
+	mu      sync.Mutex
+	dropped atomic.Int64
+}
+
+// replayBatch is the number of buffered metric families written to the
+// sink at a time when it recovers.
+const replayBatch = 500
+
+// NewBuffer returns a Sink writing to s, buffering in the file at path up
+// to maxBytes. Metrics that don't fit are dropped.
+func NewBuffer(s Sink, path string, maxBytes int64) *Buffer {
+	return &Buffer{sink: s, path: path, max: maxBytes}
+}
+
+// Size returns the size of the buffer file in bytes.
+func (b *Buffer) Size() int64 {
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// Dropped returns the number of samples dropped because the buffer was
+// full.
+func (b *Buffer) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Write implements Sink. It returns the wrapped Sink's error when the
+// metrics had to be buffered.
+func (b *Buffer) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.replay(ctx)
+	if err == nil {
+		err = b.sink.Write(ctx, mfs)
+	}
+	if err != nil {
+		if berr := b.append(mfs, now); berr != nil {
+			b.dropped.Add(int64(samples(mfs)))
+			slog.WarnContext(ctx, "unable to buffer metrics for sink", "path", b.path, "error", berr)
+		}
+	}
+	return err
+}
+
+// replay writes the buffered metrics to the sink, replayBatch families at
+// a time, oldest first. After each batch, the buffer is rewritten with
+// what remains, so that a failure part way through neither loses nor
+// repeats metrics.
+func (b *Buffer) replay(ctx context.Context) error {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	dec := expfmt.NewDecoder(r, expfmt.FmtProtoDelim)
+	replayed := 0
+	for {
+		var mfs []*dto.MetricFamily
+		for len(mfs) < replayBatch {
+			mf := &dto.MetricFamily{}
+			if err := dec.Decode(mf); err == io.EOF {
+				break
+			} else if err != nil {
+				// keep what could be read rather than the whole buffer
+				slog.WarnContext(ctx, "sink buffer is corrupt, replaying what could be read", "path", b.path, "error", err)
+				r.Seek(0, io.SeekEnd)
+				break
+			}
+			mfs = append(mfs, mf)
+		}
+		if len(mfs) == 0 {
+			break
+		}
+		if err := b.sink.Write(ctx, mfs); err != nil {
+			if replayed > 0 {
+				slog.InfoContext(ctx, "replayed part of the buffered metrics to sink", "families", replayed)
+			}
+			return err
+		}
+		replayed += len(mfs)
+		if r.Len() == 0 {
+			break
+		}
+		if err := b.rewrite(data[len(data)-r.Len():]); err != nil {
+			return err
+		}
+	}
+	if replayed > 0 {
+		slog.InfoContext(ctx, "replayed buffered metrics to sink", "families", replayed)
+	}
+	return os.Remove(b.path)
+}
+
+// rewrite replaces the contents of the buffer with data.
+func (b *Buffer) rewrite(data []byte) error {
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// samples returns the number of samples of mfs.
+func samples(mfs []*dto.MetricFamily) int {
+	n := 0
+	for _, mf := range mfs {
+		n += len(mf.Metric)
+	}
+	return n
+}
+
+// append adds mfs, stamped with now where they have no timestamp, to the
+// buffer, unless the buffer would grow beyond its limit.
+func (b *Buffer) append(mfs []*dto.MetricFamily, now time.Time) error {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	for _, mf := range mfs {
+		mf = proto.Clone(mf).(*dto.MetricFamily)
+		for _, m := range mf.Metric {
+			if m.TimestampMs == nil {
+				m.TimestampMs = proto.Int64(ts)
+			}
+		}
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+
+	var size int64
+	if fi, err := os.Stat(b.path); err == nil {
+		size = fi.Size()
+	}
+	if size+int64(buf.Len()) > b.max {
+		return errors.New("buffer full, dropping metrics")
+	}
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
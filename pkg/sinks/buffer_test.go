@@ -0,0 +1,98 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// flakySink accepts a number of writes, then fails, recording the names of
+// the families it accepted.
+type flakySink struct {
+	accept int
+	names  []string
+}
+
+func (s *flakySink) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	if s.accept == 0 {
+		return errors.New("unavailable")
+	}
+	s.accept--
+	for _, mf := range mfs {
+		s.names = append(s.names, mf.GetName())
+	}
+	return nil
+}
+
+// families returns n gauge families named from first on.
+func families(first, n int) []*dto.MetricFamily {
+	mfs := make([]*dto.MetricFamily, n)
+	for i := range mfs {
+		mfs[i] = &dto.MetricFamily{
+			Name:   proto.String("m" + strconv.Itoa(first+i)),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+		}
+	}
+	return mfs
+}
+
+func TestBufferReplay(t *testing.T) {
+	ctx := context.Background()
+	sink := &flakySink{}
+	b := NewBuffer(sink, filepath.Join(t.TempDir(), "buffer"), 1<<20)
+
+	// buffer three batches and a bit while the sink is down
+	n := 3*replayBatch + 10
+	if err := b.Write(ctx, families(0, n)); err == nil {
+		t.Fatal("Write succeeded with the sink down")
+	}
+	full := b.Size()
+	if full == 0 {
+		t.Fatal("nothing buffered")
+	}
+
+	// the sink recovers for one batch: the rest stays buffered
+	sink.accept = 1
+	if err := b.Write(ctx, families(n, 1)); err == nil {
+		t.Fatal("Write succeeded with the sink failing part way")
+	}
+	if len(sink.names) != replayBatch {
+		t.Fatalf("replayed %d families, want %d", len(sink.names), replayBatch)
+	}
+	if size := b.Size(); size >= full {
+		t.Errorf("buffer size %d after a batch was replayed, want less than %d", size, full)
+	}
+
+	// then for good: the rest is replayed in order, without repeats
+	sink.accept = 10
+	if err := b.Write(ctx, families(n+1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.names) != n+2 {
+		t.Fatalf("replayed %d families in all, want %d", len(sink.names), n+2)
+	}
+	for i, name := range sink.names {
+		if want := "m" + strconv.Itoa(i); name != want {
+			t.Fatalf("family %d is %s, want %s", i, name, want)
+		}
+	}
+	if size := b.Size(); size != 0 {
+		t.Errorf("buffer size %d after replaying everything, want 0", size)
+	}
+}
+
+func TestBufferFull(t *testing.T) {
+	ctx := context.Background()
+	b := NewBuffer(&flakySink{}, filepath.Join(t.TempDir(), "buffer"), 64)
+	b.Write(ctx, families(0, 1))
+	b.Write(ctx, families(1, 20))
+	if got := b.Dropped(); got != 20 {
+		t.Errorf("dropped %d samples, want 20", got)
+	}
+}
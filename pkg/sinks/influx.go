@@ -0,0 +1,132 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Influx is a Sink that posts metrics in the InfluxDB line protocol, with
+// one measurement per metric family, its labels as tags and its value in
+// the "value" field, or "sum" and "count" for histograms and summaries.
+type Influx struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewInflux returns a Sink posting to url, the full write endpoint
+// including the database or bucket, such as
+// http://localhost:8086/write?db=ecobee for InfluxDB 1.x or
+// http://localhost:8086/api/v2/write?org=home&bucket=ecobee for 2.x. If
+// token is not empty it is sent in the Authorization header.
+func NewInflux(url, token string) *Influx {
+	return &Influx{url: url, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Write implements Sink. Metrics without a timestamp are written with the
+// current time.
+func (s *Influx) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var buf bytes.Buffer
+	writeLineProtocol(&buf, mfs, time.Now())
+	if buf.Len() == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+precision(s.url), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// precision returns the query string parameter selecting millisecond
+// timestamps, to append to url.
+func precision(url string) string {
+	if strings.Contains(url, "?") {
+		return "&precision=ms"
+	}
+	return "?precision=ms"
+}
+
+// writeLineProtocol encodes mfs in the InfluxDB line protocol, with
+// millisecond timestamps, using now for metrics without one. Values that
+// aren't finite are skipped, as InfluxDB rejects them.
+func writeLineProtocol(w *bytes.Buffer, mfs []*dto.MetricFamily, now time.Time) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			var fields []string
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				fields = field(fields, "value", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				fields = field(fields, "value", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				fields = field(fields, "value", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				fields = field(fields, "sum", m.GetHistogram().GetSampleSum())
+				fields = field(fields, "count", float64(m.GetHistogram().GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				fields = field(fields, "sum", m.GetSummary().GetSampleSum())
+				fields = field(fields, "count", float64(m.GetSummary().GetSampleCount()))
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			ts := m.GetTimestampMs()
+			if ts == 0 {
+				ts = now.UnixNano() / int64(time.Millisecond)
+			}
+			w.WriteString(escape(mf.GetName(), ", "))
+			for _, lp := range m.Label {
+				if lp.GetValue() == "" {
+					continue
+				}
+				fmt.Fprintf(w, ",%s=%s", escape(lp.GetName(), ",= "), escape(lp.GetValue(), ",= "))
+			}
+			fmt.Fprintf(w, " %s %d\n", strings.Join(fields, ","), ts)
+		}
+	}
+}
+
+func field(fields []string, name string, v float64) []string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fields
+	}
+	return append(fields, name+"="+strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// escape backslash-escapes the characters in special.
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
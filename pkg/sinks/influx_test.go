@@ -0,0 +1,141 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var now = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+// nowMs is now in milliseconds, as written for metrics without a
+// timestamp.
+var nowMs = now.UnixNano() / int64(time.Millisecond)
+
+func labels(pairs ...string) []*dto.LabelPair {
+	var ls []*dto.LabelPair
+	for i := 0; i < len(pairs); i += 2 {
+		ls = append(ls, &dto.LabelPair{Name: proto.String(pairs[i]), Value: proto.String(pairs[i+1])})
+	}
+	return ls
+}
+
+// typed returns a family of each type, for the encoders.
+func typed() map[string]*dto.MetricFamily {
+	return map[string]*dto.MetricFamily{
+		"gauge": {
+			Name: proto.String("ecobee_temperature"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{
+				{Label: labels("thermostat_id", "1", "thermostat_name", "Main Floor"), Gauge: &dto.Gauge{Value: proto.Float64(70.5)}},
+				{Label: labels("thermostat_id", "2", "thermostat_name", ""), Gauge: &dto.Gauge{Value: proto.Float64(68)}},
+			},
+		},
+		"counter": {
+			Name: proto.String("ecobee_runtime_seconds_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				{Label: labels("equipment", "fan"), Counter: &dto.Counter{Value: proto.Float64(600)}, TimestampMs: proto.Int64(2000)},
+				{Label: labels("equipment", "fan"), Counter: &dto.Counter{Value: proto.Float64(300)}, TimestampMs: proto.Int64(1000)},
+			},
+		},
+		"untyped": {
+			Name:   proto.String("ecobee_up"),
+			Type:   dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{Untyped: &dto.Untyped{Value: proto.Float64(math.NaN())}}},
+		},
+		"histogram": {
+			Name: proto.String("ecobee_fetch_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(3),
+				SampleSum:   proto.Float64(1.5),
+				Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(2)}},
+			}}},
+		},
+		"summary": {
+			Name: proto.String("ecobee_lag_seconds"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{Summary: &dto.Summary{
+				SampleCount: proto.Uint64(4),
+				SampleSum:   proto.Float64(2),
+				Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.9), Value: proto.Float64(0.75)}},
+			}}},
+		},
+	}
+}
+
+func TestWriteLineProtocol(t *testing.T) {
+	tests := []struct {
+		name string
+		mfs  []*dto.MetricFamily
+		want string
+	}{
+		{
+			name: "gauge",
+			mfs:  []*dto.MetricFamily{typed()["gauge"]},
+			want: fmt.Sprintf("ecobee_temperature,thermostat_id=1,thermostat_name=Main\\ Floor value=70.5 %d\n", nowMs) +
+				fmt.Sprintf("ecobee_temperature,thermostat_id=2 value=68 %d\n", nowMs),
+		},
+		{
+			name: "counter",
+			mfs:  []*dto.MetricFamily{typed()["counter"]},
+			want: "ecobee_runtime_seconds_total,equipment=fan value=600 2000\n" +
+				"ecobee_runtime_seconds_total,equipment=fan value=300 1000\n",
+		},
+		{
+			name: "not finite",
+			mfs:  []*dto.MetricFamily{typed()["untyped"]},
+			want: "",
+		},
+		{
+			name: "histogram",
+			mfs:  []*dto.MetricFamily{typed()["histogram"]},
+			want: fmt.Sprintf("ecobee_fetch_seconds sum=1.5,count=3 %d\n", nowMs),
+		},
+		{
+			name: "summary",
+			mfs:  []*dto.MetricFamily{typed()["summary"]},
+			want: fmt.Sprintf("ecobee_lag_seconds sum=2,count=4 %d\n", nowMs),
+		},
+		{
+			name: "escaped",
+			mfs: []*dto.MetricFamily{{
+				Name: proto.String("ecobee, temperature"),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{{
+					Label:       labels("sensor name", "Hall=North, Upstairs"),
+					Gauge:       &dto.Gauge{Value: proto.Float64(1)},
+					TimestampMs: proto.Int64(1000),
+				}},
+			}},
+			want: "ecobee\\,\\ temperature,sensor\\ name=Hall\\=North\\,\\ Upstairs value=1 1000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeLineProtocol(&b, tt.mfs, now)
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%swant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	tests := []struct{ url, want string }{
+		{"http://localhost:8086/write?db=ecobee", "&precision=ms"},
+		{"http://localhost:8086/api/v2/write", "?precision=ms"},
+	}
+	for _, tt := range tests {
+		if got := precision(tt.url); got != tt.want {
+			t.Errorf("precision(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
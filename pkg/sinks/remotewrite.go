@@ -0,0 +1,171 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWrite is a Sink that posts metrics with the Prometheus remote write
+// protocol, to Prometheus with its remote write receiver enabled, or to a
+// compatible store such as Mimir, Thanos or VictoriaMetrics. Histograms and
+// summaries are written as the series of their buckets or quantiles, sum
+// and count, as Prometheus scrapes them.
+type RemoteWrite struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewRemoteWrite returns a Sink posting to url, such as
+// http://localhost:9090/api/v1/write. If token is not empty it is sent as
+// a bearer token in the Authorization header.
+func NewRemoteWrite(url, token string) *RemoteWrite {
+	return &RemoteWrite{url: url, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Write implements Sink. Metrics without a timestamp are written with the
+// current time.
+func (s *RemoteWrite) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	body := encodeWriteRequest(mfs, time.Now())
+	if len(body) == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// remoteSeries is a series of a remote write request: its labels, sorted
+// by name and including __name__, and its samples.
+type remoteSeries struct {
+	labels  []*dto.LabelPair
+	samples []remoteSample
+}
+
+type remoteSample struct {
+	value float64
+	ts    int64 // milliseconds
+}
+
+// encodeWriteRequest encodes mfs as the protobuf of a remote write
+// WriteRequest, with the samples of each series, such as those of the
+// same metric at different timestamps, together and in time order. It uses
+// now for metrics without a timestamp.
+func encodeWriteRequest(mfs []*dto.MetricFamily, now time.Time) []byte {
+	series := map[string]*remoteSeries{}
+	var keys []string
+	add := func(name string, labels []*dto.LabelPair, ts int64, v float64, extra ...string) {
+		ls := []*dto.LabelPair{{Name: proto.String("__name__"), Value: &name}}
+		for _, lp := range labels {
+			// an empty label is the same as no label
+			if lp.GetValue() != "" {
+				ls = append(ls, lp)
+			}
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			ls = append(ls, &dto.LabelPair{Name: &extra[i], Value: &extra[i+1]})
+		}
+		sort.Slice(ls, func(i, j int) bool { return ls[i].GetName() < ls[j].GetName() })
+		var key strings.Builder
+		for _, lp := range ls {
+			key.WriteString(lp.GetName() + "\xff" + lp.GetValue() + "\xff")
+		}
+		s, ok := series[key.String()]
+		if !ok {
+			s = &remoteSeries{labels: ls}
+			series[key.String()] = s
+			keys = append(keys, key.String())
+		}
+		s.samples = append(s.samples, remoteSample{v, ts})
+	}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			ts := m.GetTimestampMs()
+			if ts == 0 {
+				ts = now.UnixNano() / int64(time.Millisecond)
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.Label, ts, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.Label, ts, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.Label, ts, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.Bucket {
+					add(name+"_bucket", m.Label, ts, float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				add(name+"_bucket", m.Label, ts, float64(h.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", m.Label, ts, h.GetSampleSum())
+				add(name+"_count", m.Label, ts, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				sm := m.GetSummary()
+				for _, q := range sm.Quantile {
+					add(name, m.Label, ts, q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add(name+"_sum", m.Label, ts, sm.GetSampleSum())
+				add(name+"_count", m.Label, ts, float64(sm.GetSampleCount()))
+			}
+		}
+	}
+
+	var req []byte
+	for _, k := range keys {
+		s := series[k]
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].ts < s.samples[j].ts })
+		var ts []byte
+		for _, lp := range s.labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, lp.GetName())
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, lp.GetValue())
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		for _, sample := range s.samples {
+			var b []byte
+			b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(sample.value))
+			b = protowire.AppendTag(b, 2, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(sample.ts))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, b)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
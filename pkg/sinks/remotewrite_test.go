@@ -0,0 +1,134 @@
+package sinks
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest returns a line for each series of a remote write
+// WriteRequest, with its labels in order and its samples.
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	t.Helper()
+	// fields calls f with the number of each field of b and its contents,
+	// if it is length-delimited, or its value
+	fields := func(b []byte, f func(num protowire.Number, v []byte, n uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("malformed tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				f(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				f(num, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				f(num, nil, v)
+				b = b[n:]
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+		}
+	}
+	var lines []string
+	fields(b, func(_ protowire.Number, series []byte, _ uint64) {
+		var ls, ss []string
+		fields(series, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				ls = append(ls, fmt.Sprintf("%s=%q", name, value))
+			case 2:
+				var value float64
+				var ts int64
+				fields(v, func(num protowire.Number, _ []byte, n uint64) {
+					if num == 1 {
+						value = math.Float64frombits(n)
+					} else {
+						ts = int64(n)
+					}
+				})
+				ss = append(ss, fmt.Sprintf("%g@%d", value, ts))
+			}
+		})
+		lines = append(lines, fmt.Sprintf("{%s} %s", strings.Join(ls, ","), strings.Join(ss, " ")))
+	})
+	return lines
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{
+			name: "gauge",
+			want: []string{
+				fmt.Sprintf(`{__name__="ecobee_temperature",thermostat_id="1",thermostat_name="Main Floor"} 70.5@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_temperature",thermostat_id="2"} 68@%d`, nowMs),
+			},
+		},
+		{
+			name: "counter",
+			want: []string{
+				`{__name__="ecobee_runtime_seconds_total",equipment="fan"} 300@1000 600@2000`,
+			},
+		},
+		{
+			name: "untyped",
+			want: []string{
+				fmt.Sprintf(`{__name__="ecobee_up"} NaN@%d`, nowMs),
+			},
+		},
+		{
+			name: "histogram",
+			want: []string{
+				fmt.Sprintf(`{__name__="ecobee_fetch_seconds_bucket",le="0.5"} 2@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_fetch_seconds_bucket",le="+Inf"} 3@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_fetch_seconds_sum"} 1.5@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_fetch_seconds_count"} 3@%d`, nowMs),
+			},
+		},
+		{
+			name: "summary",
+			want: []string{
+				fmt.Sprintf(`{__name__="ecobee_lag_seconds",quantile="0.9"} 0.75@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_lag_seconds_sum"} 2@%d`, nowMs),
+				fmt.Sprintf(`{__name__="ecobee_lag_seconds_count"} 4@%d`, nowMs),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mfs := []*dto.MetricFamily{typed()[tt.name]}
+			if got := decodeWriteRequest(t, encodeWriteRequest(mfs, now)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+		})
+	}
+}
+
+func TestEncodeWriteRequestEmpty(t *testing.T) {
+	if b := encodeWriteRequest(nil, now); len(b) != 0 {
+		t.Errorf("encoded %d bytes of no metrics", len(b))
+	}
+}
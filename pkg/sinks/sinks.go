@@ -0,0 +1,166 @@
+// Package sinks pushes gathered metrics to destinations other than the
+// Prometheus scrape endpoint.
+package sinks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Sink receives gathered metrics.
+type Sink interface {
+	Write(ctx context.Context, mfs []*dto.MetricFamily) error
+}
+
+// Writer is a Sink that writes the Prometheus text exposition format to an
+// io.Writer.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Sink writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write implements Sink.
+func (w *Writer) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	return encode(w.w, mfs)
+}
+
+// Textfile is a Sink that writes the Prometheus text exposition format to a
+// file, such as one read by node_exporter's textfile collector. The file is
+// replaced atomically so readers never see a partial write.
+type Textfile struct {
+	path string
+}
+
+// NewTextfile returns a Sink writing to the file at path.
+func NewTextfile(path string) *Textfile {
+	return &Textfile{path: path}
+}
+
+// Write implements Sink.
+func (t *Textfile) Write(ctx context.Context, mfs []*dto.MetricFamily) error {
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := encode(tmp, mfs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), t.path)
+}
+
+func encode(w io.Writer, mfs []*dto.MetricFamily) error {
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runner periodically pushes gathered metrics to sinks.
+type Runner struct {
+	g      prometheus.Gatherer
+	sinks  []Sink
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// Start gathers metrics from g every interval and writes them to each sink
+// until the returned Runner is closed. Failures are logged and retried on
+// the next interval.
+func Start(g prometheus.Gatherer, interval time.Duration, sinks ...Sink) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runner{g: g, sinks: sinks, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			r.push(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return r
+}
+
+// Close stops the runner and flushes the latest metrics to its sinks,
+// giving up when ctx is done.
+func (r *Runner) Close(ctx context.Context) error {
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	r.push(ctx)
+	return ctx.Err()
+}
+
+// Status returns the time metrics were last written to every sink, and the
+// error of the most recent push if it failed.
+func (r *Runner) Status() (lastSuccess time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSuccess, r.lastErr
+}
+
+func (r *Runner) push(ctx context.Context) {
+	err := push(ctx, r.g, r.sinks)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = err
+	if err == nil {
+		r.lastSuccess = time.Now()
+	}
+}
+
+// Push gathers metrics from g once and writes them to each sink, logging
+// any failures with slog.Default().
+func Push(ctx context.Context, g prometheus.Gatherer, sinks ...Sink) {
+	push(ctx, g, sinks)
+}
+
+// push is Push, returning the last failure.
+func push(ctx context.Context, g prometheus.Gatherer, sinks []Sink) error {
+	mfs, lastErr := g.Gather()
+	if lastErr != nil {
+		slog.ErrorContext(ctx, "error gathering metrics for sinks", "error", lastErr)
+	}
+	for _, s := range sinks {
+		if err := s.Write(ctx, mfs); err != nil {
+			slog.ErrorContext(ctx, "error writing metrics to sink", "error", err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
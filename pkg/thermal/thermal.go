@@ -0,0 +1,129 @@
+// Package thermal estimates how quickly a home loses heat from the way its
+// indoor temperature drifts toward the outdoor temperature while the heating
+// and cooling are off.
+//
+// The home is modeled as a single thermal mass losing heat through its
+// envelope in proportion to the indoor-outdoor temperature difference
+// (Newton's law of cooling):
+//
+//	dT/dt = -(T - Tout) / tau
+//
+// While the equipment is idle, the rate of change of the indoor temperature
+// is regressed on the temperature difference, through the origin, to find
+// 1/tau. Without knowing the power of the equipment, the heat loss is
+// relative to the home's thermal mass: the fraction of the temperature
+// difference lost per hour.
+package thermal
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// MinSamples is the number of idle intervals, after decay, a Model
+	// needs before it makes an Estimate.
+	MinSamples = 12
+
+	// maxGap is the longest gap between observations that still counts as
+	// one interval; longer gaps, such as an outage, start over.
+	maxGap = 30 * time.Minute
+
+	// minDifference is the smallest indoor-outdoor difference, in degrees,
+	// that an interval needs to be used, as the drift of smaller ones is
+	// lost in the resolution of the readings.
+	minDifference = 5
+)
+
+// Model fits the thermal model of one home, or one thermostat's part of it,
+// from successive observations. It is not safe for concurrent use.
+type Model struct {
+	window time.Duration
+
+	last     observation
+	hasLast  bool
+	sxx, sxy float64 // decayed sums of x*x and x*y
+	n        float64 // decayed number of intervals
+	updated  time.Time
+}
+
+type observation struct {
+	at      time.Time
+	indoor  float64
+	outdoor float64
+	idle    bool
+}
+
+// NewModel returns a Model that weighs observations by their age,
+// exponentially with a time constant of window, so that it follows changes
+// to the home, such as new insulation or open windows, over about that long.
+func NewModel(window time.Duration) *Model {
+	return &Model{window: window}
+}
+
+// Observe adds the indoor and outdoor temperatures at a time, and whether the
+// heating and cooling were idle then. Observations must be in chronological
+// order; ones no newer than the last are ignored.
+func (m *Model) Observe(at time.Time, indoor, outdoor float64, idle bool) {
+	cur := observation{at: at, indoor: indoor, outdoor: outdoor, idle: idle}
+	if m.hasLast && !at.After(m.last.at) {
+		return
+	}
+	prev, hadLast := m.last, m.hasLast
+	m.last, m.hasLast = cur, true
+	if !hadLast || !prev.idle || !cur.idle {
+		return
+	}
+	gap := at.Sub(prev.at)
+	if gap > maxGap {
+		return
+	}
+	x := (prev.indoor+cur.indoor)/2 - (prev.outdoor+cur.outdoor)/2
+	if math.Abs(x) < minDifference {
+		return
+	}
+	y := (cur.indoor - prev.indoor) / gap.Hours()
+
+	if !m.updated.IsZero() && m.window > 0 {
+		decay := math.Exp(-at.Sub(m.updated).Seconds() / m.window.Seconds())
+		m.sxx *= decay
+		m.sxy *= decay
+		m.n *= decay
+	}
+	m.sxx += x * x
+	m.sxy += x * y
+	m.n++
+	m.updated = at
+}
+
+// Estimate is a fitted thermal model.
+type Estimate struct {
+	// HeatLoss is the fraction of the indoor-outdoor temperature
+	// difference lost per hour while idle, the heat loss coefficient
+	// relative to the home's thermal mass.
+	HeatLoss float64
+
+	// TimeConstant is how long the indoor temperature takes to close
+	// about 63% of the difference to the outdoor temperature while idle.
+	TimeConstant time.Duration
+
+	// Samples is the decayed number of idle intervals fitted.
+	Samples float64
+}
+
+// Estimate returns the fitted model, and false while there are too few
+// samples or they don't show the home losing heat.
+func (m *Model) Estimate() (Estimate, bool) {
+	if m.n < MinSamples || m.sxx == 0 {
+		return Estimate{}, false
+	}
+	k := -m.sxy / m.sxx
+	if k <= 0 {
+		return Estimate{}, false
+	}
+	return Estimate{
+		HeatLoss:     k,
+		TimeConstant: time.Duration(float64(time.Hour) / k),
+		Samples:      m.n,
+	}, true
+}
@@ -0,0 +1,93 @@
+package thermal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+// cooling returns the indoor temperature of a home with time constant tau
+// at elapsed, starting at indoor, with the outdoor temperature constant.
+func cooling(indoor, outdoor float64, tau, elapsed time.Duration) float64 {
+	return outdoor + (indoor-outdoor)*math.Exp(-elapsed.Hours()/tau.Hours())
+}
+
+func TestModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int           // observations
+		step     time.Duration // between them
+		indoor   float64       // at the start
+		outdoor  float64
+		tau      time.Duration // negative to warm away from the outdoors
+		idle     bool
+		ok       bool
+		heatLoss float64
+	}{
+		{"cooling", 25, 5 * time.Minute, 70, 20, 10 * time.Hour, true, true, 0.1},
+		{"leaky", 25, 5 * time.Minute, 70, 20, 2 * time.Hour, true, true, 0.5},
+		{"warm outside", 25, 5 * time.Minute, 70, 95, 5 * time.Hour, true, true, 0.2},
+		{"too few", MinSamples, 5 * time.Minute, 70, 20, 10 * time.Hour, true, false, 0},
+		{"running", 25, 5 * time.Minute, 70, 20, 10 * time.Hour, false, false, 0},
+		{"small difference", 25, 5 * time.Minute, 70, 67, 10 * time.Hour, true, false, 0},
+		{"gaps", 25, time.Hour, 70, 20, 10 * time.Hour, true, false, 0},
+		{"warming", 25, 5 * time.Minute, 70, 20, -10 * time.Hour, true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewModel(0)
+			for i := 0; i < tt.n; i++ {
+				elapsed := time.Duration(i) * tt.step
+				m.Observe(start.Add(elapsed), cooling(tt.indoor, tt.outdoor, tt.tau, elapsed), tt.outdoor, tt.idle)
+			}
+			e, ok := m.Estimate()
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if math.Abs(e.HeatLoss-tt.heatLoss)/tt.heatLoss > 0.01 {
+				t.Errorf("heat loss %v, want %v", e.HeatLoss, tt.heatLoss)
+			}
+			if want := time.Duration(float64(time.Hour) / e.HeatLoss); e.TimeConstant != want {
+				t.Errorf("time constant %v, want %v", e.TimeConstant, want)
+			}
+			if e.Samples != float64(tt.n-1) {
+				t.Errorf("%v samples, want %d", e.Samples, tt.n-1)
+			}
+		})
+	}
+}
+
+func TestModelOutOfOrder(t *testing.T) {
+	m := NewModel(0)
+	for i := 0; i < 25; i++ {
+		elapsed := time.Duration(i) * 5 * time.Minute
+		m.Observe(start.Add(elapsed), cooling(70, 20, 10*time.Hour, elapsed), 20, true)
+		// a stale reading, which would suggest the home warmed
+		m.Observe(start.Add(elapsed-time.Minute), 80, 20, true)
+	}
+	e, ok := m.Estimate()
+	if !ok {
+		t.Fatal("no estimate")
+	}
+	if math.Abs(e.HeatLoss-0.1) > 0.001 {
+		t.Errorf("heat loss %v, want 0.1", e.HeatLoss)
+	}
+}
+
+func TestModelDecay(t *testing.T) {
+	m := NewModel(time.Hour)
+	for i := 0; i < 25; i++ {
+		elapsed := time.Duration(i) * 5 * time.Minute
+		m.Observe(start.Add(elapsed), cooling(70, 20, 10*time.Hour, elapsed), 20, true)
+	}
+	// the samples of the first two hours have decayed to fewer than
+	// needed
+	if e, ok := m.Estimate(); ok {
+		t.Errorf("estimate from %v decayed samples, want none", e.Samples)
+	}
+}
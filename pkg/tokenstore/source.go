@@ -0,0 +1,210 @@
+package tokenstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// PinPrompt presents an ecobee PIN to the user and returns once they have
+// authorized it in the ecobee consumer portal.
+type PinPrompt func(pin string) error
+
+// StdinPrompt prints the PIN to stdout and waits for the user to press
+// enter.
+func StdinPrompt(pin string) error {
+	fmt.Printf("Pin is %q\nPress <enter> after authorizing it on https://www.ecobee.com/consumerportal in the menu"+
+		" under 'My Apps'\n", pin)
+	var input string
+	fmt.Scanln(&input)
+	return nil
+}
+
+type options struct {
+	baseURL string
+	scopes  []string
+	client  *http.Client
+	prompt  PinPrompt
+}
+
+// Option configures a token source.
+type Option func(*options)
+
+// WithBaseURL sends authorization requests to u instead of the ecobee API.
+func WithBaseURL(u string) Option {
+	return func(o *options) {
+		o.baseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithScopes sets the scopes requested during PIN authorization. It
+// defaults to smartRead.
+func WithScopes(scopes ...string) Option {
+	return func(o *options) {
+		o.scopes = scopes
+	}
+}
+
+// WithHTTPClient sets the client used for authorization requests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithPinPrompt sets how the PIN is presented during first-time
+// authorization. It defaults to StdinPrompt.
+func WithPinPrompt(p PinPrompt) Option {
+	return func(o *options) {
+		o.prompt = p
+	}
+}
+
+type source struct {
+	appKey string
+	store  Store
+	opts   options
+
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+// TokenSource returns an oauth2.TokenSource for the application key appKey
+// that loads its token from store, refreshes it when it expires and saves
+// every new token back to store. If store holds no token, the PIN
+// authorization flow is run.
+func TokenSource(appKey string, store Store, opts ...Option) oauth2.TokenSource {
+	s := &source{
+		appKey: appKey,
+		store:  store,
+		opts: options{
+			baseURL: "https://api.ecobee.com",
+			scopes:  []string{"smartRead"},
+			client:  http.DefaultClient,
+			prompt:  StdinPrompt,
+		},
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+// Token implements oauth2.TokenSource.
+func (s *source) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok == nil {
+		tok, err := s.store.Load()
+		if err != nil && !errors.Is(err, ErrNoToken) {
+			return nil, fmt.Errorf("error loading token: %v", err)
+		}
+		s.tok = tok
+	}
+	if s.tok.Valid() {
+		return s.tok, nil
+	}
+
+	var (
+		tok *oauth2.Token
+		err error
+	)
+	if s.tok != nil && s.tok.RefreshToken != "" {
+		tok, err = s.token(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {s.tok.RefreshToken},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error refreshing token: %v", err)
+		}
+	} else {
+		tok, err = s.authorize()
+		if err != nil {
+			return nil, fmt.Errorf("error on initial authentication: %v", err)
+		}
+	}
+	if err := s.store.Save(tok); err != nil {
+		return nil, fmt.Errorf("error saving token: %v", err)
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// authorize runs the PIN authorization flow.
+func (s *source) authorize() (*oauth2.Token, error) {
+	uv := url.Values{
+		"response_type": {"ecobeePin"},
+		"client_id":     {s.appKey},
+		"scope":         {strings.Join(s.opts.scopes, ",")},
+	}
+	var pr struct {
+		EcobeePin string `json:"ecobeePin"`
+		Code      string `json:"code"`
+	}
+	if err := s.do(http.MethodGet, "/authorize?"+uv.Encode(), &pr); err != nil {
+		return nil, err
+	}
+	if err := s.opts.prompt(pr.EcobeePin); err != nil {
+		return nil, err
+	}
+	return s.token(url.Values{
+		"grant_type": {"ecobeePin"},
+		"code":       {pr.Code},
+	})
+}
+
+// token requests a new token from the token endpoint.
+func (s *source) token(uv url.Values) (*oauth2.Token, error) {
+	uv.Set("client_id", s.appKey)
+	var tr struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		TokenType    string `json:"token_type"`
+	}
+	if err := s.do(http.MethodPost, "/token?"+uv.Encode(), &tr); err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}
+	if !tok.Valid() {
+		return nil, errors.New("invalid token")
+	}
+	return tok, nil
+}
+
+func (s *source) do(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, s.opts.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.opts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid server response: %v", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error unmarshalling response: %v", err)
+	}
+	return nil
+}
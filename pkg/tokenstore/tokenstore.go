@@ -0,0 +1,103 @@
+// Package tokenstore obtains and persists ecobee API tokens.
+//
+// A Store holds the most recent token; TokenSource uses it to refresh
+// tokens as they expire and to run ecobee's PIN authorization flow the
+// first time an application is used.
+package tokenstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by Store.Load when no token has been saved.
+var ErrNoToken = errors.New("no token stored")
+
+// Store persists a single token.
+type Store interface {
+	// Load returns the saved token, or ErrNoToken if there is none.
+	Load() (*oauth2.Token, error)
+
+	// Save replaces the saved token with tok.
+	Save(tok *oauth2.Token) error
+}
+
+// File is a Store that keeps the token as JSON in a file. The format is
+// compatible with the cache files written by go-ecobee.
+type File struct {
+	path string
+}
+
+// NewFile returns a Store backed by the file at path.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Load implements Store.
+func (f *File) Load() (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	} else if err != nil {
+		return nil, err
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(b, &tok); err != nil {
+		return nil, err
+	}
+	return &tok, nil
+}
+
+// Save implements Store. The file is replaced atomically so that a crash
+// never leaves a truncated token behind.
+func (f *File) Save(tok *oauth2.Token) error {
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Memory is a Store that keeps the token in memory.
+type Memory struct {
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+// Load implements Store.
+func (m *Memory) Load() (*oauth2.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tok == nil {
+		return nil, ErrNoToken
+	}
+	tok := *m.tok
+	return &tok, nil
+}
+
+// Save implements Store.
+func (m *Memory) Save(tok *oauth2.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := *tok
+	m.tok = &t
+	return nil
+}
@@ -0,0 +1,92 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NWS is a Source backed by the latest observation of the weather station
+// nearest a location in the US National Weather Service API, which covers
+// the United States only.
+type NWS struct {
+	lat, lon  float64
+	userAgent string
+	baseURL   string
+
+	mu      sync.Mutex
+	station string // observation station, looked up on first use
+}
+
+// NewNWS returns a Source for the conditions at lat and lon. The NWS asks
+// that requests identify the application with userAgent.
+func NewNWS(lat, lon float64, userAgent string) *NWS {
+	return &NWS{lat: lat, lon: lon, userAgent: userAgent, baseURL: "https://api.weather.gov"}
+}
+
+// Name implements Source.
+func (s *NWS) Name() string {
+	return "nws"
+}
+
+// Current implements Source.
+func (s *NWS) Current(ctx context.Context) (Conditions, error) {
+	station, err := s.nearestStation(ctx)
+	if err != nil {
+		return Conditions{}, fmt.Errorf("error finding nws station: %w", err)
+	}
+	type value struct {
+		Value *float64 `json:"value"`
+	}
+	var r struct {
+		Properties struct {
+			Timestamp        time.Time `json:"timestamp"`
+			Temperature      value     `json:"temperature"`
+			RelativeHumidity value     `json:"relativeHumidity"`
+		} `json:"properties"`
+	}
+	if err := getJSON(ctx, station+"/observations/latest", s.userAgent, &r); err != nil {
+		return Conditions{}, fmt.Errorf("error fetching nws observation: %w", err)
+	}
+	p := r.Properties
+	if p.Temperature.Value == nil {
+		return Conditions{}, fmt.Errorf("nws station %s reported no temperature", station)
+	}
+	c := Conditions{Time: p.Timestamp, Temperature: fahrenheit(*p.Temperature.Value)}
+	if p.RelativeHumidity.Value != nil {
+		c.Humidity, c.HasHumidity = *p.RelativeHumidity.Value, true
+	}
+	return c, nil
+}
+
+// nearestStation returns the URL of the observation station nearest the
+// location, looking it up the first time.
+func (s *NWS) nearestStation(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.station != "" {
+		return s.station, nil
+	}
+	var point struct {
+		Properties struct {
+			ObservationStations string `json:"observationStations"`
+		} `json:"properties"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf("%s/points/%.4f,%.4f", s.baseURL, s.lat, s.lon), s.userAgent, &point); err != nil {
+		return "", err
+	}
+	var stations struct {
+		Features []struct {
+			ID string `json:"id"`
+		} `json:"features"`
+	}
+	if err := getJSON(ctx, point.Properties.ObservationStations, s.userAgent, &stations); err != nil {
+		return "", err
+	}
+	if len(stations.Features) == 0 {
+		return "", fmt.Errorf("no observation stations near %.4f,%.4f", s.lat, s.lon)
+	}
+	s.station = stations.Features[0].ID
+	return s.station, nil
+}
@@ -0,0 +1,58 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// OpenMeteo is a Source backed by the Open-Meteo forecast API, which covers
+// the whole world and needs no key.
+type OpenMeteo struct {
+	lat, lon float64
+	baseURL  string
+}
+
+// NewOpenMeteo returns a Source for the conditions at lat and lon.
+func NewOpenMeteo(lat, lon float64) *OpenMeteo {
+	return &OpenMeteo{lat: lat, lon: lon, baseURL: "https://api.open-meteo.com"}
+}
+
+// Name implements Source.
+func (s *OpenMeteo) Name() string {
+	return "open-meteo"
+}
+
+// Current implements Source.
+func (s *OpenMeteo) Current(ctx context.Context) (Conditions, error) {
+	q := url.Values{
+		"latitude":         {fmt.Sprint(s.lat)},
+		"longitude":        {fmt.Sprint(s.lon)},
+		"current":          {"temperature_2m,relative_humidity_2m"},
+		"temperature_unit": {"fahrenheit"},
+		"timezone":         {"GMT"},
+	}
+	var r struct {
+		Current struct {
+			Time             string   `json:"time"`
+			Temperature      *float64 `json:"temperature_2m"`
+			RelativeHumidity *float64 `json:"relative_humidity_2m"`
+		} `json:"current"`
+	}
+	if err := getJSON(ctx, s.baseURL+"/v1/forecast?"+q.Encode(), "", &r); err != nil {
+		return Conditions{}, fmt.Errorf("error fetching open-meteo conditions: %w", err)
+	}
+	if r.Current.Temperature == nil {
+		return Conditions{}, fmt.Errorf("open-meteo reported no temperature")
+	}
+	t, err := time.Parse("2006-01-02T15:04", r.Current.Time)
+	if err != nil {
+		return Conditions{}, fmt.Errorf("invalid open-meteo time: %v", err)
+	}
+	c := Conditions{Time: t, Temperature: *r.Current.Temperature}
+	if r.Current.RelativeHumidity != nil {
+		c.Humidity, c.HasHumidity = *r.Current.RelativeHumidity, true
+	}
+	return c, nil
+}
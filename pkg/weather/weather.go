@@ -0,0 +1,70 @@
+// Package weather fetches current outdoor conditions from public weather
+// services, for when the weather ecobee reports with a thermostat is
+// missing or stale.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Conditions are the outdoor conditions at a time.
+type Conditions struct {
+	// Time is when the conditions were observed or modeled.
+	Time time.Time
+
+	// Temperature is in degrees Fahrenheit.
+	Temperature float64
+
+	// Humidity is the relative humidity in percent, if HasHumidity.
+	Humidity    float64
+	HasHumidity bool
+}
+
+// Source provides current outdoor conditions.
+type Source interface {
+	// Name identifies the source, such as "open-meteo", in the source
+	// label of the metrics it produces.
+	Name() string
+
+	// Current returns the most recent conditions.
+	Current(ctx context.Context) (Conditions, error)
+}
+
+// httpClient is used for requests to weather services.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// getJSON fetches u and decodes its JSON body into v.
+func getJSON(ctx context.Context, u, userAgent string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/geo+json, application/json")
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("weather request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error unmarshalling json: %v", err)
+	}
+	return nil
+}
+
+// fahrenheit converts degrees Celsius to Fahrenheit.
+func fahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
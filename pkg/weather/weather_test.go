@@ -0,0 +1,162 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFahrenheit(t *testing.T) {
+	tests := []struct{ c, f float64 }{
+		{0, 32},
+		{100, 212},
+		{-40, -40},
+		{21.5, 70.7},
+	}
+	for _, tt := range tests {
+		if got := fahrenheit(tt.c); fmt.Sprintf("%.2f", got) != fmt.Sprintf("%.2f", tt.f) {
+			t.Errorf("fahrenheit(%v) = %v, want %v", tt.c, got, tt.f)
+		}
+	}
+}
+
+// serve returns a server answering requests for each path with its body,
+// and 404 for any other.
+func serve(t *testing.T, bodies map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, strings.ReplaceAll(body, "$URL", "http://"+r.Host))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenMeteo(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Conditions
+		err  string
+	}{
+		{
+			name: "current",
+			body: `{"current":{"time":"2026-10-15T12:00","temperature_2m":70.5,"relative_humidity_2m":45}}`,
+			want: Conditions{Time: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC), Temperature: 70.5, Humidity: 45, HasHumidity: true},
+		},
+		{
+			name: "no humidity",
+			body: `{"current":{"time":"2026-10-15T12:00","temperature_2m":-3.5}}`,
+			want: Conditions{Time: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC), Temperature: -3.5},
+		},
+		{
+			name: "no temperature",
+			body: `{"current":{"time":"2026-10-15T12:00"}}`,
+			err:  "open-meteo reported no temperature",
+		},
+		{
+			name: "invalid time",
+			body: `{"current":{"time":"noon","temperature_2m":70.5}}`,
+			err:  "invalid open-meteo time",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.RawQuery
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			s := NewOpenMeteo(42.36, -71.06)
+			s.baseURL = srv.URL
+			got, err := s.Current(context.Background())
+			if !strings.Contains(query, "temperature_unit=fahrenheit") {
+				t.Errorf("query %q doesn't ask for degrees Fahrenheit", query)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNWS(t *testing.T) {
+	points := `{"properties":{"observationStations":"$URL/gridpoints/BOX/71,90/stations"}}`
+	stations := `{"features":[{"id":"$URL/stations/KBOS"},{"id":"$URL/stations/KOWD"}]}`
+	tests := []struct {
+		name        string
+		observation string
+		stations    string
+		want        Conditions
+		err         string
+	}{
+		{
+			name:        "latest",
+			observation: `{"properties":{"timestamp":"2026-10-15T11:54:00+00:00","temperature":{"value":20},"relativeHumidity":{"value":61.5}}}`,
+			stations:    stations,
+			want:        Conditions{Time: time.Date(2026, 10, 15, 11, 54, 0, 0, time.UTC), Temperature: 68, Humidity: 61.5, HasHumidity: true},
+		},
+		{
+			name:        "no humidity",
+			observation: `{"properties":{"timestamp":"2026-10-15T11:54:00+00:00","temperature":{"value":-10},"relativeHumidity":{"value":null}}}`,
+			stations:    stations,
+			want:        Conditions{Time: time.Date(2026, 10, 15, 11, 54, 0, 0, time.UTC), Temperature: 14},
+		},
+		{
+			name:        "no temperature",
+			observation: `{"properties":{"timestamp":"2026-10-15T11:54:00+00:00","temperature":{"value":null}}}`,
+			stations:    stations,
+			err:         "nws station",
+		},
+		{
+			name:     "no stations",
+			stations: `{"features":[]}`,
+			err:      "error finding nws station: no observation stations",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, map[string]string{
+				"/points/42.3601,-71.0589":           points,
+				"/gridpoints/BOX/71,90/stations":     tt.stations,
+				"/stations/KBOS/observations/latest": tt.observation,
+			})
+			s := NewNWS(42.3601, -71.0589, "test")
+			s.baseURL = srv.URL
+			got, err := s.Current(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("time %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time = tt.want.Time
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+)
+
+// maxRecentErrors is how many collection errors /-/errors keeps.
+const maxRecentErrors = 50
+
+type recentError struct {
+	Time         time.Time `json:"time"`
+	Stage        string    `json:"stage"`
+	ThermostatID string    `json:"thermostatId,omitempty"`
+	CollectionID string    `json:"collectionId,omitempty"`
+	Error        string    `json:"error"`
+}
+
+// recentErrors is a ring buffer of the latest collection errors, served as
+// JSON on /-/errors, newest first.
+type recentErrors struct {
+	mu    sync.Mutex
+	buf   [maxRecentErrors]recentError
+	next  int
+	count int
+}
+
+// add records err. It is a collector error handler.
+func (r *recentErrors) add(err *collector.Error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = recentError{
+		Time:         time.Now(),
+		Stage:        err.Stage,
+		ThermostatID: err.ThermostatID,
+		CollectionID: err.CollectionID,
+		Error:        err.Err.Error(),
+	}
+	r.next = (r.next + 1) % len(r.buf)
+	if r.count < len(r.buf) {
+		r.count++
+	}
+}
+
+// list returns the recorded errors, newest first.
+func (r *recentErrors) list() []recentError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := make([]recentError, 0, r.count)
+	for i := 1; i <= r.count; i++ {
+		l = append(l, r.buf[(r.next-i+len(r.buf))%len(r.buf)])
+	}
+	return l
+}
+
+// summary describes the recorded errors in one line.
+func (r *recentErrors) summary() string {
+	l := r.list()
+	if len(l) == 0 {
+		return "no recent collection errors"
+	}
+	return fmt.Sprintf("%d recent collection errors, latest at %s: %s",
+		len(l), l[0].Time.Format(time.RFC3339), l[0].Error)
+}
+
+func (r *recentErrors) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(r.list())
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/joeshaw/ecobee-exporter/internal/config"
+	"github.com/joeshaw/ecobee-exporter/pkg/pipeline"
+)
+
+// configReloader is the metric transforms and shard thermostats of the
+// configuration file, replaced by those of the file on disk when it
+// receives SIGHUP, along with the background poll flags it sets. It
+// exports the outcome of the last reload, like Prometheus does, so that
+// failed reloads can be alerted on.
+type configReloader struct {
+	path       string
+	cfg        *config.Config // in effect
+	set        map[string]bool
+	transforms atomic.Pointer[[]pipeline.Transformer]
+	shard      atomic.Pointer[map[string]bool]
+
+	mu    sync.Mutex // held while reloading
+	hooks []func()
+
+	successful  prometheus.Gauge
+	successTime prometheus.Gauge
+	hash        prometheus.Gauge
+}
+
+// reloadableFlags are the flags a reload of the configuration file puts
+// into effect, with the values they take when the file doesn't set them.
+var reloadableFlags = map[string]string{
+	"poll.interval":      "0s",
+	"poll.busy-interval": "0s",
+	"poll.jitter":        "0s",
+	"poll.align":         "false",
+}
+
+// newConfigReloader loads the configuration file at path, if any,
+// returning it along with a reloader of its transforms, whose metrics are
+// registered with reg if there is a file.
+func newConfigReloader(path string, reg prometheus.Registerer) (*configReloader, *config.Config, error) {
+	r := &configReloader{
+		path: path,
+		set:  map[string]bool{},
+		successful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ecobee_config_last_reload_successful",
+			Help: "whether the last reload of the configuration file succeeded (0 or 1)",
+		}),
+		successTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ecobee_config_last_reload_success_timestamp_seconds",
+			Help: "time of the last successful reload of the configuration file",
+		}),
+		hash: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ecobee_config_hash",
+			Help: "hash of the contents of the configuration file in effect",
+		}),
+	}
+	cfg, transforms, sum, err := r.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if path != "" {
+		if r.set, err = setFlags(); err != nil {
+			return nil, nil, err
+		}
+		reg.MustRegister(r.successful, r.successTime, r.hash)
+	}
+	r.apply(cfg, transforms, sum)
+	return r, cfg, nil
+}
+
+// read reads and validates the configuration file.
+func (r *configReloader) read() (*config.Config, []pipeline.Transformer, [sha256.Size]byte, error) {
+	cfg, sum := &config.Config{}, [sha256.Size]byte{}
+	if r.path != "" {
+		b, err := os.ReadFile(r.path)
+		if err != nil {
+			return nil, nil, sum, err
+		}
+		if cfg, err = config.Parse(b); err != nil {
+			return nil, nil, sum, fmt.Errorf("parsing %s: %v", r.path, err)
+		}
+		sum = sha256.Sum256(b)
+	}
+	transforms, err := cfg.Transformers()
+	if err != nil {
+		return nil, nil, sum, err
+	}
+	if _, err := cfg.Definitions("ecobee"); err != nil {
+		return nil, nil, sum, err
+	}
+	return cfg, transforms, sum, nil
+}
+
+// apply puts cfg, whose contents hash to sum, into effect.
+func (r *configReloader) apply(cfg *config.Config, transforms []pipeline.Transformer, sum [sha256.Size]byte) {
+	r.cfg = cfg
+	r.transforms.Store(&transforms)
+	if cfg.Shard != nil {
+		ids := make(map[string]bool, len(cfg.Shard.Thermostats))
+		for _, id := range cfg.Shard.Thermostats {
+			ids[id] = true
+		}
+		r.shard.Store(&ids)
+	}
+	r.successful.Set(1)
+	r.successTime.SetToCurrentTime()
+	// the first 6 bytes fit a float64 exactly
+	r.hash.Set(float64(binary.BigEndian.Uint64(append([]byte{0, 0}, sum[:6]...))))
+}
+
+// reload reloads the configuration file. If it is invalid or changes
+// anything that takes a restart, it fails and the configuration in
+// effect is kept whole.
+func (r *configReloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start := time.Now()
+	cfg, transforms, sum, err := r.read()
+	if err == nil {
+		err = r.reloadable(cfg)
+	}
+	if err != nil {
+		r.successful.Set(0)
+		slog.Error("error reloading configuration file", "path", r.path, "error", err)
+		return
+	}
+	for _, name := range changedFlags(r.cfg.Flags, cfg.Flags) {
+		if r.set[name] {
+			continue
+		}
+		v := reloadableFlags[name]
+		if vs := cfg.Flags[name]; len(vs) > 0 {
+			v = vs[0]
+		}
+		// the value was validated by reloadable
+		app.GetFlag(name).Model().Value.Set(v)
+	}
+	r.apply(cfg, transforms, sum)
+	for _, f := range r.hooks {
+		f()
+	}
+	slog.Info("Reloaded configuration file", "path", r.path, "duration", time.Since(start))
+}
+
+// reloadable returns an error naming the parts of cfg that differ from the
+// configuration in effect and take a restart: its additional metrics,
+// accounts, shard name, any flags but those of reloadableFlags, and
+// turning background polling on or off. Flags given on the command line
+// or in the environment take precedence over the file, so changes to them
+// are ignored.
+func (r *configReloader) reloadable(cfg *config.Config) error {
+	var changed []string
+	if !reflect.DeepEqual(r.cfg.Metrics, cfg.Metrics) {
+		changed = append(changed, "metrics")
+	}
+	if !reflect.DeepEqual(r.cfg.Accounts, cfg.Accounts) {
+		changed = append(changed, "accounts")
+	}
+	if (r.cfg.Shard == nil) != (cfg.Shard == nil) || r.cfg.Shard != nil && r.cfg.Shard.Name != cfg.Shard.Name {
+		changed = append(changed, "shard name")
+	}
+	for _, name := range changedFlags(r.cfg.Flags, cfg.Flags) {
+		if r.set[name] {
+			continue
+		}
+		def, ok := reloadableFlags[name]
+		if !ok {
+			changed = append(changed, "flag "+name)
+			continue
+		}
+		v := def
+		if vs := cfg.Flags[name]; len(vs) > 0 {
+			v = vs[0]
+		}
+		var err error
+		switch name {
+		case "poll.align":
+			_, err = strconv.ParseBool(v)
+		case "poll.interval":
+			var d time.Duration
+			if d, err = time.ParseDuration(v); err == nil && (d > 0) != (*pollInterval > 0) {
+				changed = append(changed, "flag poll.interval to or from 0")
+			}
+		default:
+			_, err = time.ParseDuration(v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: flag %s: %v", r.path, name, err)
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%s: changes to %s take a restart", r.path, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// onReload calls f after each successful reload, such as to apply the
+// reloaded flags.
+func (r *configReloader) onReload(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, f)
+}
+
+// keep reports whether the thermostat id is in the shard of the
+// configuration file in effect.
+func (r *configReloader) keep(id string) bool {
+	return (*r.shard.Load())[id]
+}
+
+// changedFlags returns the names of the flags set differently in a and b.
+func changedFlags(a, b map[string]config.FlagValue) []string {
+	var changed []string
+	for name, v := range a {
+		if w, ok := b[name]; !ok || !slices.Equal(v, w) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watch reloads the configuration file each time the process receives
+// SIGHUP, until stop is closed.
+func (r *configReloader) watch(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				r.reload()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Transform implements pipeline.Transformer, applying the transforms of
+// the configuration file last loaded.
+func (r *configReloader) Transform(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	for _, t := range *r.transforms.Load() {
+		mfs = t.Transform(mfs)
+	}
+	return mfs
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/billykwooten/go-ecobee/ecobee"
+
+	"github.com/joeshaw/ecobee-exporter/pkg/client"
+)
+
+// selfTestInterval is the minimum time between API calls made by the
+// self-test endpoint; requests in between are answered with the last
+// report.
+const selfTestInterval = 30 * time.Second
+
+// selfTestReport is the JSON response of /-/selftest.
+type selfTestReport struct {
+	Time        time.Time `json:"time"`
+	Cached      bool      `json:"cached"`
+	Auth        string    `json:"auth"`
+	Latency     float64   `json:"latencySeconds"`
+	Thermostats int       `json:"thermostats"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// selfTest serves /-/selftest, which checks on demand that the API can be
+// reached with the configured credentials.
+type selfTest struct {
+	client *client.Client
+
+	mu   sync.Mutex
+	last *selfTestReport
+}
+
+func newSelfTest(c *client.Client) *selfTest {
+	return &selfTest{client: c}
+}
+
+func (s *selfTest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.last == nil || time.Since(s.last.Time) >= selfTestInterval {
+		s.last = s.run(r.Context())
+	} else {
+		s.last.Cached = true
+	}
+	report := *s.last
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// run fetches the thermostat summary, the cheapest call that needs a valid
+// token.
+func (s *selfTest) run(ctx context.Context) *selfTestReport {
+	report := &selfTestReport{Time: time.Now(), Auth: "ok"}
+	sel := ecobee.Selection{SelectionType: "registered"}
+	if *emsSet != "" {
+		sel = ecobee.Selection{SelectionType: "managementSet", SelectionMatch: *emsSet}
+	}
+	ts, err := s.client.GetThermostatSummary(ctx, sel)
+	report.Latency = time.Since(report.Time).Seconds()
+	report.Thermostats = len(ts)
+	if err != nil {
+		report.Error = err.Error()
+		report.Auth = authStatus(err)
+	}
+	return report
+}
+
+// authStatus classifies a failed API call: "failed" if the API rejected
+// the token, "ok" if it accepted the token but failed otherwise and
+// "unknown" if the API wasn't reached, e.g. because no token could be
+// obtained.
+func authStatus(err error) string {
+	var apiErr *client.Error
+	switch {
+	case !errors.As(err, &apiErr):
+		return "unknown"
+	case errors.Is(apiErr, client.ErrAuth):
+		return "failed"
+	}
+	return "ok"
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNoService = errors.New("services are only supported on Windows; use your init system, such as systemd, instead")
+
+func isService() bool {
+	return false
+}
+
+func runService() {}
+
+func installService() {
+	fatal(errNoService)
+}
+
+func uninstallService() {
+	fatal(errNoService)
+}
+
+func startService() {
+	fatal(errNoService)
+}
+
+func stopService() {
+	fatal(errNoService)
+}
@@ -0,0 +1,173 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name the exporter is registered under with the
+// Windows service manager.
+const serviceName = "ecobee-exporter"
+
+// isService reports whether the process was started by the Windows service
+// manager.
+func isService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runService serves metrics as a Windows service until the service manager
+// stops it.
+func runService() {
+	if err := svc.Run(serviceName, exporterService{}); err != nil {
+		fatal(fmt.Errorf("error running service: %v", err))
+	}
+}
+
+// exporterService implements svc.Handler.
+type exporterService struct{}
+
+func (exporterService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(stop)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for r := range requests {
+		switch r.Cmd {
+		case svc.Interrogate:
+			status <- r.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending, WaitHint: uint32((*shutdownTimeout + 5*time.Second).Milliseconds())}
+			close(stop)
+			<-done
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// serviceArgs returns the command line arguments of this process without
+// the service install command, for the service to run with.
+func serviceArgs() []string {
+	var args []string
+	skip := map[string]bool{"service": true, "install": true}
+	for _, a := range os.Args[1:] {
+		if skip[a] {
+			delete(skip, a)
+			continue
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// installService registers the exporter with the Windows service manager,
+// to start automatically with the flags given to the install command, and
+// to restart a minute after it fails.
+func installService() {
+	exe, err := os.Executable()
+	if err != nil {
+		fatal(err)
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		fatal(err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		fatal(fmt.Errorf("error connecting to the service manager: %v", err))
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		fatal(fmt.Errorf("service %s is already installed", serviceName))
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Ecobee Exporter",
+		Description: "Exports ecobee thermostat metrics for Prometheus",
+		StartType:   mgr.StartAutomatic,
+	}, serviceArgs()...)
+	if err != nil {
+		fatal(fmt.Errorf("error installing service: %v", err))
+	}
+	defer s.Close()
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: time.Minute}}
+	if err := s.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		slog.Warn("unable to set service recovery actions", "error", err)
+	}
+	slog.Info("Installed service", "name", serviceName, "path", exe)
+}
+
+// openService opens the exporter's service, for f to act on.
+func openService(f func(*mgr.Service) error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		fatal(fmt.Errorf("error connecting to the service manager: %v", err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		fatal(fmt.Errorf("service %s is not installed: %v", serviceName, err))
+	}
+	defer s.Close()
+	if err := f(s); err != nil {
+		fatal(err)
+	}
+}
+
+// uninstallService removes the exporter from the Windows service manager.
+func uninstallService() {
+	openService(func(s *mgr.Service) error {
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("error removing service: %v", err)
+		}
+		slog.Info("Removed service", "name", serviceName)
+		return nil
+	})
+}
+
+// startService starts the exporter's Windows service.
+func startService() {
+	openService(func(s *mgr.Service) error {
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("error starting service: %v", err)
+		}
+		slog.Info("Started service", "name", serviceName)
+		return nil
+	})
+}
+
+// stopService stops the exporter's Windows service, waiting for it to shut
+// down.
+func stopService() {
+	openService(func(s *mgr.Service) error {
+		st, err := s.Control(svc.Stop)
+		if err != nil {
+			return fmt.Errorf("error stopping service: %v", err)
+		}
+		deadline := time.Now().Add(*shutdownTimeout + 10*time.Second)
+		for st.State != svc.Stopped {
+			if time.Now().After(deadline) {
+				return errors.New("timed out waiting for service to stop")
+			}
+			time.Sleep(300 * time.Millisecond)
+			if st, err = s.Query(); err != nil {
+				return fmt.Errorf("error querying service: %v", err)
+			}
+		}
+		slog.Info("Stopped service", "name", serviceName)
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/joeshaw/ecobee-exporter/internal/config"
+	"github.com/joeshaw/ecobee-exporter/pkg/collector"
+)
+
+// shard returns the collector option restricting collection to this
+// exporter's shard of the thermostats, either those listed in the
+// configuration file or those whose IDs hash to --shard.index of
+// --shard.count, along with a metric advertising the shard. The
+// thermostats listed in the configuration file are those of r, as of its
+// latest reload, unless r is nil. It returns nils if the exporter isn't
+// sharded.
+func shard(cfg *config.Config, r *configReloader) (collector.Option, prometheus.Collector, error) {
+	var keep func(string) bool
+	var labels prometheus.Labels
+	switch {
+	case cfg.Shard != nil && *shardCount > 0:
+		return nil, nil, errors.New("shard: use either --shard.count or a shard in the configuration file, not both")
+	case cfg.Shard != nil:
+		ids := make(map[string]bool, len(cfg.Shard.Thermostats))
+		for _, id := range cfg.Shard.Thermostats {
+			ids[id] = true
+		}
+		keep = func(id string) bool { return ids[id] }
+		if r != nil {
+			keep = r.keep
+		}
+		labels = prometheus.Labels{"method": "config", "shard": cfg.Shard.Name, "shards": ""}
+	case *shardCount > 0:
+		if *shardIndex < 0 || *shardIndex >= *shardCount {
+			return nil, nil, errors.New("shard: --shard.index must be at least 0 and less than --shard.count")
+		}
+		keep = func(id string) bool {
+			h := fnv.New32a()
+			h.Write([]byte(id))
+			return int(h.Sum32()%uint32(*shardCount)) == *shardIndex
+		}
+		labels = prometheus.Labels{"method": "hash", "shard": strconv.Itoa(*shardIndex), "shards": strconv.Itoa(*shardCount)}
+	default:
+		return nil, nil, nil
+	}
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "ecobee_exporter_shard_info",
+		Help:        "shard of the thermostats collected by this exporter, with a constant value of 1",
+		ConstLabels: labels,
+	})
+	info.Set(1)
+	return collector.WithThermostatFilter(keep), info, nil
+}
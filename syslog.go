@@ -0,0 +1,80 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// newSyslogHandler returns a handler sending records to the syslog daemon
+// at addr: "local" for the local daemon, or a URL such as udp://host:514.
+// format creates the handler that formats each record.
+func newSyslogHandler(addr string, format func(io.Writer) slog.Handler) (slog.Handler, error) {
+	var (
+		w   *syslog.Writer
+		err error
+	)
+	if addr == "local" {
+		w, err = syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "ecobee-exporter")
+	} else {
+		var u *url.URL
+		if u, err = url.Parse(addr); err == nil {
+			w, err = syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_DAEMON, "ecobee-exporter")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := &syslogOutput{w: w}
+	return syslogHandler{format(out), out}, nil
+}
+
+// syslogOutput writes formatted records to syslog at the severity of the
+// record being handled.
+type syslogOutput struct {
+	mu    sync.Mutex
+	w     *syslog.Writer
+	level slog.Level
+}
+
+func (o *syslogOutput) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch {
+	case o.level >= slog.LevelError:
+		err = o.w.Err(msg)
+	case o.level >= slog.LevelWarn:
+		err = o.w.Warning(msg)
+	case o.level >= slog.LevelInfo:
+		err = o.w.Info(msg)
+	default:
+		err = o.w.Debug(msg)
+	}
+	return len(p), err
+}
+
+type syslogHandler struct {
+	slog.Handler
+	out *syslogOutput
+}
+
+func (h syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{h.Handler.WithAttrs(attrs), h.out}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{h.Handler.WithGroup(name), h.out}
+}
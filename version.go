@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Build metadata, set at build time by script/settings with
+// -ldflags "-X main.Version=... -X main.GitCommit=... -X main.BuildStamp=...".
+var (
+	Version    = "dev"
+	GitCommit  = "unknown"
+	BuildStamp = "unknown"
+)
+
+// ecobeeLibraryVersion returns the version of go-ecobee compiled into the
+// binary.
+func ecobeeLibraryVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/billykwooten/go-ecobee" {
+				if dep.Replace != nil {
+					return dep.Replace.Version
+				}
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
+
+// buildInfo is a gauge with a constant value of 1 whose labels describe the
+// build, like the output of the version command.
+func buildInfo() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ecobee_exporter_build_info",
+		Help: "build metadata of the exporter, with a constant value of 1",
+		ConstLabels: prometheus.Labels{
+			"version":           Version,
+			"revision":          GitCommit,
+			"build_date":        BuildStamp,
+			"goversion":         runtime.Version(),
+			"go_ecobee_version": ecobeeLibraryVersion(),
+		},
+	}, func() float64 { return 1 })
+}
+
+// printVersion prints the build metadata.
+func printVersion() {
+	fmt.Printf("ecobee-exporter %s\n", Version)
+	fmt.Printf("  revision:   %s\n", GitCommit)
+	fmt.Printf("  build date: %s\n", BuildStamp)
+	fmt.Printf("  go:         %s\n", runtime.Version())
+	fmt.Printf("  go-ecobee:  %s\n", ecobeeLibraryVersion())
+}